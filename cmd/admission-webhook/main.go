@@ -11,6 +11,7 @@ import (
 	"github.com/kabanero-io/kabanero-operator/pkg/apis"
 	kabanerowebhookv1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/webhook/kabanero/v1alpha2"
 	stackwebhook "github.com/kabanero-io/kabanero-operator/pkg/webhook/stack"
+	workloadwebhook "github.com/kabanero-io/kabanero-operator/pkg/webhook/workload"
 
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -99,6 +100,7 @@ func main() {
 	hookServer.Register("/validate-kabaneros/v1alpha2", kabanerowebhookv1alpha2.BuildValidatingWebhook(&mgr))
 	hookServer.Register("/validate-stacks", stackwebhook.BuildValidatingWebhook(&mgr))
 	hookServer.Register("/mutate-stacks", stackwebhook.BuildMutatingWebhook(&mgr))
+	hookServer.Register("/validate-workloads", workloadwebhook.BuildValidatingWebhook(&mgr, namespace))
 
 	log.Info("Starting the Cmd.")
 
@@ -22,6 +22,20 @@ type KabaneroSpec struct {
 	// +listType=set
 	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
 
+	// Selects additional target namespaces by label.  The namespaces matching the selector are targeted along
+	// with the namespaces listed in targetNamespaces, and are added or removed as their labels change.  An empty
+	// selector does not select any namespace.
+	TargetNamespaceSelector *metav1.LabelSelector `json:"targetNamespaceSelector,omitempty"`
+
+	// When true, the pipelines of the activated stacks and the triggers are also created in each of the target
+	// namespaces, so they can be run from there.
+	ActivateInTargetNamespaces bool `json:"activateInTargetNamespaces,omitempty"`
+
+	// Additional or replacement role bindings created in each target namespace.
+	// +listType=map
+	// +listMapKey=name
+	TargetNamespaceRoleBindings []TargetNamespaceRoleBindingSpec `json:"targetNamespaceRoleBindings,omitempty"`
+
 	Github GithubConfig `json:"github,omitempty"`
 
 	GovernancePolicy GovernancePolicyConfig `json:"governancePolicy,omitempty"`
@@ -73,6 +87,42 @@ func (gs GitopsSpec) GetPipelines() []PipelineSpec {
 	return gs.Pipelines
 }
 
+// The scopes of the role bindings created in the target namespaces.
+const (
+	// The binding applies to the pipelines run in the target namespace.
+	RoleBindingScopePipelines = "pipelines"
+
+	// The binding applies to the events processed for the target namespace.
+	RoleBindingScopeEvents = "events"
+
+	// The binding applies to the CLI services.
+	RoleBindingScopeCli = "cli"
+)
+
+// TargetNamespaceRoleBindingSpec defines a RoleBinding created in each target namespace.
+type TargetNamespaceRoleBindingSpec struct {
+	// The name of the RoleBinding.
+	Name string `json:"name"`
+
+	// What the binding applies to: pipelines, events or cli.
+	Scope string `json:"scope"`
+
+	// When true, the default bindings of the scope are not created.
+	ReplacesDefault bool `json:"replacesDefault,omitempty"`
+
+	// The service account bound to the role.
+	ServiceAccountName string `json:"serviceAccountName"`
+
+	// The namespace of the service account.  Defaults to the Kabanero namespace.
+	ServiceAccountNamespace string `json:"serviceAccountNamespace,omitempty"`
+
+	// The kind of the role: Role or ClusterRole.  Defaults to ClusterRole.
+	RoleKind string `json:"roleKind,omitempty"`
+
+	// The name of the Role or ClusterRole.
+	RoleName string `json:"roleName"`
+}
+
 // InstanceStackConfig defines the customization entries for a set of stacks.
 type InstanceStackConfig struct {
 	SkipRegistryCertVerification bool `json:"skipRegistryCertVerification,omitempty"`
@@ -85,6 +135,39 @@ type InstanceStackConfig struct {
 	// +listMapKey=id
 	// +listMapKey=sha256
 	Pipelines []PipelineSpec `json:"pipelines,omitempty"`
+
+	SignatureVerification SignatureVerificationConfig `json:"signatureVerification,omitempty"`
+
+	// Deactivates the stale versions of the stacks.
+	Retention StackRetentionSpec `json:"retention,omitempty"`
+}
+
+// StackRetentionSpec defines when the versions of the stacks are deactivated automatically. Only the versions
+// imported from the stack repositories without a desired state are deactivated.
+type StackRetentionSpec struct {
+	// If set, only the newest N active versions of each stack are kept active.
+	MaxActiveVersions int `json:"maxActiveVersions,omitempty"`
+
+	// If set, the versions whose pipelines were not run in the last N days are deactivated.
+	MaxIdleDays int `json:"maxIdleDays,omitempty"`
+}
+
+// SignatureVerificationConfig defines how the detached signatures of stack indexes and pipeline archives are
+// verified. Signatures are verified when a key reference is configured.
+type SignatureVerificationConfig struct {
+	// The signature format: cosign or gpg. The default is cosign.
+	Format string `json:"format,omitempty"`
+
+	// The Secret or ConfigMap in the Kabanero namespace holding the trusted public keys. Each data entry
+	// holds a PEM encoded public key (cosign) or an armored public key ring (gpg).
+	Keys SignatureKeysReference `json:"keys,omitempty"`
+}
+
+// SignatureKeysReference identifies the Secret or ConfigMap holding trusted public keys.
+type SignatureKeysReference struct {
+	// The kind of the object holding the keys: Secret or ConfigMap.
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name,omitempty"`
 }
 
 // PipelineSpec defines a set of pipelines and associated resources for a component.
@@ -93,6 +176,9 @@ type PipelineSpec struct {
 	Sha256     string            `json:"sha256,omitempty"`
 	Https      HttpsProtocolFile `json:"https,omitempty"`
 	GitRelease GitReleaseSpec    `json:"gitRelease,omitempty"`
+
+	// Values used to render a pipeline packaged as a Helm chart, in the --set format (i.e. image.tag=1.0).
+	Values map[string]string `json:"values,omitempty"`
 }
 
 // HttpsProtocolFile defines how to retrieve a file over https
@@ -134,6 +220,82 @@ type RepositoryConfig struct {
 	Pipelines  []PipelineSpec    `json:"pipelines,omitempty"`
 	Https      HttpsProtocolFile `json:"https,omitempty"`
 	GitRelease GitReleaseSpec    `json:"gitRelease,omitempty"`
+	GitRepo    GitRepoSpec       `json:"gitRepo,omitempty"`
+	Oci        OciArtifactSpec   `json:"oci,omitempty"`
+	ConfigMap  ConfigMapFileSpec `json:"configMap,omitempty"`
+	Bundle     BundleSpec        `json:"bundle,omitempty"`
+
+	// Selects the stacks and stack versions imported from the repository index.
+	Filter StackFilterSpec `json:"filter,omitempty"`
+
+	// When more than one repository publishes the same stack version, the version is imported from the
+	// repository with the highest priority. Repositories with the same priority are considered in the order
+	// they are listed.
+	Priority int `json:"priority,omitempty"`
+}
+
+// StackFilterSpec selects the stacks and stack versions imported from a repository index.
+type StackFilterSpec struct {
+	// Semver ranges keyed by stack id (i.e. java-openliberty: ">=0.2 <0.3"). If set, only the listed stacks are
+	// imported, and only the versions satisfying their range. An empty range matches all versions.
+	Include map[string]string `json:"include,omitempty"`
+
+	// Semver ranges keyed by stack id. The matching versions are not imported. An empty range matches all versions.
+	Exclude map[string]string `json:"exclude,omitempty"`
+
+	// If set, only the latest N patch versions of each major.minor version of a stack are imported.
+	LatestPatchVersions int `json:"latestPatchVersions,omitempty"`
+}
+
+// GitRepoSpec defines how to retrieve a file from a path in a Git repository at a commit or branch.
+type GitRepoSpec struct {
+	Hostname             string `json:"hostname,omitempty"`
+	Organization         string `json:"organization,omitempty"`
+	Project              string `json:"project,omitempty"`
+	Path                 string `json:"path,omitempty"`
+	Revision             string `json:"revision,omitempty"`
+	SkipCertVerification bool   `json:"skipCertVerification,omitempty"`
+}
+
+// Returns true if the user specified the values needed to locate the file in the repository.
+func (gitRepo GitRepoSpec) IsUsable() bool {
+	return len(gitRepo.Hostname) != 0 && len(gitRepo.Organization) != 0 && len(gitRepo.Project) != 0 &&
+		len(gitRepo.Path) != 0
+}
+
+// OciArtifactSpec defines how to retrieve a file stored as an OCI artifact in a container registry.
+type OciArtifactSpec struct {
+	// The artifact reference, including the tag or digest (i.e. registry.example.com/stacks/index:1.0.0).
+	Image string `json:"image,omitempty"`
+
+	// The file name recorded in the org.opencontainers.image.title annotation of the artifact layer.
+	// The default is index.yaml.
+	FileName             string `json:"fileName,omitempty"`
+	SkipCertVerification bool   `json:"skipCertVerification,omitempty"`
+}
+
+// ConfigMapFileSpec defines how to retrieve a file stored in a ConfigMap in the Kabanero namespace.
+type ConfigMapFileSpec struct {
+	Name string `json:"name,omitempty"`
+
+	// The ConfigMap data key holding the file. The default is index.yaml.
+	Key string `json:"key,omitempty"`
+}
+
+// BundleSpec identifies an offline bundle: a gzipped tar archive holding a stack index, the pipeline and
+// trigger archives it references, and the digests of its images. The bundle is read from a ConfigMap in the
+// Kabanero namespace, or from a volume mounted in the operator and stack controller pods.
+type BundleSpec struct {
+	// The ConfigMap holding the bundle. The default key is bundle.tar.gz.
+	ConfigMap ConfigMapFileSpec `json:"configMap,omitempty"`
+
+	// The path of the bundle on a mounted volume (i.e. /var/kabanero/bundles/stacks-0.9.0.tar.gz).
+	Path string `json:"path,omitempty"`
+}
+
+// Returns true if the user specified the location of the bundle.
+func (bundle BundleSpec) IsUsable() bool {
+	return len(bundle.ConfigMap.Name) != 0 || len(bundle.Path) != 0
 }
 
 // GitReleaseSpec defines customization entries for a Git release.
@@ -300,8 +462,79 @@ type KabaneroStatus struct {
 
 	Gitops GitopsStatus `json:"gitops,omitempty"`
 
+	// Status of the trigger archives activated by the Kabanero instance.
+	Triggers TriggersStatus `json:"triggers,omitempty"`
+
 	// Target namespace status
 	TargetNamespaces TargetNamespaceStatus `json:"targetNamespaces,omitempty"`
+
+	// Status of the stacks imported from the stack repositories.
+	Stacks StacksStatus `json:"stacks,omitempty"`
+
+	// The latest observations of the state of the Kabanero instance.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// The condition types reported in the Kabanero and Stack status.
+const (
+	// The resource is reconciled, and all of its dependencies are ready.
+	ConditionTypeReady = "Ready"
+
+	// One or more stack versions are being rolled out.
+	ConditionTypeProgressing = "Progressing"
+
+	// One or more stack versions are published by more than one stack repository.
+	ConditionTypeStackVersionsShadowed = "StackVersionsShadowed"
+)
+
+// The condition status values.
+const (
+	ConditionTrue    = "True"
+	ConditionFalse   = "False"
+	ConditionUnknown = "Unknown"
+)
+
+// Condition describes one aspect of the observed state of a resource. It follows the conventions of the
+// metav1.Condition type found in newer Kubernetes releases.
+type Condition struct {
+	// The type of the condition (i.e. Ready).
+	Type string `json:"type"`
+
+	// The status of the condition: True, False or Unknown.
+	Status string `json:"status"`
+
+	// The generation of the resource the condition was set for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// The last time the status of the condition changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// A CamelCase reason for the last transition of the condition.
+	Reason string `json:"reason,omitempty"`
+
+	// A human readable message describing the last transition of the condition.
+	Message string `json:"message,omitempty"`
+}
+
+// StacksStatus defines the observed state of the stacks imported from the stack repositories.
+type StacksStatus struct {
+	// The stack versions published by more than one repository. Each shadowed version was imported from
+	// the repository that shadows it.
+	// +listType=atomic
+	ShadowedVersions []ShadowedStackVersion `json:"shadowedVersions,omitempty"`
+	Message          string                 `json:"message,omitempty"`
+}
+
+// ShadowedStackVersion identifies a stack version that was not imported from a repository because a
+// repository with a higher priority publishes the same version.
+type ShadowedStackVersion struct {
+	Id         string `json:"id,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Source     string `json:"source,omitempty"`
+	ShadowedBy string `json:"shadowedBy,omitempty"`
 }
 
 type TargetNamespaceStatus struct {
@@ -310,6 +543,17 @@ type TargetNamespaceStatus struct {
 	// applying the role bindings to those namespaces.
 	// +listType=set
 	Namespaces []string `json:"namespaces,omitempty"`
+
+	// These are the namespaces matching spec.targetNamespaceSelector when the
+	// target namespaces were last reconciled.
+	// +listType=set
+	Selected []string `json:"selected,omitempty"`
+
+	// These are the names of the role bindings that were applied to the
+	// target namespaces.
+	// +listType=set
+	RoleBindings []string `json:"roleBindings,omitempty"`
+
 	Ready string `json:"ready,omitempty"`
 	Message string `json:"message,omitempty"`
 }
@@ -320,6 +564,9 @@ type PipelineStatus struct {
 	Url        string         `json:"url,omitempty"`
 	GitRelease GitReleaseInfo `json:"gitRelease,omitempty"`
 	Digest     string         `json:"digest,omitempty"`
+	// The digest of the values the manifests of the pipeline archive were rendered with.  The activated
+	// assets are rendered and applied again when these values change.
+	RenderingDigest string `json:"renderingDigest,omitempty"`
 	// +listType=map
 	// +listMapKey=assetName
 	// +listMapKey=namespace
@@ -351,6 +598,28 @@ func (gs GitopsStatus) GetPipelines() []PipelineStatus {
 	return gs.Pipelines
 }
 
+// The status of the trigger archives
+type TriggersStatus struct {
+	// +listType=map
+	// +listMapKey=name
+	// +listMapKey=digest
+	Triggers []PipelineStatus `json:"triggers,omitempty"`
+	Ready    string           `json:"ready,omitempty"`
+	Message  string           `json:"message,omitempty"`
+}
+
+func (ts TriggersStatus) GetVersions() []ComponentStatusVersion {
+	return []ComponentStatusVersion{ts}
+}
+
+func (ts TriggersStatus) GetVersion() string {
+	return "triggers"
+}
+
+func (ts TriggersStatus) GetPipelines() []PipelineStatus {
+	return ts.Triggers
+}
+
 // KabaneroInstanceStatus defines the observed status details of Kabanero operator instance
 type KabaneroInstanceStatus struct {
 	Ready   string `json:"ready,omitempty"`
@@ -490,6 +759,25 @@ type Kabanero struct {
 	Status KabaneroStatus `json:"status,omitempty"`
 }
 
+// Returns the target namespaces of the Kabanero instance: the namespaces listed in the spec, followed by the
+// namespaces last selected by the target namespace selector.
+func (k *Kabanero) GetTargetNamespaces() []string {
+	namespaces := append([]string{}, k.Spec.TargetNamespaces...)
+	for _, selected := range k.Status.TargetNamespaces.Selected {
+		found := false
+		for _, namespace := range namespaces {
+			if namespace == selected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			namespaces = append(namespaces, selected)
+		}
+	}
+	return namespaces
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // KabaneroList contains a list of Kabanero
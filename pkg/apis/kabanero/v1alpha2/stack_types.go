@@ -18,6 +18,11 @@ const (
 	// It indicates that the stack needs to be deactivated.
 	StackDesiredStateInactive = "inactive"
 
+	// StackDesiredStateCanary represents a desired stack canary state.
+	// It indicates that the stack needs activation in a subset of the target namespaces first,
+	// and is promoted or rolled back depending on the outcome of its PipelineRuns.
+	StackDesiredStateCanary = "canary"
+
 	// StackStateError represents a stack status error state.
 	// It indicates that the stack did not complete an activation process
 	StackStateError = "error"
@@ -33,12 +38,32 @@ const (
 
 	// Stack digest policy: none.
 	StackPolicyNone = "none"
+
+	// Canary phase: the stack version is active in the canary namespaces only.
+	CanaryPhaseProgressing = "progressing"
+
+	// Canary phase: the stack version was promoted and is active in all target namespaces.
+	CanaryPhasePromoted = "promoted"
+
+	// Canary phase: the stack version was rolled back and is inactive.
+	CanaryPhaseRolledBack = "rolledBack"
+
+	// Asset drift policy: report.
+	// Changes made to activated pipeline assets are reported in the asset status.
+	AssetDriftPolicyReport = "report"
+
+	// Asset drift policy: revert.
+	// Changes made to activated pipeline assets are reverted to the rendered manifest.
+	AssetDriftPolicyRevert = "revert"
 )
 
 // StackSpec defines the desired composition of a Stack
 // +k8s:openapi-gen=true
 type StackSpec struct {
 	Name string `json:"name,omitempty"`
+	// Determines how changes made to the activated pipeline assets are handled: report or revert.
+	// If not set, the activated pipeline assets are not checked for changes.
+	AssetDriftPolicy string `json:"assetDriftPolicy,omitempty"`
 	// +listType=map
 	// +listMapKey=version
 	Versions []StackVersion `json:"versions,omitempty"`
@@ -69,6 +94,34 @@ type StackVersion struct {
 	Images               []Image        `json:"images,omitempty"`
 	Devfile              string         `json:"devfile,omitempty"`
 	Metafile             string         `json:"metafile,omitempty"`
+
+	// Determines how the stack version is rolled out when its desired state is canary.
+	Canary StackCanary `json:"canary,omitempty"`
+
+	// The name of the stack repository the version was imported from.
+	Source string `json:"source,omitempty"`
+
+	// User-defined values made available to the manifests of the version's pipelines when they are rendered.
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// StackCanary defines how a stack version with a canary desired state is rolled out.
+type StackCanary struct {
+	// The target namespaces in which the stack version is activated first.
+	// +listType=set
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// The duration after which the stack version is promoted (i.e. 24h).
+	SoakPeriod string `json:"soakPeriod,omitempty"`
+
+	// The number of successful PipelineRuns after which the stack version is promoted.
+	SuccessfulRuns int64 `json:"successfulRuns,omitempty"`
+
+	// The PipelineRun failure rate percentage at or above which the stack version is rolled back.
+	FailureThreshold int64 `json:"failureThreshold,omitempty"`
+
+	// The number of completed PipelineRuns required before the failure rate is evaluated. Defaults to 1.
+	MinimumRuns int64 `json:"minimumRuns,omitempty"`
 }
 
 func (sv StackVersion) GetVersion() string {
@@ -111,6 +164,10 @@ type RepositoryAssetStatus struct {
 	Digest        string `json:"assetDigest,omitempty"`
 	Status        string `json:"status,omitempty"`
 	StatusMessage string `json:"statusMessage,omitempty"`
+
+	// True if the asset was rendered for, and created in, a target namespace rather than the namespace the
+	// pipelines are activated in.
+	NamespaceCopy bool `json:"namespaceCopy,omitempty"`
 }
 
 // StackStatus defines the observed state of a stack
@@ -121,6 +178,11 @@ type StackStatus struct {
 	// +listMapKey=version
 	Versions []StackVersionStatus `json:"versions,omitempty"`
 	Summary  string               `json:"summary,omitempty"`
+
+	// The latest observations of the state of the stack.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 func (s StackStatus) GetVersions() []ComponentStatusVersion {
@@ -145,6 +207,54 @@ type StackVersionStatus struct {
 	// +listMapKey=id
 	// +listMapKey=image
 	Images []ImageStatus `json:"images,omitempty"`
+
+	// The progress of the canary rollout, if the desired state of the version is canary.
+	// +optional
+	Canary *StackCanaryStatus `json:"canary,omitempty"`
+
+	// The name of the stack repository the version was imported from.
+	Source string `json:"source,omitempty"`
+
+	// The use of the pipelines of the version, observed from the PipelineRuns that reference them.
+	// +optional
+	Usage *StackUsageStatus `json:"usage,omitempty"`
+}
+
+// StackCanaryStatus defines the observed state of a canary rollout.
+type StackCanaryStatus struct {
+	Phase string `json:"phase,omitempty"`
+
+	// The canary namespaces in which the stack version is active.
+	// +listType=set
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// The time at which the canary rollout started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// The time at which the stack version was promoted or rolled back.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	SuccessfulRuns int64 `json:"successfulRuns,omitempty"`
+	FailedRuns     int64 `json:"failedRuns,omitempty"`
+}
+
+// StackUsageStatus defines the observed use of the pipelines activated for a stack version.
+type StackUsageStatus struct {
+	// The time at which the use of the version's pipelines started to be tracked.
+	TrackedSince *metav1.Time `json:"trackedSince,omitempty"`
+
+	// The creation time of the most recent PipelineRun of the version's pipelines.  It is kept after the
+	// PipelineRuns are deleted.
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// The number of successful and failed PipelineRuns of the version's pipelines that currently exist.
+	SuccessfulRuns int64 `json:"successfulRuns,omitempty"`
+	FailedRuns     int64 `json:"failedRuns,omitempty"`
+
+	// The namespaces of the PipelineRuns that currently exist.
+	// +listType=set
+	Namespaces []string `json:"namespaces,omitempty"`
 }
 
 func (sv StackVersionStatus) GetVersion() string {
@@ -159,6 +269,10 @@ func (sv StackVersionStatus) GetPipelines() []PipelineStatus {
 type Image struct {
 	Id    string `json:"id,omitempty"`
 	Image string `json:"image,omitempty"`
+
+	// The digest of the image, when it is known in advance (i.e. from an offline bundle). The registry is not
+	// contacted to retrieve the activation digest.
+	Digest string `json:"digest,omitempty"`
 }
 
 // ImageStatus defines a container image status used by a stack
@@ -172,6 +286,17 @@ type ImageStatus struct {
 type ImageDigest struct {
 	Activation string `json:"activation,omitempty"`
 	Message    string `json:"message,omitempty"`
+
+	// The digest currently served by the registry for the stack version's tag.
+	Current string `json:"current,omitempty"`
+
+	// The time at which the current digest was first observed to differ from the activation digest.
+	// +optional
+	DriftTime *metav1.Time `json:"driftTime,omitempty"`
+
+	// The time at which the current digest was last retrieved from the registry.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -5,6 +5,7 @@
 package v1alpha2
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -56,6 +57,23 @@ func (in *AppsodyStatus) DeepCopy() *AppsodyStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BundleSpec) DeepCopyInto(out *BundleSpec) {
+	*out = *in
+	out.ConfigMap = in.ConfigMap
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BundleSpec.
+func (in *BundleSpec) DeepCopy() *BundleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BundleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CRWCustomizationSpec) DeepCopyInto(out *CRWCustomizationSpec) {
 	*out = *in
@@ -246,6 +264,39 @@ func (in *CollectionControllerStatus) DeepCopy() *CollectionControllerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Condition.
+func (in *Condition) DeepCopy() *Condition {
+	if in == nil {
+		return nil
+	}
+	out := new(Condition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapFileSpec) DeepCopyInto(out *ConfigMapFileSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapFileSpec.
+func (in *ConfigMapFileSpec) DeepCopy() *ConfigMapFileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapFileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DevfileRegistrySpec) DeepCopyInto(out *DevfileRegistrySpec) {
 	*out = *in
@@ -336,6 +387,22 @@ func (in *GitReleaseSpec) DeepCopy() *GitReleaseSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitRepoSpec) DeepCopyInto(out *GitRepoSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitRepoSpec.
+func (in *GitRepoSpec) DeepCopy() *GitRepoSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GitRepoSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GithubConfig) DeepCopyInto(out *GithubConfig) {
 	*out = *in
@@ -363,7 +430,9 @@ func (in *GitopsSpec) DeepCopyInto(out *GitopsSpec) {
 	if in.Pipelines != nil {
 		in, out := &in.Pipelines, &out.Pipelines
 		*out = make([]PipelineSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -452,6 +521,14 @@ func (in *Image) DeepCopy() *Image {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageDigest) DeepCopyInto(out *ImageDigest) {
 	*out = *in
+	if in.DriftTime != nil {
+		in, out := &in.DriftTime, &out.DriftTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -468,7 +545,7 @@ func (in *ImageDigest) DeepCopy() *ImageDigest {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageStatus) DeepCopyInto(out *ImageStatus) {
 	*out = *in
-	out.Digest = in.Digest
+	in.Digest.DeepCopyInto(&out.Digest)
 	return
 }
 
@@ -495,8 +572,12 @@ func (in *InstanceStackConfig) DeepCopyInto(out *InstanceStackConfig) {
 	if in.Pipelines != nil {
 		in, out := &in.Pipelines, &out.Pipelines
 		*out = make([]PipelineSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
+	out.SignatureVerification = in.SignatureVerification
+	out.Retention = in.Retention
 	return
 }
 
@@ -648,6 +729,16 @@ func (in *KabaneroSpec) DeepCopyInto(out *KabaneroSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.TargetNamespaceSelector != nil {
+		in, out := &in.TargetNamespaceSelector, &out.TargetNamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TargetNamespaceRoleBindings != nil {
+		in, out := &in.TargetNamespaceRoleBindings, &out.TargetNamespaceRoleBindings
+		*out = make([]TargetNamespaceRoleBindingSpec, len(*in))
+		copy(*out, *in)
+	}
 	in.Github.DeepCopyInto(&out.Github)
 	out.GovernancePolicy = in.GovernancePolicy
 	in.Stacks.DeepCopyInto(&out.Stacks)
@@ -712,7 +803,16 @@ func (in *KabaneroStatus) DeepCopyInto(out *KabaneroStatus) {
 	out.AdmissionControllerWebhook = in.AdmissionControllerWebhook
 	out.Sso = in.Sso
 	in.Gitops.DeepCopyInto(&out.Gitops)
+	in.Triggers.DeepCopyInto(&out.Triggers)
 	in.TargetNamespaces.DeepCopyInto(&out.TargetNamespaces)
+	in.Stacks.DeepCopyInto(&out.Stacks)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -768,11 +868,34 @@ func (in *KnativeServingStatus) DeepCopy() *KnativeServingStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OciArtifactSpec) DeepCopyInto(out *OciArtifactSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OciArtifactSpec.
+func (in *OciArtifactSpec) DeepCopy() *OciArtifactSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OciArtifactSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PipelineSpec) DeepCopyInto(out *PipelineSpec) {
 	*out = *in
 	out.Https = in.Https
 	out.GitRelease = in.GitRelease
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -830,10 +953,17 @@ func (in *RepositoryConfig) DeepCopyInto(out *RepositoryConfig) {
 	if in.Pipelines != nil {
 		in, out := &in.Pipelines, &out.Pipelines
 		*out = make([]PipelineSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	out.Https = in.Https
 	out.GitRelease = in.GitRelease
+	out.GitRepo = in.GitRepo
+	out.Oci = in.Oci
+	out.ConfigMap = in.ConfigMap
+	out.Bundle = in.Bundle
+	in.Filter.DeepCopyInto(&out.Filter)
 	return
 }
 
@@ -864,6 +994,55 @@ func (in *ServerlessStatus) DeepCopy() *ServerlessStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShadowedStackVersion) DeepCopyInto(out *ShadowedStackVersion) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShadowedStackVersion.
+func (in *ShadowedStackVersion) DeepCopy() *ShadowedStackVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(ShadowedStackVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SignatureKeysReference) DeepCopyInto(out *SignatureKeysReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SignatureKeysReference.
+func (in *SignatureKeysReference) DeepCopy() *SignatureKeysReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SignatureKeysReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SignatureVerificationConfig) DeepCopyInto(out *SignatureVerificationConfig) {
+	*out = *in
+	out.Keys = in.Keys
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SignatureVerificationConfig.
+func (in *SignatureVerificationConfig) DeepCopy() *SignatureVerificationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SignatureVerificationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SsoCustomizationSpec) DeepCopyInto(out *SsoCustomizationSpec) {
 	*out = *in
@@ -924,6 +1103,56 @@ func (in *Stack) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackCanary) DeepCopyInto(out *StackCanary) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackCanary.
+func (in *StackCanary) DeepCopy() *StackCanary {
+	if in == nil {
+		return nil
+	}
+	out := new(StackCanary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackCanaryStatus) DeepCopyInto(out *StackCanaryStatus) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackCanaryStatus.
+func (in *StackCanaryStatus) DeepCopy() *StackCanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StackCanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackControllerSpec) DeepCopyInto(out *StackControllerSpec) {
 	*out = *in
@@ -956,6 +1185,36 @@ func (in *StackControllerStatus) DeepCopy() *StackControllerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackFilterSpec) DeepCopyInto(out *StackFilterSpec) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackFilterSpec.
+func (in *StackFilterSpec) DeepCopy() *StackFilterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StackFilterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackList) DeepCopyInto(out *StackList) {
 	*out = *in
@@ -989,6 +1248,22 @@ func (in *StackList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRetentionSpec) DeepCopyInto(out *StackRetentionSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRetentionSpec.
+func (in *StackRetentionSpec) DeepCopy() *StackRetentionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRetentionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 	*out = *in
@@ -1022,6 +1297,13 @@ func (in *StackStatus) DeepCopyInto(out *StackStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -1035,19 +1317,58 @@ func (in *StackStatus) DeepCopy() *StackStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackUsageStatus) DeepCopyInto(out *StackUsageStatus) {
+	*out = *in
+	if in.TrackedSince != nil {
+		in, out := &in.TrackedSince, &out.TrackedSince
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackUsageStatus.
+func (in *StackUsageStatus) DeepCopy() *StackUsageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StackUsageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackVersion) DeepCopyInto(out *StackVersion) {
 	*out = *in
 	if in.Pipelines != nil {
 		in, out := &in.Pipelines, &out.Pipelines
 		*out = make([]PipelineSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.Images != nil {
 		in, out := &in.Images, &out.Images
 		*out = make([]Image, len(*in))
 		copy(*out, *in)
 	}
+	in.Canary.DeepCopyInto(&out.Canary)
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -1074,7 +1395,19 @@ func (in *StackVersionStatus) DeepCopyInto(out *StackVersionStatus) {
 	if in.Images != nil {
 		in, out := &in.Images, &out.Images
 		*out = make([]ImageStatus, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(StackCanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = new(StackUsageStatus)
+		(*in).DeepCopyInto(*out)
 	}
 	return
 }
@@ -1089,6 +1422,43 @@ func (in *StackVersionStatus) DeepCopy() *StackVersionStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StacksStatus) DeepCopyInto(out *StacksStatus) {
+	*out = *in
+	if in.ShadowedVersions != nil {
+		in, out := &in.ShadowedVersions, &out.ShadowedVersions
+		*out = make([]ShadowedStackVersion, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StacksStatus.
+func (in *StacksStatus) DeepCopy() *StacksStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StacksStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetNamespaceRoleBindingSpec) DeepCopyInto(out *TargetNamespaceRoleBindingSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetNamespaceRoleBindingSpec.
+func (in *TargetNamespaceRoleBindingSpec) DeepCopy() *TargetNamespaceRoleBindingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetNamespaceRoleBindingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetNamespaceStatus) DeepCopyInto(out *TargetNamespaceStatus) {
 	*out = *in
@@ -1097,6 +1467,16 @@ func (in *TargetNamespaceStatus) DeepCopyInto(out *TargetNamespaceStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Selected != nil {
+		in, out := &in.Selected, &out.Selected
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RoleBindings != nil {
+		in, out := &in.RoleBindings, &out.RoleBindings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -1143,3 +1523,26 @@ func (in *TriggerSpec) DeepCopy() *TriggerSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TriggersStatus) DeepCopyInto(out *TriggersStatus) {
+	*out = *in
+	if in.Triggers != nil {
+		in, out := &in.Triggers, &out.Triggers
+		*out = make([]PipelineStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TriggersStatus.
+func (in *TriggersStatus) DeepCopy() *TriggersStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TriggersStatus)
+	in.DeepCopyInto(out)
+	return out
+}
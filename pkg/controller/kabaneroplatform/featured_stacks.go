@@ -3,6 +3,10 @@ package kabaneroplatform
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
@@ -10,8 +14,12 @@ import (
 	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/kabaneroplatform/utils"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/stack"
 	sutils "github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
+	controllerutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/metrics"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -24,13 +32,19 @@ func reconcileFeaturedStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 	}
 
 	// Resolve the stacks which are currently featured across the various indexes.
-	stackMap, err := featuredStacks(k, cl, reqLogger)
+	stackMap, _, err := featuredStacks(k, cl, reqLogger)
 	if err != nil {
 		return err
 	}
 
+	// In plan mode, the changes to the Stacks are recorded in a plan instead of being applied.
+	var plan *controllerutils.ActivationPlan
+	if controllerutils.IsPlanMode(k) {
+		plan = &controllerutils.ActivationPlan{}
+	}
+
 	// Clean existing stacks based on the stacks read from the repository index(es).
-	err = preProcessCurrentStacks(ctx, k, cl, stackMap)
+	err = preProcessCurrentStacks(ctx, k, cl, stackMap, plan)
 	if err != nil {
 		return err
 	}
@@ -46,6 +60,7 @@ func reconcileFeaturedStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 		alreadyDeployed := true
 		stackResource := &kabanerov1alpha2.Stack{}
 		err := cl.Get(ctx, name, stackResource)
+		deployedSpec := stackResource.Spec.DeepCopy()
 		if err != nil {
 			if errors.IsNotFound(err) {
 				alreadyDeployed = false
@@ -96,6 +111,7 @@ func reconcileFeaturedStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 						stackVersion.SkipCertVerification = stack.SkipCertVerification
 						stackVersion.SkipRegistryCertVerification = stack.SkipRegistryCertVerification
 						stackVersion.Images = stack.Images
+						stackVersion.Source = stack.Source
 						stackResource.Spec.Versions[j] = stackVersion
 					}
 				}
@@ -106,6 +122,19 @@ func reconcileFeaturedStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 			}
 		}
 
+		// In plan mode, record the stacks that would be created or changed.
+		if plan != nil {
+			if !alreadyDeployed {
+				err = planStackCreate(plan, stackResource, "The stack is published by the stack repositories.")
+				if err != nil {
+					return err
+				}
+			} else if !reflect.DeepEqual(deployedSpec, &stackResource.Spec) {
+				plan.AddUpdate(plannedStack(*stackResource, "The stack versions published by the stack repositories changed."))
+			}
+			continue
+		}
+
 		// Update the CR instance with the new version information.
 		err = updateStack(cl, ctx, stackResource)
 		if err != nil {
@@ -113,13 +142,65 @@ func reconcileFeaturedStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 		}
 	}
 
+	// In plan mode, publish the changes that would have been made to the stacks.
+	if plan != nil {
+		ownerIsController := false
+		assetOwner := metav1.OwnerReference{
+			APIVersion: k.TypeMeta.APIVersion,
+			Kind:       k.TypeMeta.Kind,
+			Name:       k.ObjectMeta.Name,
+			UID:        k.ObjectMeta.UID,
+			Controller: &ownerIsController,
+		}
+
+		planName := k.GetName() + "-stacks-activation-plan"
+		err = controllerutils.PublishActivationPlan(cl, plan, planName, k.GetNamespace(), assetOwner, reqLogger)
+		if err != nil {
+			return err
+		}
+		k.Status.Stacks.Message = strings.TrimSpace(fmt.Sprintf("%v %v The plan was published to ConfigMap %v.", k.Status.Stacks.Message, plan.Summary(), planName))
+	}
+
 	return nil
 }
 
-// Resolves all stacks for the given Kabanero instance
-func featuredStacks(k *kabanerov1alpha2.Kabanero, cl client.Client, reqLogger logr.Logger) (map[string][]kabanerov1alpha2.StackVersion, error) {
+// Returns a planned asset describing the input stack.
+func plannedStack(stack kabanerov1alpha2.Stack, reason string) controllerutils.PlannedAsset {
+	return controllerutils.PlannedAsset{Name: stack.GetName(), Namespace: stack.GetNamespace(), Group: kabanerov1alpha2.SchemeGroupVersion.Group, Version: kabanerov1alpha2.SchemeGroupVersion.Version, Kind: "Stack", Reason: reason}
+}
+
+// Records the creation of the input stack in the plan.
+func planStackCreate(plan *controllerutils.ActivationPlan, stack *kabanerov1alpha2.Stack, reason string) error {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(stack)
+	if err != nil {
+		return fmt.Errorf("Unable to convert stack %v to unstructured: %v", stack.GetName(), err)
+	}
+	manifest := unstructured.Unstructured{Object: obj}
+	manifest.SetAPIVersion(kabanerov1alpha2.SchemeGroupVersion.String())
+	manifest.SetKind("Stack")
+	plan.AddCreate(plannedStack(*stack, reason), manifest)
+	return nil
+}
+
+// Resolves all stacks for the given Kabanero instance, and the triggers published by the stack repositories
+func featuredStacks(k *kabanerov1alpha2.Kabanero, cl client.Client, reqLogger logr.Logger) (map[string][]kabanerov1alpha2.StackVersion, []kabanerov1alpha2.TriggerSpec, error) {
 	stackMap := make(map[string][]kabanerov1alpha2.StackVersion)
-	for _, r := range k.Spec.Stacks.Repositories {
+	triggers := []kabanerov1alpha2.TriggerSpec{}
+
+	// Verify the signatures of the stack indexes if signature verification is configured.
+	verifier := controllerutils.NewSignatureVerifier(cl, k.Spec.Stacks.SignatureVerification, k.GetNamespace())
+
+	// Read the repositories in priority order, so that a stack version published by more than one repository is
+	// imported from the repository with the highest priority.  Repositories with the same priority keep their order.
+	repositories := append([]kabanerov1alpha2.RepositoryConfig{}, k.Spec.Stacks.Repositories...)
+	sort.SliceStable(repositories, func(i, j int) bool {
+		return repositories[i].Priority > repositories[j].Priority
+	})
+
+	sources := make(map[sutils.StackIdVersion]string)
+	var shadowed []kabanerov1alpha2.ShadowedStackVersion
+
+	for _, r := range repositories {
 		// Figure out what set of pipelines to use.  The Kabanero instance defines a default
 		// set, but this can be over-ridden by the specific repository.
 		pipelines := r.Pipelines
@@ -129,41 +210,92 @@ func featuredStacks(k *kabanerov1alpha2.Kabanero, cl client.Client, reqLogger lo
 
 		indexPipelines := []stack.Pipelines{}
 		for _, pipeline := range pipelines {
-			indexPipelines = append(indexPipelines, stack.Pipelines{Id: pipeline.Id, Sha256: pipeline.Sha256, Url: pipeline.Https.Url, GitRelease: pipeline.GitRelease, SkipCertVerification: pipeline.Https.SkipCertVerification})
+			indexPipelines = append(indexPipelines, stack.Pipelines{Id: pipeline.Id, Sha256: pipeline.Sha256, Url: pipeline.Https.Url, GitRelease: pipeline.GitRelease, SkipCertVerification: pipeline.Https.SkipCertVerification, Values: pipeline.Values})
+		}
+
+		start := time.Now()
+		index, err := stack.ResolveVerifiedIndex(cl, r, k.Namespace, indexPipelines, []stack.Trigger{}, "", verifier, reqLogger)
+		metrics.RecordIndexFetch(r.Name, start, err)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		index, err := stack.ResolveIndex(cl, r, k.Namespace, indexPipelines, []stack.Trigger{}, "", reqLogger)
+		// Only import the stack versions selected by the repository filter.
+		filter, err := sutils.NewStackFilter(r.Filter)
 		if err != nil {
-			return nil, err
+			return nil, nil, fmt.Errorf("The filter of stack repository %v is not valid: %v", r.Name, err)
+		}
+
+		indexVersions := []sutils.StackIdVersion{}
+		for _, c := range index.Stacks {
+			indexVersions = append(indexVersions, sutils.StackIdVersion{Id: c.Id, Version: c.Version})
+		}
+
+		selected := make(map[sutils.StackIdVersion]bool)
+		for _, version := range filter.Filter(indexVersions) {
+			selected[version] = true
 		}
 
 		// Create the stack versions
 		for _, c := range index.Stacks {
+			idVersion := sutils.StackIdVersion{Id: c.Id, Version: c.Version}
+			if !selected[idVersion] {
+				reqLogger.Info(fmt.Sprintf("Stack %v %v from repository %v is not selected by the repository filter", c.Id, c.Version, r.Name))
+				continue
+			}
+
+			// Skip the stack versions already imported from a repository with a higher priority.
+			if source, ok := sources[idVersion]; ok {
+				reqLogger.Info(fmt.Sprintf("Stack %v %v from repository %v is shadowed by the same version from repository %v", c.Id, c.Version, r.Name, source))
+				shadowed = append(shadowed, kabanerov1alpha2.ShadowedStackVersion{Id: c.Id, Version: c.Version, Source: r.Name, ShadowedBy: source})
+				continue
+			}
+			sources[idVersion] = r.Name
+
 			// The pipeline information will be in the stack, either because this is a legacy hub and the information was already there, or
 			// because we provided it at the time we read the appsody stack index (in ResolveIndex).
 			pipelines := []kabanerov1alpha2.PipelineSpec{}
 			for _, pipeline := range c.Pipelines {
 				pipelineUrl := kabanerov1alpha2.HttpsProtocolFile{Url: pipeline.Url, SkipCertVerification: pipeline.SkipCertVerification}
-				pipelines = append(pipelines, kabanerov1alpha2.PipelineSpec{Id: pipeline.Id, Sha256: pipeline.Sha256, Https: pipelineUrl, GitRelease: pipeline.GitRelease})
+				pipelines = append(pipelines, kabanerov1alpha2.PipelineSpec{Id: pipeline.Id, Sha256: pipeline.Sha256, Https: pipelineUrl, GitRelease: pipeline.GitRelease, Values: pipeline.Values})
 			}
 
 			// The image information will be in the stack.  Today we just support reading the legacy field from the collection hub.
 			images := []kabanerov1alpha2.Image{}
 			for _, image := range c.Images {
-				images = append(images, kabanerov1alpha2.Image{Id: image.Id, Image: image.Image})
+				images = append(images, kabanerov1alpha2.Image{Id: image.Id, Image: image.Image, Digest: image.Digest})
 			}
 
-			stackMap[c.Id] = append(stackMap[c.Id], kabanerov1alpha2.StackVersion{Pipelines: pipelines, Version: c.Version, Images: images, SkipRegistryCertVerification: k.Spec.Stacks.SkipRegistryCertVerification})
+			stackMap[c.Id] = append(stackMap[c.Id], kabanerov1alpha2.StackVersion{Pipelines: pipelines, Version: c.Version, Images: images, SkipRegistryCertVerification: k.Spec.Stacks.SkipRegistryCertVerification, Source: r.Name})
+		}
+
+		// The triggers are read with the same certificate verification as the index that published them.
+		for _, trigger := range index.Triggers {
+			triggerUrl := kabanerov1alpha2.HttpsProtocolFile{Url: trigger.Url, SkipCertVerification: r.Https.SkipCertVerification}
+			triggers = append(triggers, kabanerov1alpha2.TriggerSpec{Id: trigger.Id, Sha256: trigger.Sha256, Https: triggerUrl})
 		}
 	}
 
-	return stackMap, nil
+	// Report the shadowed stack versions in the Kabanero instance status.
+	k.Status.Stacks.ShadowedVersions = shadowed
+	k.Status.Stacks.Message = ""
+	if len(shadowed) != 0 {
+		k.Status.Stacks.Message = fmt.Sprintf("%v stack version(s) are published by more than one repository. Each was imported from the repository with the highest priority.", len(shadowed))
+	}
+
+	return stackMap, triggers, nil
 }
 
 // Cleans up currently deployed stacks based on desired state. Stack versions with an non-empty state must be preserved and not modified.
-func preProcessCurrentStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client, indexStackMap map[string][]kabanerov1alpha2.StackVersion) error {
+// If a plan is provided, the changes are recorded in the plan instead of being applied.
+func preProcessCurrentStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client, indexStackMap map[string][]kabanerov1alpha2.StackVersion, plan *controllerutils.ActivationPlan) error {
+	err := sutils.ValidateRetentionPolicy(k.Spec.Stacks.Retention)
+	if err != nil {
+		return err
+	}
+
 	deployedStacks := &kabanerov1alpha2.StackList{}
-	err := cl.List(ctx, deployedStacks, client.InNamespace(k.GetNamespace()))
+	err = cl.List(ctx, deployedStacks, client.InNamespace(k.GetNamespace()))
 	if err != nil {
 		return err
 	}
@@ -171,6 +303,7 @@ func preProcessCurrentStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 	// Compare the list of currently deployed stacks and the stacks in the index.
 	for _, deployedStack := range deployedStacks.Items {
 		iStackList, _ := indexStackMap[deployedStack.GetName()]
+		retentionReasons := sutils.GetDeactivationReasons(deployedStack)
 		newStackVersions := []kabanerov1alpha2.StackVersion{}
 		for _, dStackVersion := range deployedStack.Spec.Versions {
 			deployedStackVersionMatchIndex := false
@@ -183,8 +316,10 @@ func preProcessCurrentStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 				}
 			}
 
-			// Keep any stack versions that have a desired state that is not empty.
-			if !deployedStackVersionMatchIndex && len(dStackVersion.DesiredState) > 0 {
+			// Keep any stack versions that have a desired state that is not empty, unless the version was
+			// deactivated by the retention policy.
+			_, retained := retentionReasons[dStackVersion.Version]
+			if !deployedStackVersionMatchIndex && len(dStackVersion.DesiredState) > 0 && !retained {
 				newStackVersions = append(newStackVersions, dStackVersion)
 				continue
 			}
@@ -192,17 +327,33 @@ func preProcessCurrentStacks(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 
 		// If there were no indications that the stack should be kept around, delete it.
 		if len(newStackVersions) == 0 {
-			err := cl.Delete(ctx, &deployedStack)
-			if err != nil {
-				return err
+			if plan != nil {
+				plan.AddDelete(plannedStack(deployedStack, "The stack is no longer published by the stack repositories."))
+			} else {
+				err := cl.Delete(ctx, &deployedStack)
+				if err != nil {
+					return err
+				}
 			}
-			break
+			continue
 		}
 
+		// Deactivate the stale versions of the stack according to the retention policy.
+		versionsChanged := len(deployedStack.Spec.Versions) != len(newStackVersions)
+		deployedStack.Spec.Versions = newStackVersions
+		retentionChanged := sutils.ApplyRetentionPolicy(k.Spec.Stacks.Retention, &deployedStack, time.Now())
+
 		// If there were differences between the deployed list of versions and the list of deployed versions that need to be kept,
 		// update the current stack.
-		if len(deployedStack.Spec.Versions) != len(newStackVersions) {
-			deployedStack.Spec.Versions = newStackVersions
+		if versionsChanged || retentionChanged {
+			if plan != nil {
+				reason := "The stack versions that are no longer published by the stack repositories would be removed."
+				if retentionChanged {
+					reason = "The retention policy would deactivate stack versions."
+				}
+				plan.AddUpdate(plannedStack(deployedStack, reason))
+				continue
+			}
 			cl.Update(ctx, &deployedStack)
 		}
 	}
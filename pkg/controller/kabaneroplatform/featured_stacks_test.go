@@ -7,9 +7,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	"github.com/go-logr/logr"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	controllerutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -498,7 +502,7 @@ func TestResolveFeaturedStacks(t *testing.T) {
 	stack_index_url := server.URL + defaultIndexName
 	k := createKabanero(stack_index_url)
 
-	stacks, err := featuredStacks(k, nil, featuredTestLogger)
+	stacks, _, err := featuredStacks(k, nil, featuredTestLogger)
 	if err != nil {
 		t.Fatal("Could not resolve the featured stacks from the default index", err)
 	}
@@ -528,6 +532,36 @@ func TestResolveFeaturedStacks(t *testing.T) {
 	}
 }
 
+// Test that only the stack versions selected by the repository filter are resolved
+func TestResolveFeaturedStacksFilter(t *testing.T) {
+	// The server that will host the pipeline zip
+	server := httptest.NewServer(stackIndexHandler{})
+	defer server.Close()
+
+	stack_index_url := server.URL + defaultIndexName
+	k := createKabanero(stack_index_url)
+	k.Spec.Stacks.Repositories[0].Filter = kabanerov1alpha2.StackFilterSpec{Include: map[string]string{"java-microprofile": ">=0.2 <0.3", "nodejs": ">=0.3"}}
+
+	stacks, _, err := featuredStacks(k, nil, featuredTestLogger)
+	if err != nil {
+		t.Fatal("Could not resolve the featured stacks from the default index", err)
+	}
+
+	if len(stacks) != 1 {
+		t.Fatal(fmt.Sprintf("Was expecting 1 stack to be found, but found %v: %v", len(stacks), stacks))
+	}
+
+	if _, ok := stacks["java-microprofile"]; !ok {
+		t.Fatal(fmt.Sprintf("Could not find java-microprofile stack: %v", stacks))
+	}
+
+	k.Spec.Stacks.Repositories[0].Filter = kabanerov1alpha2.StackFilterSpec{Include: map[string]string{"nodejs": "not a range"}}
+	_, _, err = featuredStacks(k, nil, featuredTestLogger)
+	if err == nil {
+		t.Fatal("An error should have been returned for an invalid repository filter")
+	}
+}
+
 // Attempts to resolve the featured stacks from two repositories
 func TestResolveFeaturedStacksTwoRepositories(t *testing.T) {
 	// The server that will host the pipeline zip
@@ -540,7 +574,7 @@ func TestResolveFeaturedStacksTwoRepositories(t *testing.T) {
 	k.Spec.Stacks.Repositories = append(k.Spec.Stacks.Repositories, kabanerov1alpha2.RepositoryConfig{Name: "two", Https: kabanerov1alpha2.HttpsProtocolFile{Url: stack_index_url_two, SkipCertVerification: true}})
 	cl := unitTestClient{make(map[string]*kabanerov1alpha2.Stack)}
 
-	stacks, err := featuredStacks(k, cl, featuredTestLogger)
+	stacks, _, err := featuredStacks(k, cl, featuredTestLogger)
 	if err != nil {
 		t.Fatal("Could not resolve the featured stacks from the default index", err)
 	}
@@ -570,6 +604,63 @@ func TestResolveFeaturedStacksTwoRepositories(t *testing.T) {
 	}
 }
 
+// Test that a stack version published by two repositories is imported from the repository with the highest priority
+func TestResolveFeaturedStacksPriority(t *testing.T) {
+	// The server that will host the pipeline zip
+	server := httptest.NewServer(stackIndexHandler{})
+	defer server.Close()
+
+	stack_index_url := server.URL + defaultIndexName
+	k := createKabanero(stack_index_url)
+	k.Spec.Stacks.Repositories = append(k.Spec.Stacks.Repositories, kabanerov1alpha2.RepositoryConfig{Name: "mirror", Priority: 10, Https: kabanerov1alpha2.HttpsProtocolFile{Url: stack_index_url, SkipCertVerification: true}})
+
+	stacks, _, err := featuredStacks(k, nil, featuredTestLogger)
+	if err != nil {
+		t.Fatal("Could not resolve the featured stacks from the default index", err)
+	}
+
+	for id, versions := range stacks {
+		if len(versions) != 1 {
+			t.Fatal(fmt.Sprintf("Expected one version of the %v stack, but found %v: %v", id, len(versions), versions))
+		}
+		if versions[0].Source != "mirror" {
+			t.Fatal(fmt.Sprintf("Expected the %v stack to be imported from the mirror repository, but it was imported from %v", id, versions[0].Source))
+		}
+	}
+
+	shadowed := k.Status.Stacks.ShadowedVersions
+	if len(shadowed) != 2 {
+		t.Fatal(fmt.Sprintf("Expected 2 shadowed stack versions, but found %v: %v", len(shadowed), shadowed))
+	}
+	if shadowed[0].Source != "default" || shadowed[0].ShadowedBy != "mirror" {
+		t.Fatal(fmt.Sprintf("Expected the default repository to be shadowed by the mirror repository: %v", shadowed[0]))
+	}
+	if len(k.Status.Stacks.Message) == 0 {
+		t.Fatal("Expected a status message reporting the shadowed stack versions")
+	}
+
+	setKabaneroConditions(k, map[string]bool{"tekton": true, "appsody": false})
+	condition := controllerutils.FindStatusCondition(k.Status.Conditions, kabanerov1alpha2.ConditionTypeStackVersionsShadowed)
+	if condition == nil || condition.Status != kabanerov1alpha2.ConditionTrue {
+		t.Fatal(fmt.Sprintf("Expected the StackVersionsShadowed condition to be true: %v", k.Status.Conditions))
+	}
+	condition = controllerutils.FindStatusCondition(k.Status.Conditions, kabanerov1alpha2.ConditionTypeReady)
+	if condition == nil || condition.Status != kabanerov1alpha2.ConditionFalse || !strings.Contains(condition.Message, "appsody") {
+		t.Fatal(fmt.Sprintf("Expected the Ready condition to report the appsody component as not ready: %v", k.Status.Conditions))
+	}
+
+	// Without priorities, the repository listed first wins.
+	k.Spec.Stacks.Repositories[1].Priority = 0
+	stacks, _, err = featuredStacks(k, nil, featuredTestLogger)
+	if err != nil {
+		t.Fatal("Could not resolve the featured stacks from the default index", err)
+	}
+
+	if stacks["nodejs"][0].Source != "default" {
+		t.Fatal(fmt.Sprintf("Expected the nodejs stack to be imported from the default repository, but it was imported from %v", stacks["nodejs"][0].Source))
+	}
+}
+
 // Tests that if an existing stack version has desired state defined (any allowed string), it should not be deleted or modified.
 // Tests that if an existing stack version has no desired state defined and it matches the version in the index, the existing
 // stack's values are overriden by the ones in the index.
@@ -900,3 +991,118 @@ func TestResolveFeaturedStacksCleanup4(t *testing.T) {
 		}
 	}
 }
+
+// Tests that all of the stacks that are no longer published are deleted, not only the first one.
+func TestResolveFeaturedStacksCleanup5(t *testing.T) {
+	deployedStacks := make(map[string]*kabanerov1alpha2.Stack)
+	for _, name := range []string{"cleanuptest1", "cleanuptest2"} {
+		stack := stackResource.DeepCopy()
+		stack.Spec.Name = name
+		stack.ObjectMeta.Name = name
+		deployedStacks[name] = stack
+	}
+	cl := unitTestClient{deployedStacks}
+
+	server := httptest.NewServer(stackIndexHandler{})
+	defer server.Close()
+	stackUrl := server.URL + defaultIndexName
+	k := createKabanero(stackUrl)
+
+	ctx := context.Background()
+	err := reconcileFeaturedStacks(ctx, k, cl, featuredTestLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"cleanuptest1", "cleanuptest2"} {
+		if _, ok := deployedStacks[name]; ok {
+			t.Fatal(fmt.Sprintf("The %v stack should have been deleted: %v", name, deployedStacks))
+		}
+	}
+
+	if len(deployedStacks) != 2 {
+		t.Fatal(fmt.Sprintf("The java-microprofile and nodejs stacks should have been created: %v", deployedStacks))
+	}
+}
+
+// Client that creates/deletes stacks, and holds the ConfigMaps that the plans are published to.
+type planTestClient struct {
+	unitTestClient
+	configMaps map[string]*corev1.ConfigMap
+}
+
+func (c planTestClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return c.unitTestClient.Get(ctx, key, obj)
+	}
+	existing := c.configMaps[key.Name]
+	if existing == nil {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	existing.DeepCopyInto(configMap)
+	return nil
+}
+func (c planTestClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return c.unitTestClient.Create(ctx, obj, opts...)
+	}
+	c.configMaps[configMap.Name] = configMap
+	return nil
+}
+func (c planTestClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return c.unitTestClient.Update(ctx, obj, opts...)
+	}
+	c.configMaps[configMap.Name] = configMap
+	return nil
+}
+
+// Tests that in plan mode, the stacks are not created, updated or deleted, and that the changes are published
+// in a plan instead.
+func TestReconcileFeaturedStacksPlanMode(t *testing.T) {
+	stack := stackResource.DeepCopy()
+	stack.Spec.Name = "cleanuptest"
+	stack.ObjectMeta.Name = "cleanuptest"
+
+	deployedStacks := make(map[string]*kabanerov1alpha2.Stack)
+	deployedStacks[stack.Name] = stack
+	cl := planTestClient{unitTestClient{deployedStacks}, make(map[string]*corev1.ConfigMap)}
+
+	server := httptest.NewServer(stackIndexHandler{})
+	defer server.Close()
+	stackUrl := server.URL + defaultIndexName
+	k := createKabanero(stackUrl)
+	k.SetAnnotations(map[string]string{controllerutils.PlanModeAnnotation: "true"})
+
+	ctx := context.Background()
+	err := reconcileFeaturedStacks(ctx, k, cl, featuredTestLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deployedStacks) != 1 || deployedStacks["cleanuptest"] == nil {
+		t.Fatal(fmt.Sprintf("The stacks should not have been changed in plan mode: %v", deployedStacks))
+	}
+
+	configMap := cl.configMaps["kabanero-stacks-activation-plan"]
+	if configMap == nil {
+		t.Fatal(fmt.Sprintf("The plan should have been published, but found: %v", cl.configMaps))
+	}
+
+	plan := controllerutils.ActivationPlan{}
+	err = yaml.Unmarshal([]byte(configMap.Data[controllerutils.ActivationPlanKey]), &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Create) != 2 || len(plan.Update) != 0 || len(plan.Delete) != 1 || plan.Delete[0].Name != "cleanuptest" || plan.Delete[0].Kind != "Stack" {
+		t.Fatal(fmt.Sprintf("The plan should create 2 stacks and delete cleanuptest: %v", plan))
+	}
+
+	if !strings.Contains(k.Status.Stacks.Message, "kabanero-stacks-activation-plan") {
+		t.Fatal(fmt.Sprintf("The stacks status should refer to the plan: %v", k.Status.Stacks.Message))
+	}
+}
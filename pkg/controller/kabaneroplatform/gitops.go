@@ -2,6 +2,7 @@ package kabaneroplatform
 
 import (
 	"context"
+	"fmt"
 
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
 	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
@@ -15,8 +16,11 @@ import (
 func reconcileGitopsPipelines(ctx context.Context, k *kabanerov1alpha2.Kabanero, c client.Client, reqLogger logr.Logger) error {
 	reqLogger.Info("Reconciling Gitops pipelines.")
 
-	// Gather the known asset (*-tasks, *-pipeline) substitution data.  (none presently)
+	// Gather the known asset (*-tasks, *-pipeline) substitution data.
 	renderingContext := make(map[string]interface{})
+	renderingContext["TargetNamespaces"] = k.GetTargetNamespaces()
+	renderingContext["KabaneroNamespace"] = k.GetNamespace()
+	renderingContext["KabaneroName"] = k.GetName()
 
 	// Identify the owner of the pipeline resources
 	ownerIsController := false
@@ -28,12 +32,29 @@ func reconcileGitopsPipelines(ctx context.Context, k *kabanerov1alpha2.Kabanero,
 		Controller: &ownerIsController,
 	}
 
+	// Verify the signatures of the pipeline archives if signature verification is configured.
+	options := cutils.ActivationOptions{Verifier: cutils.NewSignatureVerifier(c, k.Spec.Stacks.SignatureVerification, k.GetNamespace())}
+	if cutils.IsPlanMode(k) {
+		options.Plan = &cutils.ActivationPlan{}
+	}
+
 	// Activate the pipelines used by the gitops repository
-	assetUseMap, err := cutils.ActivatePipelines(k.Spec.Gitops, k.Status.Gitops, k.GetNamespace(), renderingContext, assetOwner, c, reqLogger)
+	assetUseMap, err := cutils.ActivatePipelines(k.Spec.Gitops, k.Status.Gitops, k.GetNamespace(), renderingContext, assetOwner, c, options, reqLogger)
 
 	if err != nil {
 		return err
 	}
+
+	// In plan mode, publish the changes that would have been made and keep the current status.
+	if options.Plan != nil {
+		planName := k.GetName() + "-gitops-activation-plan"
+		err = cutils.PublishActivationPlan(c, options.Plan, planName, k.GetNamespace(), assetOwner, reqLogger)
+		if err != nil {
+			return err
+		}
+		k.Status.Gitops.Message = fmt.Sprintf("%v The plan was published to ConfigMap %v.", options.Plan.Summary(), planName)
+		return nil
+	}
 	
 	// Now update the GitopsStatus to reflect the current state of things.
 	newGitopsStatus := kabanerov1alpha2.GitopsStatus{Ready: "True"}
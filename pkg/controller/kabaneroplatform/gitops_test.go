@@ -226,6 +226,46 @@ func TestReconcileGitopsPipelines(t *testing.T) {
 	}
 }
 
+// Make sure the pipelines are not activated when their signature cannot be verified.
+func TestReconcileGitopsPipelinesSignatureVerification(t *testing.T) {
+	// The server that will host the pipeline zip
+	server := httptest.NewServer(stackHandler{})
+	defer server.Close()
+
+	kabaneroResource := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			Stacks: kabanerov1alpha2.InstanceStackConfig{
+				SignatureVerification: kabanerov1alpha2.SignatureVerificationConfig{
+					Keys: kabanerov1alpha2.SignatureKeysReference{Kind: "Secret", Name: "trusted-keys"},
+				},
+			},
+			Gitops: kabanerov1alpha2.GitopsSpec{
+				Pipelines: []kabanerov1alpha2.PipelineSpec{{
+					Id:     "default",
+					Sha256: digest1Pipeline.sha256,
+					Https:  kabanerov1alpha2.HttpsProtocolFile{Url: server.URL + digest1Pipeline.name, SkipCertVerification: true},
+				}},
+			},
+		},
+	}
+
+	// The client does not hold the Secret with the trusted keys, so the signature cannot be verified.
+	client := gitopsTestClient{map[client.ObjectKey]bool{}}
+	err := reconcileGitopsPipelines(context.TODO(), &kabaneroResource, client, klog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 0 {
+		t.Fatal(fmt.Sprintf("No pipeline assets should have been created, but found: %v", client.objs))
+	}
+
+	if len(kabaneroResource.Status.Gitops.Message) == 0 || kabaneroResource.Status.Gitops.Ready != "False" {
+		t.Fatal(fmt.Sprintf("Kabanero Gitops should not be ready: %v", kabaneroResource.Status.Gitops))
+	}
+}
+
 // Make sure we can clean stuff up.
 func TestCleanupGitopsPipelines(t *testing.T) {
 	kabaneroResource := kabanerov1alpha2.Kabanero{
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	controllerutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
   "github.com/kabanero-io/kabanero-operator/pkg/controller/utils/timer"
 	"github.com/kabanero-io/kabanero-operator/pkg/versioning"
 	mfc "github.com/manifestival/controller-runtime-client"
@@ -19,10 +22,13 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -55,6 +61,7 @@ var reconcileFuncs = []reconcileFuncType{
 	{name: "events", function: reconcileEvents},
 	{name: "sso", function: reconcileSso},
 	{name: "gitops", function: reconcileGitopsPipelines},
+	{name: "triggers", function: reconcileTriggers},
 	{name: "target namespaces", function: reconcileTargetNamespaces},
 	{name: "devfile registry controller", function: reconcileDevfileRegistry},
 }
@@ -78,6 +85,7 @@ func Add(mgr manager.Manager) error {
 		client:          mgr.GetClient(),
 		scheme:          mgr.GetScheme(),
 		requeueDelayMap: make(map[string]RequeueData),
+		recorder:        mgr.GetEventRecorderFor("kabanero-operator"),
 	  watchNamespace:  watchNamespace}
 
 	// Create a new controller
@@ -93,8 +101,10 @@ func Add(mgr manager.Manager) error {
 		return err
 	}
 
-	// Watch Stacks
-	err = c.Watch(&source.Kind{Type: &kabanerov1alpha2.Stack{}}, getWatchHandlerForKabaneroOwner(), getWatchPredicateFunc())
+	// Watch Stacks.  Besides the featured stacks owned by the Kabanero instance, the canary namespaces of the
+	// versions of any stack in the namespace need the activation bindings.
+	err = c.Watch(&source.Kind{Type: &kabanerov1alpha2.Stack{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.stackMapFunc)}, getStackWatchPredicateFunc())
 	if err != nil {
 		return err
 	}
@@ -112,12 +122,15 @@ func Add(mgr manager.Manager) error {
 		return err
 	}
 
-	// Watch Namespace instances.  We only care about create and delete events, not update events.
-	// When we see that a namespace has been created/deleted, we need to process any Kabanero objects that
-	// reference that namespace.
+	// Watch Namespace instances.  We only care about create and delete events, and about update events
+	// that change the labels of the namespace.  When we see that a namespace has been created/deleted, or
+	// that it may have started or stopped matching a target namespace selector, we need to process any
+	// Kabanero objects that reference that namespace.
 	err = c.Watch(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{
 		ToRequests: handler.ToRequestsFunc(r.targetNamespaceMapFunc)}, predicate.Funcs{
-			UpdateFunc: func(e event.UpdateEvent) bool { return false }})
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !reflect.DeepEqual(e.MetaOld.GetLabels(), e.MetaNew.GetLabels())
+		}})
 	if err != nil {
 		return err
 	}
@@ -181,6 +194,28 @@ func getWatchPredicateFunc() predicate.Funcs {
 	}
 }
 
+// Like getWatchPredicateFunc, but also returns true when the canary phases or the active asset namespaces in
+// the stack status change, since the target namespaces that need the activation bindings depend on them.
+func getStackWatchPredicateFunc() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() {
+				return true
+			}
+
+			oldStack, ok := e.ObjectOld.(*kabanerov1alpha2.Stack)
+			if !ok {
+				return false
+			}
+			newStack, ok := e.ObjectNew.(*kabanerov1alpha2.Stack)
+			if !ok {
+				return false
+			}
+			return stackNamespacesChanged(oldStack, newStack)
+		},
+	}
+}
+
 var _ reconcile.Reconciler = &ReconcileKabanero{}
 
 // ReconcileKabanero reconciles a KabaneroPlatform object
@@ -190,15 +225,40 @@ type ReconcileKabanero struct {
 	client          client.Client
 	scheme          *runtime.Scheme
 	requeueDelayMap map[string]RequeueData
+	recorder        record.EventRecorder
 	watchNamespace  string
 }
 
+// Records an event against the Kabanero instance.  The recorder is not set by unit tests.
+func (r *ReconcileKabanero) recordEvent(k *kabanerov1alpha2.Kabanero, eventtype string, reason string, message string) {
+	if r.recorder != nil {
+		r.recorder.Event(k, eventtype, reason, message)
+	}
+}
+
 // RequeueData stores information that enables reconcile operations to be retried.
 type RequeueData struct {
 	delay      int
 	futureTime time.Time
 }
 
+// When we see that a stack has changed, we want to reconcile the Kabanero instances in its namespace, so that
+// the activation bindings follow the canary namespaces of its versions.
+func (r *ReconcileKabanero) stackMapFunc(a handler.MapObject) []reconcile.Request {
+	kabaneros := &kabanerov1alpha2.KabaneroList{}
+	err := r.client.List(context.TODO(), kabaneros, client.InNamespace(a.Meta.GetNamespace()))
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Could not process stack event for \"%v\"", a.Meta.GetName()))
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, kabanero := range kabaneros.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: kabanero.Name, Namespace: kabanero.Namespace}})
+	}
+	return requests
+}
+
 // When we see that a namespace has changed, we want to reconcile any Kabanero instances that
 // reference that namespace in its targetNamespaces list.
 func (r *ReconcileKabanero) targetNamespaceMapFunc(a handler.MapObject) []reconcile.Request {
@@ -212,20 +272,36 @@ func (r *ReconcileKabanero) targetNamespaceMapFunc(a handler.MapObject) []reconc
 		return nil
 	}
 
-	// For each Kabanero instance, if spec.targetNamespaces includes a.meta.name then add a reconcile request.
+	// For each Kabanero instance, if spec.targetNamespaces includes a.meta.name, or if the namespace was or is
+	// now selected by spec.targetNamespaceSelector, then add a reconcile request.
 	requests := []reconcile.Request{}
 	for _, kabanero := range kabaneros.Items {
-		for _, namespace := range kabanero.Spec.TargetNamespaces {
-			if namespace == a.Meta.GetName() {
-				requests = append(requests, reconcile.Request{types.NamespacedName{Name: kabanero.Name, Namespace: kabanero.Namespace}})
-				break
-			}
+		if isTargetNamespaceCandidate(&kabanero, a.Meta) {
+			requests = append(requests, reconcile.Request{types.NamespacedName{Name: kabanero.Name, Namespace: kabanero.Namespace}})
 		}
 	}
 	
   return requests
 }
 
+// Returns true if the input namespace is targeted by the Kabanero instance, or matches its target namespace selector.
+func isTargetNamespaceCandidate(kabanero *kabanerov1alpha2.Kabanero, namespace metav1.Object) bool {
+	for _, targetNamespace := range kabanero.GetTargetNamespaces() {
+		if targetNamespace == namespace.GetName() {
+			return true
+		}
+	}
+
+	if kabanero.Spec.TargetNamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(kabanero.Spec.TargetNamespaceSelector)
+		if err == nil && !selector.Empty() && selector.Matches(labels.Set(namespace.GetLabels())) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Determine if requeue is needed or not.
 // If requeue is required set RequeueAfter to 60 seconds the first time.
 // After the first time increase RequeueAfter by 60 seconds up to a max of 15 minutes.
@@ -369,6 +445,7 @@ func (r *ReconcileKabanero) Reconcile(request reconcile.Request) (reconcile.Resu
 		err = component.function(ctx, instance, r.client, reqLogger)
 		if err != nil {
 			reqLogger.Error(err, fmt.Sprintf("Error deploying %v.", component.name))
+			r.recordEvent(instance, corev1.EventTypeWarning, "ReconcileFailed", fmt.Sprintf("Error deploying %v: %v", component.name, err))
 			processStatus(ctx, request, instance, r.client, reqLogger)
 			return reconcile.Result{}, err
 		}
@@ -378,6 +455,7 @@ func (r *ReconcileKabanero) Reconcile(request reconcile.Request) (reconcile.Resu
 	err = reconcileFeaturedStacks(ctx, instance, r.client, reqLogger)
 	if err != nil {
 		reqLogger.Error(err, "Error reconciling featured stacks.")
+		r.recordEvent(instance, corev1.EventTypeWarning, "StackRepositoryFailed", fmt.Sprintf("Error reconciling featured stacks: %v", err))
 		processStatus(ctx, request, instance, r.client, reqLogger)
 		return r.determineHowToRequeue(ctx, request, instance, err.Error(), r.requeueDelayMap, reqLogger)
 	}
@@ -496,6 +574,12 @@ func cleanup(ctx context.Context, k *kabanerov1alpha2.Kabanero, client client.Cl
 	if err != nil {
 		return err
 	}
+
+	// Cleanup the triggers and their cross-namespace objects
+	err = cleanupTriggers(ctx, k, client, reqLogger)
+	if err != nil {
+		return err
+	}
 	
 	// Remove the cross-namespace objects that target namespaces use.
 	err = cleanupTargetNamespaces(ctx, k, client)
@@ -522,6 +606,34 @@ func isFinalizerInList(k *kabanerov1alpha2.Kabanero, finalizer string) bool {
 	return false
 }
 
+// Sets the Ready and StackVersionsShadowed conditions of the Kabanero instance. The input map holds the
+// readiness of each component, keyed by its status field name.
+func setKabaneroConditions(k *kabanerov1alpha2.Kabanero, componentReadiness map[string]bool) {
+	notReady := []string{}
+	for component, ready := range componentReadiness {
+		if !ready {
+			notReady = append(notReady, component)
+		}
+	}
+	sort.Strings(notReady)
+
+	ready := kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeReady, Status: kabanerov1alpha2.ConditionTrue, Reason: "ComponentsReady", ObservedGeneration: k.Generation}
+	if len(notReady) != 0 {
+		ready.Status = kabanerov1alpha2.ConditionFalse
+		ready.Reason = "ComponentsNotReady"
+		ready.Message = fmt.Sprintf("The following components are not ready: %v. See the status of each component for details.", strings.Join(notReady, ", "))
+	}
+	controllerutils.SetStatusCondition(&k.Status.Conditions, ready)
+
+	shadowed := kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeStackVersionsShadowed, Status: kabanerov1alpha2.ConditionFalse, Reason: "NoDuplicateStackVersions", ObservedGeneration: k.Generation}
+	if len(k.Status.Stacks.ShadowedVersions) != 0 {
+		shadowed.Status = kabanerov1alpha2.ConditionTrue
+		shadowed.Reason = "DuplicateStackVersions"
+		shadowed.Message = k.Status.Stacks.Message
+	}
+	controllerutils.SetStatusCondition(&k.Status.Conditions, shadowed)
+}
+
 // Retrieves Kabanero resource dependencies' readiness status to determine the Kabanero instance readiness status.
 // If all resource dependencies are in the ready state, the kabanero instance's readiness status
 // is set to true. Otherwise, it is set to false.
@@ -545,6 +657,7 @@ func processStatus(ctx context.Context, request reconcile.Request, k *kabanerov1
 	isAdmissionControllerWebhookReady, _ := getAdmissionControllerWebhookStatus(k, c, reqLogger)
 	isSsoReady, _ := getSsoStatus(k, c, reqLogger)
 	isGitopsReady, _ := getGitopsStatus(k)
+	isTriggersReady, _ := getTriggersStatus(k)
 	isTargetNamespacesReady, _ := getTargetNamespacesStatus(k)
 
 	// Set the overall status.
@@ -560,6 +673,7 @@ func processStatus(ctx context.Context, request reconcile.Request, k *kabanerov1
 		isAdmissionControllerWebhookReady &&
 		isSsoReady &&
 		isGitopsReady &&
+		isTriggersReady &&
 		isTargetNamespacesReady
 
 	if isKabaneroReady {
@@ -569,6 +683,24 @@ func processStatus(ctx context.Context, request reconcile.Request, k *kabanerov1
 		k.Status.KabaneroInstance.Message = errorMessage
 	}
 
+	// Set the conditions from the component status.
+	setKabaneroConditions(k, map[string]bool{
+		"stackController":            isStackControllerReady,
+		"tekton":                     isTektonReady,
+		"serverless":                 isServerlessReady,
+		"cli":                        isCliRouteReady,
+		"landing":                    isKabaneroLandingReady,
+		"appsody":                    isAppsodyReady,
+		"kappnav":                    isKubernetesAppNavigatorReady,
+		"codereadyWorkspaces":        isCRWReady,
+		"events":                     isEventsReady,
+		"admissionControllerWebhook": isAdmissionControllerWebhookReady,
+		"sso":                        isSsoReady,
+		"gitops":                     isGitopsReady,
+		"triggers":                   isTriggersReady,
+		"targetNamespaces":           isTargetNamespacesReady,
+	})
+
 	// Update the kabanero instance status in a retriable manner. The instance may have changed.
 	err := timer.Retry(10, 100*time.Millisecond, func() (bool, error) {
 		err := c.Status().Update(ctx, k)
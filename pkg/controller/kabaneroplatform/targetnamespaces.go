@@ -1,228 +1,614 @@
-package kabaneroplatform
-
-import (
-	"context"
-	"errors"
-	"fmt"
-	"strings"
-
-	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
-
-	"github.com/go-logr/logr"
-
-	rbacv1 "k8s.io/api/rbac/v1"
-	kerrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/sets"
-	"sigs.k8s.io/controller-runtime/pkg/client"
-)
-
-type targetNamespaceRoleBindingTemplate struct {
-	name            string
-	saName          string
-	saNamespace     string
-	clusterRoleName string
-}
-
-func (info targetNamespaceRoleBindingTemplate) generate(targetNamespace string) rbacv1.RoleBinding {
-	return rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      info.name,
-			Namespace: targetNamespace,
-		},
-		Subjects: []rbacv1.Subject{
-			rbacv1.Subject{
-				Kind:      "ServiceAccount",
-				Name:      info.saName,
-				Namespace: info.saNamespace,
-			},
-		},
-		RoleRef: rbacv1.RoleRef{
-			Kind:     "ClusterRole",
-			Name:     info.clusterRoleName,
-			APIGroup: "rbac.authorization.k8s.io",
-		},
-	}
-}
-
-// We're going to target the current namespace, and the list of target
-// namespaces from the Kabanero CR instance.
-func getTargetNamespaces(targetNamespaces []string, defaultNamespace string) []string {
-	targetnamespaceList := targetNamespaces
-
-	// If targetNamespaces is empty, default to binding to kabanero
-	if len(targetnamespaceList) == 0 {
-		targetnamespaceList = append(targetnamespaceList, defaultNamespace)
-	}
-
-	return targetnamespaceList
-}
-
-// Create the binding templates
-func createBindingTemplates(saNamespace string) []targetNamespaceRoleBindingTemplate {
-	return []targetNamespaceRoleBindingTemplate{
-		{
-			name:            "kabanero-pipeline-deploy-rolebinding",
-			saName:          "kabanero-pipeline",
-			saNamespace:     saNamespace,
-			clusterRoleName: "kabanero-pipeline-deploy-role",
-		},
-		{
-			name:            "kabanero-cli-deploy-rolebinding",
-			saName:          "kabanero-cli",
-			saNamespace:     saNamespace,
-			clusterRoleName: "kabanero-cli-service-deployments-role",
-		},
-	}
-}
-
-func reconcileTargetNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client, reqLogger logr.Logger) error {
-
-	// Owner reference for same-namespace bindings
-	ownerIsController := true
-	ownerReference := metav1.OwnerReference{
-		APIVersion: k.TypeMeta.APIVersion,
-		Kind:       k.TypeMeta.Kind,
-		Name:       k.ObjectMeta.Name,
-		UID:        k.ObjectMeta.UID,
-		Controller: &ownerIsController,
-	}
-
-	// Be sure each requested namespace exists.  This will catch namespaces added to the list, as well as
-	// namespaces that were deleted but not removed from the targetNamespaces list.
-	specTargetNamespaces := sets.NewString(getTargetNamespaces(k.Spec.TargetNamespaces, k.GetNamespace())...)
-	var errorNamespaces []string
-	for namespace, _ := range specTargetNamespaces {
-		exists, err := namespaceExists(ctx, namespace, cl)
-		if err != nil {
-			reqLogger.Error(err, fmt.Sprintf("Could not check status of namespace %v", namespace))
-			errorNamespaces = append(errorNamespaces, namespace)
-		}
-		if exists == false {
-			reqLogger.Error(nil, fmt.Sprintf("Target namespace %v does not exist", namespace))
-			errorNamespaces = append(errorNamespaces, namespace)
-		}
-	}
-
-	for _, namespace := range errorNamespaces {
-		delete(specTargetNamespaces, namespace)
-	}
-
-	// TODO: did I do this right?  need to process the namespaces, then look at errorNamespaces and
-	//       generate an error message for namespaces that did not exist.  Once we have a watch set
-	//       up, that should take care of partially active lists, and the delete case.
-
-	// Compute the new, deleted, and common namespace names
-	statusTargetNamespaces := sets.NewString(getTargetNamespaces(k.Status.TargetNamespaces.Namespaces, k.GetNamespace())...)
-	oldNamespaces := statusTargetNamespaces.Difference(specTargetNamespaces)
-	newNamespaces := specTargetNamespaces.Difference(statusTargetNamespaces)
-	unchangedNamespaces := specTargetNamespaces.Intersection(statusTargetNamespaces)
-
-	// Create the templates
-	bindingTemplates := createBindingTemplates(k.GetNamespace())
-
-	// For removed namespaces, delete the role bindings
-	for namespace, _ := range oldNamespaces {
-		for _, bindingTemplate := range bindingTemplates {
-			template := bindingTemplate.generate(namespace)
-			reqLogger.Info(fmt.Sprintf("Deleting RoleBinding %v for removed target namespace %v", template.GetName(), template.GetNamespace()))
-			cl.Delete(ctx, &template)
-		}
-	}
-
-	// For new namespaces, create the role bindings
-	for namespace, _ := range newNamespaces {
-		for _, bindingTemplate := range bindingTemplates {
-			template := bindingTemplate.generate(namespace)
-			if k.GetNamespace() == namespace {
-				template.ObjectMeta.OwnerReferences = []metav1.OwnerReference{ownerReference}
-			}
-			reqLogger.Info(fmt.Sprintf("Creating RoleBinding %v for added target namespace %v", template.GetName(), template.GetNamespace()))
-			cl.Create(ctx, &template)
-		}
-	}
-
-	// For unchanged namespaces, validate the role bindings
-	for namespace, _ := range unchangedNamespaces {
-		for _, bindingTemplate := range bindingTemplates {
-			template := bindingTemplate.generate(namespace)
-			if k.GetNamespace() == namespace {
-				template.ObjectMeta.OwnerReferences = []metav1.OwnerReference{ownerReference}
-			}
-			reqLogger.Info(fmt.Sprintf("Updating RoleBinding %v for unchanged target namespace %v", template.GetName(), template.GetNamespace()))
-			cl.Update(ctx, &template)
-		}
-	}
-
-	// Update the Status to reflect the new target namespaces.
-	k.Status.TargetNamespaces.Namespaces = nil
-	for _, namespace := range k.Spec.TargetNamespaces {
-		isErrorNamespace := false
-		for _, errorNamespace := range errorNamespaces {
-			if errorNamespace == namespace {
-				isErrorNamespace = true
-				break
-			}
-		}
-		if isErrorNamespace == false {
-			k.Status.TargetNamespaces.Namespaces = append(k.Status.TargetNamespaces.Namespaces, namespace)
-		}
-	}
-
-	if len(errorNamespaces) == 0 {
-		k.Status.TargetNamespaces.Ready = "True"
-		k.Status.TargetNamespaces.Message = ""
-	} else {
-		k.Status.TargetNamespaces.Ready = "False"
-		k.Status.TargetNamespaces.Message = fmt.Sprintf("The following namespaces could not be processed: %v", strings.Join(errorNamespaces, ","))
-		return errors.New(k.Status.TargetNamespaces.Message)
-	}
-
-	return nil
-}
-
-// Checks if a namespace exists.  If an unknown error occurs, return that too.
-func namespaceExists(ctx context.Context, inNamespace string, cl client.Client) (bool, error) {
-	namespace := &unstructured.Unstructured{}
-	namespace.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "",
-		Kind:    "Namespace",
-		Version: "v1",
-	})
-	err := cl.Get(ctx, client.ObjectKey{Namespace: inNamespace, Name: inNamespace}, namespace)
-	if err == nil {
-		return true, nil
-	}
-
-	if kerrors.IsNotFound(err) {
-		return false, nil
-	}
-
-	return false, err
-}
-
-// Returns the readiness status of the target namespaces.  Presently the status
-// is determined as the namespaces are activated.  We are just reporting that
-// status here.
-func getTargetNamespacesStatus(k *kabanerov1alpha2.Kabanero) (bool, error) {
-	return k.Status.TargetNamespaces.Ready == "True", nil
-}
-
-// Clean up the cross-namespace bindings that we created (deleting the
-// Kabanero CR instance won't delete these because cross-namespace owner
-// references are not allowed by Kubernetes).
-func cleanupTargetNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client) error {
-	// Create the templates
-	bindingTemplates := createBindingTemplates(k.GetNamespace())
-
-	for _, namespace := range getTargetNamespaces(k.Status.TargetNamespaces.Namespaces, k.GetNamespace()) {
-		for _, bindingTemplate := range bindingTemplates {
-			template := bindingTemplate.generate(namespace)
-			cl.Delete(ctx, &template)
-		}
-	}
-
-	return nil
-}
+package kabaneroplatform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type targetNamespaceRoleBindingTemplate struct {
+	name        string
+	scope       string
+	saName      string
+	saNamespace string
+	roleKind    string
+	roleName    string
+}
+
+func (info targetNamespaceRoleBindingTemplate) generate(targetNamespace string) rbacv1.RoleBinding {
+	return rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      info.name,
+			Namespace: targetNamespace,
+		},
+		Subjects: []rbacv1.Subject{
+			rbacv1.Subject{
+				Kind:      "ServiceAccount",
+				Name:      info.saName,
+				Namespace: info.saNamespace,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			Kind:     info.roleKind,
+			Name:     info.roleName,
+			APIGroup: "rbac.authorization.k8s.io",
+		},
+	}
+}
+
+// We're going to target the current namespace, and the list of target
+// namespaces from the Kabanero CR instance, followed by the namespaces
+// selected by the target namespace selector.
+func getTargetNamespaces(targetNamespaces []string, selectedNamespaces []string, defaultNamespace string) []string {
+	targetnamespaceList := append([]string{}, targetNamespaces...)
+
+	// If targetNamespaces is empty, default to binding to kabanero.  The selected
+	// namespaces do not replace the default.
+	if len(targetnamespaceList) == 0 {
+		targetnamespaceList = append(targetnamespaceList, defaultNamespace)
+	}
+
+	return append(targetnamespaceList, selectedNamespaces...)
+}
+
+// Returns the target namespaces recorded in the status of the Kabanero CR
+// instance.  The status lists the targetNamespaces followed by the input
+// selected namespaces, so the namespaces that were not selected tell whether
+// the default namespace was bound.
+func getStatusTargetNamespaces(k *kabanerov1alpha2.Kabanero, selectedNamespaces []string) []string {
+	selected := sets.NewString(selectedNamespaces...)
+	var listed, recorded []string
+	for _, namespace := range k.Status.TargetNamespaces.Namespaces {
+		if selected.Has(namespace) {
+			recorded = append(recorded, namespace)
+		} else {
+			listed = append(listed, namespace)
+		}
+	}
+
+	return getTargetNamespaces(listed, recorded, k.GetNamespace())
+}
+
+// Create the binding templates
+func createBindingTemplates(saNamespace string) []targetNamespaceRoleBindingTemplate {
+	return []targetNamespaceRoleBindingTemplate{
+		{
+			name:        "kabanero-pipeline-deploy-rolebinding",
+			scope:       kabanerov1alpha2.RoleBindingScopePipelines,
+			saName:      "kabanero-pipeline",
+			saNamespace: saNamespace,
+			roleKind:    "ClusterRole",
+			roleName:    "kabanero-pipeline-deploy-role",
+		},
+		{
+			name:        "kabanero-cli-deploy-rolebinding",
+			scope:       kabanerov1alpha2.RoleBindingScopeCli,
+			saName:      "kabanero-cli",
+			saNamespace: saNamespace,
+			roleKind:    "ClusterRole",
+			roleName:    "kabanero-cli-service-deployments-role",
+		},
+	}
+}
+
+// Returns the templates of the role bindings requested for the target namespaces: the default bindings of
+// each scope that was not replaced, followed by the bindings listed in the Kabanero instance.
+func getBindingTemplates(k *kabanerov1alpha2.Kabanero) ([]targetNamespaceRoleBindingTemplate, error) {
+	replacedScopes := sets.NewString()
+	reservedNames := sets.NewString()
+	for _, template := range createActivationBindingTemplates(k.GetNamespace()) {
+		reservedNames.Insert(template.name)
+	}
+
+	var customTemplates []targetNamespaceRoleBindingTemplate
+	for _, binding := range k.Spec.TargetNamespaceRoleBindings {
+		switch binding.Scope {
+		case kabanerov1alpha2.RoleBindingScopePipelines, kabanerov1alpha2.RoleBindingScopeEvents, kabanerov1alpha2.RoleBindingScopeCli:
+		default:
+			return nil, fmt.Errorf("The scope of target namespace role binding %v must be one of %v, %v or %v", binding.Name, kabanerov1alpha2.RoleBindingScopePipelines, kabanerov1alpha2.RoleBindingScopeEvents, kabanerov1alpha2.RoleBindingScopeCli)
+		}
+
+		template := targetNamespaceRoleBindingTemplate{
+			name:        binding.Name,
+			scope:       binding.Scope,
+			saName:      binding.ServiceAccountName,
+			saNamespace: binding.ServiceAccountNamespace,
+			roleKind:    binding.RoleKind,
+			roleName:    binding.RoleName,
+		}
+		if len(template.saNamespace) == 0 {
+			template.saNamespace = k.GetNamespace()
+		}
+		if len(template.roleKind) == 0 {
+			template.roleKind = "ClusterRole"
+		}
+
+		if len(template.name) == 0 || len(template.saName) == 0 || len(template.roleName) == 0 {
+			return nil, fmt.Errorf("Target namespace role binding %v must specify a name, a service account and a role", binding.Name)
+		}
+		if template.roleKind != "Role" && template.roleKind != "ClusterRole" {
+			return nil, fmt.Errorf("The role kind of target namespace role binding %v must be Role or ClusterRole", binding.Name)
+		}
+		if reservedNames.Has(template.name) {
+			return nil, fmt.Errorf("Target namespace role binding %v is declared more than once, or uses a reserved name", binding.Name)
+		}
+		reservedNames.Insert(template.name)
+
+		if binding.ReplacesDefault {
+			replacedScopes.Insert(binding.Scope)
+		}
+		customTemplates = append(customTemplates, template)
+	}
+
+	var templates []targetNamespaceRoleBindingTemplate
+	for _, template := range createBindingTemplates(k.GetNamespace()) {
+		if replacedScopes.Has(template.scope) {
+			continue
+		}
+		if reservedNames.Has(template.name) {
+			return nil, fmt.Errorf("Target namespace role binding %v must replace the default binding of its scope to reuse its name", template.name)
+		}
+		templates = append(templates, template)
+	}
+
+	return append(templates, customTemplates...), nil
+}
+
+// Returns the templates of the role bindings that were applied to the target namespaces, but are no longer
+// requested.  Only the names of these templates are set, which is enough to delete them.
+func getRemovedBindingTemplates(k *kabanerov1alpha2.Kabanero, templates []targetNamespaceRoleBindingTemplate) []targetNamespaceRoleBindingTemplate {
+	// Before the names were recorded in the status, only the default bindings were applied.
+	appliedNames := k.Status.TargetNamespaces.RoleBindings
+	if appliedNames == nil {
+		for _, template := range createBindingTemplates(k.GetNamespace()) {
+			appliedNames = append(appliedNames, template.name)
+		}
+	}
+
+	requestedNames := sets.NewString()
+	for _, template := range templates {
+		requestedNames.Insert(template.name)
+	}
+
+	var removed []targetNamespaceRoleBindingTemplate
+	for _, name := range appliedNames {
+		if !requestedNames.Has(name) {
+			removed = append(removed, targetNamespaceRoleBindingTemplate{name: name})
+		}
+	}
+	return removed
+}
+
+// Updates a role binding, creating it if it does not exist.  The role of an existing binding cannot be
+// changed, so the binding is recreated when the update is rejected.
+func applyRoleBinding(ctx context.Context, cl client.Client, binding *rbacv1.RoleBinding) error {
+	err := cl.Update(ctx, binding)
+	if kerrors.IsInvalid(err) {
+		cl.Delete(ctx, binding)
+		return cl.Create(ctx, binding)
+	}
+	if kerrors.IsNotFound(err) {
+		return cl.Create(ctx, binding)
+	}
+	return err
+}
+
+// Create the templates of the bindings that let the stack controller and the operator create the pipelines and
+// triggers activated in a target namespace.
+func createActivationBindingTemplates(saNamespace string) []targetNamespaceRoleBindingTemplate {
+	return []targetNamespaceRoleBindingTemplate{
+		{
+			name:        "kabanero-stack-controller-activation-rolebinding",
+			scope:       kabanerov1alpha2.RoleBindingScopePipelines,
+			saName:      "kabanero-operator-stack-controller",
+			saNamespace: saNamespace,
+			roleKind:    "ClusterRole",
+			roleName:    "kabanero-pipeline-activation-role",
+		},
+		{
+			name:        "kabanero-operator-activation-rolebinding",
+			scope:       kabanerov1alpha2.RoleBindingScopePipelines,
+			saName:      "kabanero-operator",
+			saNamespace: saNamespace,
+			roleKind:    "ClusterRole",
+			roleName:    "kabanero-pipeline-activation-role",
+		},
+	}
+}
+
+// Returns the namespaces, other than the Kabanero namespace, holding the pipelines of the stacks and the triggers
+// activated by the Kabanero instance.
+func activatedAssetNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client) (sets.String, error) {
+	namespaces := sets.NewString()
+	addAssets := func(pipelines []kabanerov1alpha2.PipelineStatus) {
+		for _, pipeline := range pipelines {
+			for _, asset := range pipeline.ActiveAssets {
+				if len(asset.Namespace) != 0 && asset.Namespace != k.GetNamespace() {
+					namespaces.Insert(asset.Namespace)
+				}
+			}
+		}
+	}
+
+	stacks := &kabanerov1alpha2.StackList{}
+	err := cl.List(ctx, stacks, client.InNamespace(k.GetNamespace()))
+	if err != nil {
+		return nil, err
+	}
+	for _, stack := range stacks.Items {
+		for _, version := range stack.Status.Versions {
+			addAssets(version.Pipelines)
+		}
+	}
+	addAssets(k.Status.Triggers.Triggers)
+
+	return namespaces, nil
+}
+
+// Returns the canary namespaces of the stack versions being rolled out in the Kabanero namespace.  The pipelines
+// of these versions are only activated in their canary namespaces, which need the activation bindings.
+func canaryNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client) (sets.String, error) {
+	namespaces := sets.NewString()
+	stacks := &kabanerov1alpha2.StackList{}
+	err := cl.List(ctx, stacks, client.InNamespace(k.GetNamespace()))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stack := range stacks.Items {
+		for _, version := range stack.Spec.Versions {
+			if !strings.EqualFold(version.DesiredState, kabanerov1alpha2.StackDesiredStateCanary) {
+				continue
+			}
+
+			// Once the rollout completed, the version is no longer limited to its canary namespaces.
+			completed := false
+			for _, versionStatus := range stack.Status.Versions {
+				if versionStatus.Version == version.Version && versionStatus.Canary != nil && versionStatus.Canary.Phase != kabanerov1alpha2.CanaryPhaseProgressing {
+					completed = true
+				}
+			}
+			if !completed {
+				namespaces.Insert(version.Canary.Namespaces...)
+			}
+		}
+	}
+	namespaces.Delete(k.GetNamespace())
+
+	return namespaces, nil
+}
+
+// Returns true if the parts of the stack status that the target namespaces depend on changed: the canary phases
+// of the versions, and the namespaces of their active assets.
+func stackNamespacesChanged(old *kabanerov1alpha2.Stack, new *kabanerov1alpha2.Stack) bool {
+	oldPhases, oldNamespaces := stackNamespaceStatus(old)
+	newPhases, newNamespaces := stackNamespaceStatus(new)
+	return !reflect.DeepEqual(oldPhases, newPhases) || !oldNamespaces.Equal(newNamespaces)
+}
+
+func stackNamespaceStatus(stack *kabanerov1alpha2.Stack) (map[string]string, sets.String) {
+	phases := make(map[string]string)
+	namespaces := sets.NewString()
+	for _, version := range stack.Status.Versions {
+		if version.Canary != nil {
+			phases[version.Version] = version.Canary.Phase
+		}
+		for _, pipeline := range version.Pipelines {
+			for _, asset := range pipeline.ActiveAssets {
+				namespaces.Insert(asset.Namespace)
+			}
+		}
+	}
+	return phases, namespaces
+}
+
+// Returns the names of the namespaces matching the target namespace selector of the Kabanero instance.  Namespaces
+// that are being deleted are not selected.
+func selectTargetNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client) ([]string, error) {
+	if k.Spec.TargetNamespaceSelector == nil {
+		return nil, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(k.Spec.TargetNamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("The target namespace selector is not valid: %v", err)
+	}
+
+	// An empty selector would match every namespace in the cluster.
+	if selector.Empty() {
+		return nil, nil
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	err = cl.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, namespace := range namespaces.Items {
+		if namespace.Status.Phase != corev1.NamespaceTerminating {
+			selected = append(selected, namespace.GetName())
+		}
+	}
+	sort.Strings(selected)
+
+	return selected, nil
+}
+
+func reconcileTargetNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client, reqLogger logr.Logger) error {
+
+	// Owner reference for same-namespace bindings
+	ownerIsController := true
+	ownerReference := metav1.OwnerReference{
+		APIVersion: k.TypeMeta.APIVersion,
+		Kind:       k.TypeMeta.Kind,
+		Name:       k.ObjectMeta.Name,
+		UID:        k.ObjectMeta.UID,
+		Controller: &ownerIsController,
+	}
+
+	// Find the namespaces matching the target namespace selector.  These are targeted along with the
+	// namespaces in the targetNamespaces list.
+	selectedNamespaces, err := selectTargetNamespaces(ctx, k, cl)
+	if err != nil {
+		k.Status.TargetNamespaces.Ready = "False"
+		k.Status.TargetNamespaces.Message = err.Error()
+		return err
+	}
+	previousSelectedNamespaces := k.Status.TargetNamespaces.Selected
+	k.Status.TargetNamespaces.Selected = selectedNamespaces
+
+	// Be sure each requested namespace exists.  This will catch namespaces added to the list, as well as
+	// namespaces that were deleted but not removed from the targetNamespaces list.
+	specTargetNamespaces := sets.NewString(getTargetNamespaces(k.Spec.TargetNamespaces, selectedNamespaces, k.GetNamespace())...)
+	var errorNamespaces []string
+	for namespace, _ := range specTargetNamespaces {
+		exists, err := namespaceExists(ctx, namespace, cl)
+		if err != nil {
+			reqLogger.Error(err, fmt.Sprintf("Could not check status of namespace %v", namespace))
+			errorNamespaces = append(errorNamespaces, namespace)
+		}
+		if exists == false {
+			reqLogger.Error(nil, fmt.Sprintf("Target namespace %v does not exist", namespace))
+			errorNamespaces = append(errorNamespaces, namespace)
+		}
+	}
+
+	for _, namespace := range errorNamespaces {
+		delete(specTargetNamespaces, namespace)
+	}
+
+	// TODO: did I do this right?  need to process the namespaces, then look at errorNamespaces and
+	//       generate an error message for namespaces that did not exist.  Once we have a watch set
+	//       up, that should take care of partially active lists, and the delete case.
+
+	// Compute the new, deleted, and common namespace names
+	statusTargetNamespaces := sets.NewString(getStatusTargetNamespaces(k, previousSelectedNamespaces)...)
+	oldNamespaces := statusTargetNamespaces.Difference(specTargetNamespaces)
+	newNamespaces := specTargetNamespaces.Difference(statusTargetNamespaces)
+	unchangedNamespaces := specTargetNamespaces.Intersection(statusTargetNamespaces)
+
+	// Create the templates.  The bindings that were applied, but are no longer requested, are removed from
+	// every namespace.
+	bindingTemplates, err := getBindingTemplates(k)
+	if err != nil {
+		k.Status.TargetNamespaces.Ready = "False"
+		k.Status.TargetNamespaces.Message = err.Error()
+		return err
+	}
+	removedTemplates := getRemovedBindingTemplates(k, bindingTemplates)
+
+	// The activation bindings are kept in the namespaces that still hold activated pipelines or triggers, so
+	// that the controllers can remove them.
+	activationTemplates := createActivationBindingTemplates(k.GetNamespace())
+	assetNamespaces, err := activatedAssetNamespaces(ctx, k, cl)
+	if err != nil {
+		return err
+	}
+
+	// The activation bindings are created in the target namespaces when activation in the target namespaces
+	// was requested, and in the canary namespaces of the stack versions being rolled out.
+	canaries, err := canaryNamespaces(ctx, k, cl)
+	if err != nil {
+		return err
+	}
+	activationRequested := func(namespace string) bool {
+		return namespace != k.GetNamespace() && (k.Spec.ActivateInTargetNamespaces || canaries.Has(namespace))
+	}
+
+	// For removed namespaces, delete the role bindings
+	var drainingNamespaces []string
+	for namespace, _ := range oldNamespaces {
+		for _, bindingTemplate := range append(removedTemplates, bindingTemplates...) {
+			template := bindingTemplate.generate(namespace)
+			reqLogger.Info(fmt.Sprintf("Deleting RoleBinding %v for removed target namespace %v", template.GetName(), template.GetNamespace()))
+			cl.Delete(ctx, &template)
+		}
+
+		if assetNamespaces.Has(namespace) {
+			reqLogger.Info(fmt.Sprintf("Waiting for the assets activated in removed target namespace %v to be deleted", namespace))
+			drainingNamespaces = append(drainingNamespaces, namespace)
+			continue
+		}
+		for _, bindingTemplate := range activationTemplates {
+			template := bindingTemplate.generate(namespace)
+			cl.Delete(ctx, &template)
+		}
+	}
+
+	// For new namespaces, create the role bindings
+	for namespace, _ := range newNamespaces {
+		for _, bindingTemplate := range bindingTemplates {
+			template := bindingTemplate.generate(namespace)
+			if k.GetNamespace() == namespace {
+				template.ObjectMeta.OwnerReferences = []metav1.OwnerReference{ownerReference}
+			}
+			reqLogger.Info(fmt.Sprintf("Creating RoleBinding %v for added target namespace %v", template.GetName(), template.GetNamespace()))
+			cl.Create(ctx, &template)
+		}
+
+		if activationRequested(namespace) {
+			for _, bindingTemplate := range activationTemplates {
+				template := bindingTemplate.generate(namespace)
+				reqLogger.Info(fmt.Sprintf("Creating RoleBinding %v for added target namespace %v", template.GetName(), template.GetNamespace()))
+				cl.Create(ctx, &template)
+			}
+		}
+	}
+
+	// For unchanged namespaces, validate the role bindings
+	for namespace, _ := range unchangedNamespaces {
+		for _, bindingTemplate := range bindingTemplates {
+			template := bindingTemplate.generate(namespace)
+			if k.GetNamespace() == namespace {
+				template.ObjectMeta.OwnerReferences = []metav1.OwnerReference{ownerReference}
+			}
+			reqLogger.Info(fmt.Sprintf("Updating RoleBinding %v for unchanged target namespace %v", template.GetName(), template.GetNamespace()))
+			applyRoleBinding(ctx, cl, &template)
+		}
+
+		for _, bindingTemplate := range removedTemplates {
+			template := bindingTemplate.generate(namespace)
+			reqLogger.Info(fmt.Sprintf("Deleting removed RoleBinding %v for unchanged target namespace %v", template.GetName(), template.GetNamespace()))
+			cl.Delete(ctx, &template)
+		}
+
+		// Activation in the target namespaces may have been turned on or off since the namespace was added.
+		for _, bindingTemplate := range activationTemplates {
+			template := bindingTemplate.generate(namespace)
+			if activationRequested(namespace) {
+				err := cl.Update(ctx, &template)
+				if kerrors.IsNotFound(err) {
+					reqLogger.Info(fmt.Sprintf("Creating RoleBinding %v for unchanged target namespace %v", template.GetName(), template.GetNamespace()))
+					cl.Create(ctx, &template)
+				}
+			} else if !assetNamespaces.Has(namespace) {
+				cl.Delete(ctx, &template)
+			}
+		}
+	}
+
+	// Update the Status to reflect the applied role bindings and the new target namespaces.
+	k.Status.TargetNamespaces.RoleBindings = []string{}
+	for _, bindingTemplate := range bindingTemplates {
+		k.Status.TargetNamespaces.RoleBindings = append(k.Status.TargetNamespaces.RoleBindings, bindingTemplate.name)
+	}
+
+	k.Status.TargetNamespaces.Namespaces = nil
+	for _, namespace := range k.GetTargetNamespaces() {
+		isErrorNamespace := false
+		for _, errorNamespace := range errorNamespaces {
+			if errorNamespace == namespace {
+				isErrorNamespace = true
+				break
+			}
+		}
+		if isErrorNamespace == false {
+			k.Status.TargetNamespaces.Namespaces = append(k.Status.TargetNamespaces.Namespaces, namespace)
+		}
+	}
+
+	// The removed namespaces still holding activated assets are kept in the status, so they are processed again.
+	k.Status.TargetNamespaces.Namespaces = append(k.Status.TargetNamespaces.Namespaces, drainingNamespaces...)
+
+	if len(errorNamespaces) == 0 && len(drainingNamespaces) != 0 {
+		k.Status.TargetNamespaces.Ready = "False"
+		k.Status.TargetNamespaces.Message = fmt.Sprintf("Waiting for the pipelines and triggers activated in the following namespaces to be removed: %v", strings.Join(drainingNamespaces, ","))
+	} else if len(errorNamespaces) == 0 {
+		k.Status.TargetNamespaces.Ready = "True"
+		k.Status.TargetNamespaces.Message = ""
+	} else {
+		k.Status.TargetNamespaces.Ready = "False"
+		k.Status.TargetNamespaces.Message = fmt.Sprintf("The following namespaces could not be processed: %v", strings.Join(errorNamespaces, ","))
+		return errors.New(k.Status.TargetNamespaces.Message)
+	}
+
+	return nil
+}
+
+// Checks if a namespace exists.  If an unknown error occurs, return that too.
+func namespaceExists(ctx context.Context, inNamespace string, cl client.Client) (bool, error) {
+	namespace := &unstructured.Unstructured{}
+	namespace.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "",
+		Kind:    "Namespace",
+		Version: "v1",
+	})
+	err := cl.Get(ctx, client.ObjectKey{Namespace: inNamespace, Name: inNamespace}, namespace)
+	if err == nil {
+		return true, nil
+	}
+
+	if kerrors.IsNotFound(err) {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// Returns the readiness status of the target namespaces.  Presently the status
+// is determined as the namespaces are activated.  We are just reporting that
+// status here.
+func getTargetNamespacesStatus(k *kabanerov1alpha2.Kabanero) (bool, error) {
+	return k.Status.TargetNamespaces.Ready == "True", nil
+}
+
+// Clean up the cross-namespace bindings that we created (deleting the
+// Kabanero CR instance won't delete these because cross-namespace owner
+// references are not allowed by Kubernetes).  The activation bindings are
+// kept in the namespaces that still hold activated pipelines or triggers,
+// so that the controllers can remove them, and the deletion is retried.
+func cleanupTargetNamespaces(ctx context.Context, k *kabanerov1alpha2.Kabanero, cl client.Client) error {
+	// Create the templates.  If the requested bindings are not valid, fall back to the defaults.
+	bindingTemplates, err := getBindingTemplates(k)
+	if err != nil {
+		bindingTemplates = createBindingTemplates(k.GetNamespace())
+	}
+	bindingTemplates = append(bindingTemplates, getRemovedBindingTemplates(k, bindingTemplates)...)
+	activationTemplates := createActivationBindingTemplates(k.GetNamespace())
+
+	assetNamespaces, err := activatedAssetNamespaces(ctx, k, cl)
+	if err != nil {
+		return err
+	}
+
+	var drainingNamespaces []string
+	for _, namespace := range getStatusTargetNamespaces(k, k.Status.TargetNamespaces.Selected) {
+		for _, bindingTemplate := range bindingTemplates {
+			template := bindingTemplate.generate(namespace)
+			cl.Delete(ctx, &template)
+		}
+
+		if assetNamespaces.Has(namespace) {
+			drainingNamespaces = append(drainingNamespaces, namespace)
+			continue
+		}
+		for _, bindingTemplate := range activationTemplates {
+			template := bindingTemplate.generate(namespace)
+			cl.Delete(ctx, &template)
+		}
+	}
+
+	if len(drainingNamespaces) != 0 {
+		return fmt.Errorf("Deletion blocked waiting for the pipelines and triggers activated in the following namespaces to be removed: %v", strings.Join(drainingNamespaces, ","))
+	}
+
+	return nil
+}
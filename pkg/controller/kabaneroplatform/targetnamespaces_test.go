@@ -7,12 +7,15 @@ import (
 
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"testing"
@@ -345,3 +348,424 @@ func TestCleanupTargetNamespaces(t *testing.T) {
 		t.Fatal(fmt.Sprintf("There were %v bindings left in the map after cleanup: %#v", len(existingRoleBindings), existingRoleBindings))
 	}
 }
+
+// Test that the finalizer keeps the activation bindings of the namespaces that still hold activated triggers.
+func TestCleanupTargetNamespacesActivatedAssets(t *testing.T) {
+	k := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaces:           []string{"fred", "wilma"},
+			ActivateInTargetNamespaces: true,
+		},
+		Status: kabanerov1alpha2.KabaneroStatus{
+			TargetNamespaces: kabanerov1alpha2.TargetNamespaceStatus{Namespaces: []string{"fred", "wilma"}, Ready: "True"},
+			Triggers: kabanerov1alpha2.TriggersStatus{Triggers: []kabanerov1alpha2.PipelineStatus{{
+				ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{{Name: "listener", Namespace: "fred", Kind: "EventListener", NamespaceCopy: true}},
+			}}},
+		},
+	}
+
+	existingRoleBindings := make(map[client.ObjectKey]bool)
+	for _, namespace := range []string{"fred", "wilma"} {
+		for _, name := range []string{"kabanero-pipeline-deploy-rolebinding", "kabanero-cli-deploy-rolebinding", "kabanero-operator-activation-rolebinding", "kabanero-stack-controller-activation-rolebinding"} {
+			existingRoleBindings[client.ObjectKey{Name: name, Namespace: namespace}] = true
+		}
+	}
+	cl := targetnamespaceTestClient{existingRoleBindings, map[string]bool{"fred": true, "wilma": true}}
+
+	err := cleanupTargetNamespaces(context.TODO(), &k, cl)
+	if err == nil {
+		t.Fatal("The deletion should be blocked until the triggers activated in namespace fred are removed")
+	}
+
+	if len(existingRoleBindings) != 2 || !existingRoleBindings[client.ObjectKey{Name: "kabanero-operator-activation-rolebinding", Namespace: "fred"}] {
+		t.Fatalf("Only the activation bindings of namespace fred should be left: %v", existingRoleBindings)
+	}
+
+	// Once the triggers are removed, the activation bindings are deleted.
+	k.Status.Triggers.Triggers = nil
+	err = cleanupTargetNamespaces(context.TODO(), &k, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existingRoleBindings) != 0 {
+		t.Fatalf("There were %v bindings left in the map after cleanup: %v", len(existingRoleBindings), existingRoleBindings)
+	}
+}
+
+// Unit test Kube client that also lists the stacks in the Kabanero namespace.
+type stackListTestClient struct {
+	targetnamespaceTestClient
+	stacks []kabanerov1alpha2.Stack
+}
+
+func (c stackListTestClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if stackList, ok := list.(*kabanerov1alpha2.StackList); ok {
+		stackList.Items = c.stacks
+	}
+	return nil
+}
+
+// Apply the activation bindings to the canary namespaces of the stack versions being rolled out, and remove them
+// once the rollout completed.
+func TestReconcileTargetNamespacesCanary(t *testing.T) {
+	k := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaces: []string{"fred", "wilma"},
+		},
+	}
+
+	stack := kabanerov1alpha2.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.StackSpec{
+			Versions: []kabanerov1alpha2.StackVersion{{
+				Version:      "0.3.0",
+				DesiredState: kabanerov1alpha2.StackDesiredStateCanary,
+				Canary:       kabanerov1alpha2.StackCanary{Namespaces: []string{"wilma"}},
+			}},
+		},
+	}
+
+	existingRoleBindings := make(map[client.ObjectKey]bool)
+	cl := stackListTestClient{targetnamespaceTestClient{existingRoleBindings, map[string]bool{"fred": true, "wilma": true}}, []kabanerov1alpha2.Stack{stack}}
+
+	err := reconcileTargetNamespaces(context.TODO(), &k, cl, nslog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"kabanero-operator-activation-rolebinding", "kabanero-stack-controller-activation-rolebinding"} {
+		if !existingRoleBindings[client.ObjectKey{Name: name, Namespace: "wilma"}] || existingRoleBindings[client.ObjectKey{Name: name, Namespace: "fred"}] {
+			t.Fatalf("The activation bindings should only have been created in the canary namespace: %v", existingRoleBindings)
+		}
+	}
+
+	// Once the rollout completed, the activation bindings are removed.
+	cl.stacks[0].Status.Versions = []kabanerov1alpha2.StackVersionStatus{{
+		Version: "0.3.0",
+		Canary:  &kabanerov1alpha2.StackCanaryStatus{Phase: kabanerov1alpha2.CanaryPhasePromoted},
+	}}
+	err = reconcileTargetNamespaces(context.TODO(), &k, cl, nslog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(existingRoleBindings) != 4 || existingRoleBindings[client.ObjectKey{Name: "kabanero-operator-activation-rolebinding", Namespace: "wilma"}] {
+		t.Fatalf("The activation bindings should have been removed from the canary namespace: %v", existingRoleBindings)
+	}
+}
+
+// The Stack watch fires on the status changes that the target namespaces depend on.
+func TestStackWatchPredicate(t *testing.T) {
+	stack := kabanerov1alpha2.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero", Generation: 1},
+		Status: kabanerov1alpha2.StackStatus{
+			Versions: []kabanerov1alpha2.StackVersionStatus{{
+				Version: "0.3.0",
+				Canary:  &kabanerov1alpha2.StackCanaryStatus{Phase: kabanerov1alpha2.CanaryPhaseProgressing},
+				Pipelines: []kabanerov1alpha2.PipelineStatus{{
+					ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{{Name: "build-task", Namespace: "kabanero"}},
+				}},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		update   func(s *kabanerov1alpha2.Stack)
+		expected bool
+	}{
+		{name: "No change", update: func(s *kabanerov1alpha2.Stack) {}, expected: false},
+		{name: "Other status change", update: func(s *kabanerov1alpha2.Stack) { s.Status.Summary = "[ 0.3.0: active ]" }, expected: false},
+		{name: "Generation change", update: func(s *kabanerov1alpha2.Stack) { s.Generation = 2 }, expected: true},
+		{name: "Canary phase change", update: func(s *kabanerov1alpha2.Stack) {
+			s.Status.Versions[0].Canary.Phase = kabanerov1alpha2.CanaryPhasePromoted
+		}, expected: true},
+		{name: "Asset namespace change", update: func(s *kabanerov1alpha2.Stack) {
+			s.Status.Versions[0].Pipelines[0].ActiveAssets[0].Namespace = "wilma"
+		}, expected: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			newStack := stack.DeepCopy()
+			tc.update(newStack)
+			e := event.UpdateEvent{MetaOld: &stack, ObjectOld: &stack, MetaNew: newStack, ObjectNew: newStack}
+			if getStackWatchPredicateFunc().Update(e) != tc.expected {
+				t.Fatal(fmt.Sprintf("Expected the predicate to return %v", tc.expected))
+			}
+		})
+	}
+}
+
+// Unit test Kube client that also lists the namespaces it knows about, with their labels.
+type selectorTestClient struct {
+	targetnamespaceTestClient
+
+	// Labels of the namespaces that the client knows about
+	namespaceLabels map[string]map[string]string
+}
+
+func (c selectorTestClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	namespaceList, ok := list.(*corev1.NamespaceList)
+	if !ok {
+		return nil
+	}
+
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	for name, _ := range c.namespaces {
+		if listOptions.LabelSelector == nil || listOptions.LabelSelector.Matches(labels.Set(c.namespaceLabels[name])) {
+			namespace := corev1.Namespace{}
+			namespace.SetName(name)
+			namespaceList.Items = append(namespaceList.Items, namespace)
+		}
+	}
+	return nil
+}
+
+// Apply the role bindings to the namespaces matching the target namespace selector, and move them when the
+// namespace labels change.
+func TestReconcileTargetNamespaceSelector(t *testing.T) {
+	k := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaces:        []string{"fred"},
+			TargetNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kabanero.io/tenant": "true"}},
+		},
+	}
+
+	existingNamespaces := map[string]bool{"fred": true, "tenant-a": true, "tenant-b": true}
+	namespaceLabels := map[string]map[string]string{"tenant-a": {"kabanero.io/tenant": "true"}}
+	client := selectorTestClient{targetnamespaceTestClient{map[client.ObjectKey]bool{}, existingNamespaces}, namespaceLabels}
+
+	err := reconcileTargetNamespaces(context.TODO(), &k, client, nslog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(k.Status.TargetNamespaces.Selected) != 1 || k.Status.TargetNamespaces.Selected[0] != "tenant-a" {
+		t.Fatal(fmt.Sprintf("Kabanero status should have selected tenant-a, but selected %v", k.Status.TargetNamespaces.Selected))
+	}
+
+	if len(k.Status.TargetNamespaces.Namespaces) != 2 || k.Status.TargetNamespaces.Ready != "True" {
+		t.Fatal(fmt.Sprintf("Kabanero status should have 2 ready target namespaces: %v", k.Status.TargetNamespaces))
+	}
+
+	if len(client.objs) != 4 || !client.objs[clientKey("kabanero-pipeline-deploy-rolebinding", "tenant-a")] {
+		t.Fatal(fmt.Sprintf("Should have created RoleBindings in fred and tenant-a, but created %#v", client.objs))
+	}
+
+	// Move the label to the other namespace.
+	delete(namespaceLabels, "tenant-a")
+	namespaceLabels["tenant-b"] = map[string]string{"kabanero.io/tenant": "true"}
+
+	err = reconcileTargetNamespaces(context.TODO(), &k, client, nslog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(k.Status.TargetNamespaces.Selected) != 1 || k.Status.TargetNamespaces.Selected[0] != "tenant-b" {
+		t.Fatal(fmt.Sprintf("Kabanero status should have selected tenant-b, but selected %v", k.Status.TargetNamespaces.Selected))
+	}
+
+	for key, _ := range client.objs {
+		if key.Namespace == "tenant-a" {
+			t.Fatal(fmt.Sprintf("RoleBinding %v should have been deleted from tenant-a: %#v", key.Name, client.objs))
+		}
+	}
+
+	if len(client.objs) != 4 || !client.objs[clientKey("kabanero-cli-deploy-rolebinding", "tenant-b")] {
+		t.Fatal(fmt.Sprintf("Should have created RoleBindings in fred and tenant-b, but found %#v", client.objs))
+	}
+}
+
+// Make sure the Kabanero namespace is still targeted when the targetNamespaces list is empty and the target
+// namespace selector matches other namespaces.
+func TestReconcileTargetNamespaceSelectorDefault(t *testing.T) {
+	k := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kabanero.io/tenant": "true"}},
+		},
+	}
+
+	existingNamespaces := map[string]bool{"kabanero": true, "tenant-a": true, "tenant-b": true}
+	namespaceLabels := map[string]map[string]string{"tenant-a": {"kabanero.io/tenant": "true"}}
+	client := selectorTestClient{targetnamespaceTestClient{map[client.ObjectKey]bool{}, existingNamespaces}, namespaceLabels}
+
+	err := reconcileTargetNamespaces(context.TODO(), &k, client, nslog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 4 || !client.objs[clientKey("kabanero-pipeline-deploy-rolebinding", "kabanero")] || !client.objs[clientKey("kabanero-pipeline-deploy-rolebinding", "tenant-a")] {
+		t.Fatal(fmt.Sprintf("Should have created RoleBindings in kabanero and tenant-a, but created %#v", client.objs))
+	}
+
+	// Move the label to the other namespace.  The bindings in the Kabanero namespace are kept.
+	delete(namespaceLabels, "tenant-a")
+	namespaceLabels["tenant-b"] = map[string]string{"kabanero.io/tenant": "true"}
+
+	err = reconcileTargetNamespaces(context.TODO(), &k, client, nslog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 4 || !client.objs[clientKey("kabanero-cli-deploy-rolebinding", "kabanero")] || !client.objs[clientKey("kabanero-cli-deploy-rolebinding", "tenant-b")] {
+		t.Fatal(fmt.Sprintf("Should have kept RoleBindings in kabanero and created them in tenant-b, but found %#v", client.objs))
+	}
+
+	// The bindings are removed from the Kabanero namespace with the Kabanero instance.
+	err = cleanupTargetNamespaces(context.TODO(), &k, client)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 0 {
+		t.Fatal(fmt.Sprintf("The RoleBindings should have been deleted, but found %#v", client.objs))
+	}
+}
+
+// Make sure a namespace event is only mapped to the Kabanero instances that target the namespace.
+func TestIsTargetNamespaceCandidate(t *testing.T) {
+	k := kabanerov1alpha2.Kabanero{
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaces:        []string{"fred"},
+			TargetNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kabanero.io/tenant": "true"}},
+		},
+		Status: kabanerov1alpha2.KabaneroStatus{
+			TargetNamespaces: kabanerov1alpha2.TargetNamespaceStatus{Selected: []string{"tenant-a"}},
+		},
+	}
+
+	tests := []struct {
+		namespace metav1.ObjectMeta
+		expected  bool
+	}{
+		{metav1.ObjectMeta{Name: "fred"}, true},
+		{metav1.ObjectMeta{Name: "tenant-a"}, true},
+		{metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"kabanero.io/tenant": "true"}}, true},
+		{metav1.ObjectMeta{Name: "tenant-c", Labels: map[string]string{"kabanero.io/tenant": "false"}}, false},
+	}
+
+	for _, test := range tests {
+		if isTargetNamespaceCandidate(&k, &test.namespace) != test.expected {
+			t.Fatal(fmt.Sprintf("Namespace %v should be a candidate: %v", test.namespace.Name, test.expected))
+		}
+	}
+}
+
+// Replace a default role binding and add another one, then remove the added binding.
+func TestReconcileTargetNamespaceRoleBindings(t *testing.T) {
+	targetNamespace := "fred"
+	k := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaces: []string{targetNamespace},
+			TargetNamespaceRoleBindings: []kabanerov1alpha2.TargetNamespaceRoleBindingSpec{{
+				Name:               "tenant-pipeline-rolebinding",
+				Scope:              kabanerov1alpha2.RoleBindingScopePipelines,
+				ReplacesDefault:    true,
+				ServiceAccountName: "kabanero-pipeline",
+				RoleKind:           "Role",
+				RoleName:           "tenant-deployer",
+			}, {
+				Name:               "tenant-events-rolebinding",
+				Scope:              kabanerov1alpha2.RoleBindingScopeEvents,
+				ServiceAccountName: "events-operator",
+				RoleName:           "tenant-events-role",
+			}},
+		},
+		Status: kabanerov1alpha2.KabaneroStatus{
+			TargetNamespaces: kabanerov1alpha2.TargetNamespaceStatus{
+				Namespaces: []string{targetNamespace},
+				Ready:      "True",
+			},
+		},
+	}
+
+	// The default bindings were applied before the bindings were customized.
+	existingRoleBindings := map[client.ObjectKey]bool{
+		clientKey("kabanero-pipeline-deploy-rolebinding", targetNamespace): true,
+		clientKey("kabanero-cli-deploy-rolebinding", targetNamespace):      true,
+	}
+	client := targetnamespaceTestClient{existingRoleBindings, map[string]bool{targetNamespace: true}}
+
+	err := reconcileTargetNamespaces(context.TODO(), &k, client, nslog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	expected := []string{"kabanero-cli-deploy-rolebinding", "tenant-pipeline-rolebinding", "tenant-events-rolebinding"}
+	if len(client.objs) != len(expected) {
+		t.Fatal(fmt.Sprintf("Should have %v RoleBindings, but found %#v", len(expected), client.objs))
+	}
+	for i, name := range expected {
+		if !client.objs[clientKey(name, targetNamespace)] {
+			t.Fatal(fmt.Sprintf("RoleBinding %v was not created: %#v", name, client.objs))
+		}
+		if k.Status.TargetNamespaces.RoleBindings[i] != name {
+			t.Fatal(fmt.Sprintf("Kabanero status should list RoleBinding %v: %v", name, k.Status.TargetNamespaces.RoleBindings))
+		}
+	}
+
+	// Remove the events binding, and make sure it is deleted.
+	k.Spec.TargetNamespaceRoleBindings = k.Spec.TargetNamespaceRoleBindings[:1]
+	err = reconcileTargetNamespaces(context.TODO(), &k, client, nslog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 2 || client.objs[clientKey("tenant-events-rolebinding", targetNamespace)] {
+		t.Fatal(fmt.Sprintf("RoleBinding tenant-events-rolebinding should have been deleted: %#v", client.objs))
+	}
+}
+
+// Make sure the requested role bindings are validated.
+func TestGetBindingTemplates(t *testing.T) {
+	k := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			TargetNamespaceRoleBindings: []kabanerov1alpha2.TargetNamespaceRoleBindingSpec{{
+				Name:                    "tenant-cli-rolebinding",
+				Scope:                   kabanerov1alpha2.RoleBindingScopeCli,
+				ServiceAccountName:      "tenant-cli",
+				ServiceAccountNamespace: "tenant-tools",
+				RoleName:                "tenant-cli-role",
+			}},
+		},
+	}
+
+	templates, err := getBindingTemplates(&k)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(templates) != 3 {
+		t.Fatal(fmt.Sprintf("Should have 3 binding templates, but found %v", templates))
+	}
+
+	binding := templates[2].generate("fred")
+	if binding.RoleRef.Kind != "ClusterRole" || binding.RoleRef.Name != "tenant-cli-role" || binding.Subjects[0].Namespace != "tenant-tools" {
+		t.Fatal(fmt.Sprintf("Unexpected RoleBinding: %#v", binding))
+	}
+
+	invalid := []kabanerov1alpha2.TargetNamespaceRoleBindingSpec{
+		{Name: "tenant-rolebinding", Scope: "admin", ServiceAccountName: "tenant", RoleName: "admin"},
+		{Name: "tenant-rolebinding", Scope: kabanerov1alpha2.RoleBindingScopeCli, ServiceAccountName: "tenant", RoleKind: "Group", RoleName: "admin"},
+		{Name: "tenant-rolebinding", Scope: kabanerov1alpha2.RoleBindingScopeCli, RoleName: "admin"},
+		{Name: "kabanero-cli-deploy-rolebinding", Scope: kabanerov1alpha2.RoleBindingScopeEvents, ServiceAccountName: "tenant", RoleName: "admin"},
+		{Name: "kabanero-operator-activation-rolebinding", Scope: kabanerov1alpha2.RoleBindingScopePipelines, ServiceAccountName: "tenant", RoleName: "admin"},
+	}
+	for _, binding := range invalid {
+		k.Spec.TargetNamespaceRoleBindings = []kabanerov1alpha2.TargetNamespaceRoleBindingSpec{binding}
+		if _, err := getBindingTemplates(&k); err == nil {
+			t.Fatal(fmt.Sprintf("Role binding should not be valid: %#v", binding))
+		}
+	}
+}
+
+func clientKey(name string, namespace string) client.ObjectKey {
+	return client.ObjectKey{Name: name, Namespace: namespace}
+}
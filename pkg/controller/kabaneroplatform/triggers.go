@@ -0,0 +1,196 @@
+package kabaneroplatform
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The trigger archives of a Kabanero instance, presented as a single version of a component so they can be
+// activated like pipelines.
+type triggersSpec struct {
+	triggers []kabanerov1alpha2.TriggerSpec
+}
+
+func (ts triggersSpec) GetVersions() []kabanerov1alpha2.ComponentSpecVersion {
+	return []kabanerov1alpha2.ComponentSpecVersion{ts}
+}
+
+func (ts triggersSpec) GetVersion() string {
+	return "triggers"
+}
+
+func (ts triggersSpec) GetPipelines() []kabanerov1alpha2.PipelineSpec {
+	pipelines := []kabanerov1alpha2.PipelineSpec{}
+	for _, trigger := range ts.triggers {
+		pipelines = append(pipelines, kabanerov1alpha2.PipelineSpec{Id: trigger.Id, Sha256: trigger.Sha256, Https: trigger.Https, GitRelease: trigger.GitRelease})
+	}
+	return pipelines
+}
+
+// Returns the trigger archives to activate: the triggers of the Kabanero instance, followed by the triggers
+// published by the stack repositories that are not already listed.
+func mergeTriggers(k *kabanerov1alpha2.Kabanero, indexTriggers []kabanerov1alpha2.TriggerSpec) []kabanerov1alpha2.TriggerSpec {
+	triggers := append([]kabanerov1alpha2.TriggerSpec{}, k.Spec.Triggers...)
+	for _, indexTrigger := range indexTriggers {
+		found := false
+		for _, trigger := range triggers {
+			if trigger.Id == indexTrigger.Id && trigger.Sha256 == indexTrigger.Sha256 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			triggers = append(triggers, indexTrigger)
+		}
+	}
+	return triggers
+}
+
+// Activates the trigger archives (TriggerTemplates, TriggerBindings, EventListeners) of the Kabanero instance
+// and of its stack repositories.
+func reconcileTriggers(ctx context.Context, k *kabanerov1alpha2.Kabanero, c client.Client, reqLogger logr.Logger) error {
+	reqLogger.Info("Reconciling triggers.")
+
+	// Read the triggers published by the stack repositories.
+	_, indexTriggers, err := featuredStacks(k, c, reqLogger)
+	if err != nil {
+		return err
+	}
+
+	return activateTriggers(ctx, k, c, indexTriggers, reqLogger)
+}
+
+// Activates the triggers of the Kabanero instance, and the input triggers published by the stack repositories.
+func activateTriggers(ctx context.Context, k *kabanerov1alpha2.Kabanero, c client.Client, indexTriggers []kabanerov1alpha2.TriggerSpec, reqLogger logr.Logger) error {
+
+	// Gather the known asset substitution data.
+	renderingContext := make(map[string]interface{})
+	renderingContext["TargetNamespaces"] = k.GetTargetNamespaces()
+	renderingContext["KabaneroNamespace"] = k.GetNamespace()
+	renderingContext["KabaneroName"] = k.GetName()
+
+	// Identify the owner of the trigger resources
+	ownerIsController := false
+	assetOwner := metav1.OwnerReference{
+		APIVersion: k.TypeMeta.APIVersion,
+		Kind:       k.TypeMeta.Kind,
+		Name:       k.ObjectMeta.Name,
+		UID:        k.ObjectMeta.UID,
+		Controller: &ownerIsController,
+	}
+
+	// Verify the signatures of the trigger archives if signature verification is configured.
+	options := cutils.ActivationOptions{Verifier: cutils.NewSignatureVerifier(c, k.Spec.Stacks.SignatureVerification, k.GetNamespace())}
+	if cutils.IsPlanMode(k) {
+		options.Plan = &cutils.ActivationPlan{}
+	}
+	if k.Spec.ActivateInTargetNamespaces {
+		options.TargetNamespaces = k.GetTargetNamespaces()
+	}
+
+	triggers := mergeTriggers(k, indexTriggers)
+	assetUseMap, err := cutils.ActivatePipelines(triggersSpec{triggers: triggers}, k.Status.Triggers, k.GetNamespace(), renderingContext, assetOwner, c, options, reqLogger)
+
+	if err != nil {
+		return err
+	}
+
+	// In plan mode, publish the changes that would have been made and keep the current status.
+	if options.Plan != nil {
+		planName := k.GetName() + "-triggers-activation-plan"
+		err = cutils.PublishActivationPlan(c, options.Plan, planName, k.GetNamespace(), assetOwner, reqLogger)
+		if err != nil {
+			return err
+		}
+		k.Status.Triggers.Message = fmt.Sprintf("%v The plan was published to ConfigMap %v.", options.Plan.Summary(), planName)
+		return nil
+	}
+
+	// Now update the TriggersStatus to reflect the current state of things.
+	newTriggersStatus := kabanerov1alpha2.TriggersStatus{}
+	if len(triggers) != 0 {
+		newTriggersStatus.Ready = "True"
+	}
+	for _, trigger := range triggers {
+		key := cutils.PipelineUseMapKey{Digest: trigger.Sha256}
+		if trigger.GitRelease.IsUsable() {
+			key.GitRelease = gitReleaseSpecToGitReleaseInfo(trigger.GitRelease)
+		} else {
+			key.Url = trigger.Https.Url
+		}
+		value := assetUseMap[key]
+		if value != nil {
+			newStatus := kabanerov1alpha2.PipelineStatus{}
+			value.DeepCopyInto(&newStatus)
+			newStatus.Name = trigger.Id
+			newTriggersStatus.Triggers = append(newTriggersStatus.Triggers, newStatus)
+			// If we had a problem loading the trigger manifests, say so.
+			if value.ManifestError != nil {
+				newTriggersStatus.Message = value.ManifestError.Error()
+			}
+		}
+	}
+
+	// If any of the trigger assets are not active, the triggers are not ready.
+	for _, trigger := range newTriggersStatus.Triggers {
+		for _, asset := range trigger.ActiveAssets {
+			if asset.Status != cutils.AssetStatusActive {
+				newTriggersStatus.Ready = "False"
+			}
+		}
+	}
+
+	if len(newTriggersStatus.Message) != 0 {
+		newTriggersStatus.Ready = "False"
+	}
+
+	k.Status.Triggers = newTriggersStatus
+
+	return nil
+}
+
+// Removes the cross-namespace objects created during the trigger activation
+func cleanupTriggers(ctx context.Context, k *kabanerov1alpha2.Kabanero, c client.Client, reqLogger logr.Logger) error {
+	reqLogger.Info("Removing triggers.")
+
+	ownerIsController := false
+	assetOwner := metav1.OwnerReference{
+		APIVersion: k.APIVersion,
+		Kind:       k.Kind,
+		Name:       k.Name,
+		UID:        k.UID,
+		Controller: &ownerIsController,
+	}
+
+	// Run thru the status and delete everything, once.  The assets that could not be deleted are kept in the
+	// status, so that the activation bindings of their namespace are kept until they are deleted.
+	for i, trigger := range k.Status.Triggers.Triggers {
+		remaining := []kabanerov1alpha2.RepositoryAssetStatus{}
+		for _, asset := range trigger.ActiveAssets {
+			if len(asset.Namespace) == 0 {
+				asset.Namespace = k.GetNamespace()
+			}
+
+			err := cutils.DeleteAsset(c, asset, assetOwner, reqLogger)
+			if err != nil {
+				remaining = append(remaining, asset)
+			}
+		}
+		k.Status.Triggers.Triggers[i].ActiveAssets = remaining
+	}
+
+	return nil
+}
+
+// Returns the readiness status of the triggers.  The status is determined when the triggers are activated.
+// A Kabanero instance without triggers is ready.
+func getTriggersStatus(k *kabanerov1alpha2.Kabanero) (bool, error) {
+	return k.Status.Triggers.Ready != "False", nil
+}
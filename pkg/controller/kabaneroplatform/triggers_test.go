@@ -0,0 +1,164 @@
+package kabaneroplatform
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Activate the triggers of the Kabanero instance and a stack repository, and make sure the status reflects
+// what was activated.
+func TestReconcileTriggers(t *testing.T) {
+	// The server that will host the trigger archive
+	server := httptest.NewServer(stackHandler{})
+	defer server.Close()
+
+	triggerUrl := server.URL + digest1Pipeline.name
+
+	kabaneroResource := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			Triggers: []kabanerov1alpha2.TriggerSpec{{
+				Id:     "default",
+				Sha256: digest1Pipeline.sha256,
+				Https:  kabanerov1alpha2.HttpsProtocolFile{Url: triggerUrl, SkipCertVerification: true},
+			}},
+		},
+	}
+
+	// The same trigger, published by a stack repository, is only activated once.
+	indexTriggers := []kabanerov1alpha2.TriggerSpec{
+		kabaneroResource.Spec.Triggers[0],
+		{Id: "incubator", Sha256: "0123456789", Https: kabanerov1alpha2.HttpsProtocolFile{Url: server.URL + "/missing.trigger.tar.gz"}},
+	}
+
+	client := gitopsTestClient{map[client.ObjectKey]bool{}}
+	err := activateTriggers(context.TODO(), &kabaneroResource, client, indexTriggers, klog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	// The trigger that could not be read is not reported, but the status says why.
+	if len(kabaneroResource.Status.Triggers.Triggers) != 1 {
+		t.Fatal(fmt.Sprintf("Kabanero status should have 1 trigger, but has %v", len(kabaneroResource.Status.Triggers.Triggers)))
+	}
+
+	trigger := kabaneroResource.Status.Triggers.Triggers[0]
+	if trigger.Name != "default" || len(trigger.ActiveAssets) != 2 {
+		t.Fatal(fmt.Sprintf("Trigger default should have 2 assets, but found: %v", trigger))
+	}
+
+	for _, asset := range trigger.ActiveAssets {
+		if asset.Status != utils.AssetStatusActive {
+			t.Fatal(fmt.Sprintf("Asset %v should have status active, but is %v", asset.Name, asset.Status))
+		}
+	}
+
+	if len(client.objs) != 2 {
+		t.Fatal(fmt.Sprintf("Client map should have 2 entries, but has %v: %v", len(client.objs), client.objs))
+	}
+
+	if len(kabaneroResource.Status.Triggers.Message) == 0 || kabaneroResource.Status.Triggers.Ready != "False" {
+		t.Fatal(fmt.Sprintf("Kabanero triggers should not be ready: %v", kabaneroResource.Status.Triggers))
+	}
+
+	// Remove the repository triggers, and make sure the instance is ready.
+	err = activateTriggers(context.TODO(), &kabaneroResource, client, nil, klog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if ready, _ := getTriggersStatus(&kabaneroResource); !ready {
+		t.Fatal(fmt.Sprintf("Kabanero triggers should be ready: %v", kabaneroResource.Status.Triggers))
+	}
+
+	// Remove the instance triggers, and make sure the assets are deleted.
+	kabaneroResource.Spec.Triggers = nil
+	err = activateTriggers(context.TODO(), &kabaneroResource, client, nil, klog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 0 || len(kabaneroResource.Status.Triggers.Triggers) != 0 {
+		t.Fatal(fmt.Sprintf("The trigger assets should be deleted, but found: %v", client.objs))
+	}
+}
+
+// Make sure the trigger archives are not activated when their signature cannot be verified.
+func TestReconcileTriggersSignatureVerification(t *testing.T) {
+	// The server that will host the trigger archive
+	server := httptest.NewServer(stackHandler{})
+	defer server.Close()
+
+	kabaneroResource := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.KabaneroSpec{
+			Stacks: kabanerov1alpha2.InstanceStackConfig{
+				SignatureVerification: kabanerov1alpha2.SignatureVerificationConfig{
+					Keys: kabanerov1alpha2.SignatureKeysReference{Kind: "Secret", Name: "trusted-keys"},
+				},
+			},
+			Triggers: []kabanerov1alpha2.TriggerSpec{{
+				Id:     "default",
+				Sha256: digest1Pipeline.sha256,
+				Https:  kabanerov1alpha2.HttpsProtocolFile{Url: server.URL + digest1Pipeline.name, SkipCertVerification: true},
+			}},
+		},
+	}
+
+	// The client does not hold the Secret with the trusted keys, so the signature cannot be verified.
+	client := gitopsTestClient{map[client.ObjectKey]bool{}}
+	err := activateTriggers(context.TODO(), &kabaneroResource, client, nil, klog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 0 {
+		t.Fatal(fmt.Sprintf("No trigger assets should have been created, but found: %v", client.objs))
+	}
+
+	if len(kabaneroResource.Status.Triggers.Message) == 0 || kabaneroResource.Status.Triggers.Ready != "False" {
+		t.Fatal(fmt.Sprintf("Kabanero triggers should not be ready: %v", kabaneroResource.Status.Triggers))
+	}
+}
+
+// Make sure the trigger assets are removed with the Kabanero instance.
+func TestCleanupTriggers(t *testing.T) {
+	kabaneroResource := kabanerov1alpha2.Kabanero{
+		ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"},
+		Status: kabanerov1alpha2.KabaneroStatus{
+			Triggers: kabanerov1alpha2.TriggersStatus{
+				Triggers: []kabanerov1alpha2.PipelineStatus{{
+					Name:   "default",
+					Digest: digest1Pipeline.sha256,
+					ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{{
+						Name:      "my-event-listener",
+						Namespace: "kabanero",
+					}, {
+						Name: "my-trigger-template",
+					}},
+				}},
+			},
+		},
+	}
+
+	clientMap := make(map[client.ObjectKey]bool)
+	clientMap[client.ObjectKey{Name: "my-event-listener", Namespace: "kabanero"}] = true
+	clientMap[client.ObjectKey{Name: "my-trigger-template", Namespace: "kabanero"}] = true
+	client := gitopsTestClient{clientMap}
+
+	err := cleanupTriggers(context.TODO(), &kabaneroResource, client, klog)
+	if err != nil {
+		t.Fatal("Returned error: " + err.Error())
+	}
+
+	if len(client.objs) != 0 {
+		t.Fatal(fmt.Sprintf("Client map should have 0 entries, but has %v: %v", len(client.objs), client.objs))
+	}
+}
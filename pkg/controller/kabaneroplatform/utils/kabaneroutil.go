@@ -2,8 +2,10 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	sutils "github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
 )
 
 // Validates that the stack policy configured in the kabanero CR instance yaml is one of the allowed values.
@@ -22,3 +24,37 @@ func ValidateGovernanceStackPolicy(kab *kabanerov1alpha2.Kabanero) (bool, string
 
 	return true, "", nil
 }
+
+// Validates the signature verification configuration in the kabanero CR instance yaml.
+func ValidateSignatureVerification(kab *kabanerov1alpha2.Kabanero) (bool, string, error) {
+	config := kab.Spec.Stacks.SignatureVerification
+	if len(config.Format) != 0 && !(strings.EqualFold(config.Format, "cosign") || strings.EqualFold(config.Format, "gpg")) {
+		reason := fmt.Sprintf("The value %v associated with kabanero CR entry spec.stacks.signatureVerification.format is not valid. The following are allowed values: cosign, gpg", config.Format)
+		return false, reason, nil
+	}
+
+	if len(config.Keys.Kind) != 0 && !(config.Keys.Kind == "Secret" || config.Keys.Kind == "ConfigMap") {
+		reason := fmt.Sprintf("The value %v associated with kabanero CR entry spec.stacks.signatureVerification.keys.kind is not valid. The following are allowed values: Secret, ConfigMap", config.Keys.Kind)
+		return false, reason, nil
+	}
+
+	if (len(config.Format) != 0 || len(config.Keys.Kind) != 0) && len(config.Keys.Name) == 0 {
+		reason := fmt.Sprintf("The kabanero CR entry spec.stacks.signatureVerification.keys.name must be set when signature verification is configured")
+		return false, reason, nil
+	}
+
+	return true, "", nil
+}
+
+// Validates the stack filters of the repositories configured in the kabanero CR instance yaml.
+func ValidateStackFilters(kab *kabanerov1alpha2.Kabanero) (bool, string, error) {
+	for _, repo := range kab.Spec.Stacks.Repositories {
+		_, err := sutils.NewStackFilter(repo.Filter)
+		if err != nil {
+			reason := fmt.Sprintf("The kabanero CR entry spec.stacks.repositories[].filter of repository %v is not valid. %v", repo.Name, err)
+			return false, reason, nil
+		}
+	}
+
+	return true, "", nil
+}
@@ -0,0 +1,186 @@
+package stack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The interval at which the PipelineRuns of stack versions being rolled out as canaries are re-evaluated.
+var canaryCheckInterval = 5 * time.Minute
+
+// Returns the canary rollout status of the input stack version. The status is carried over from the previous
+// status of the version. Once the version was promoted or rolled back, its canary status no longer changes.
+func reconcileCanary(c client.Client, stackResource kabanerov1alpha2.Stack, curSpec kabanerov1alpha2.StackVersion, targetNamespaces []string, logger logr.Logger) *kabanerov1alpha2.StackCanaryStatus {
+	var previous *kabanerov1alpha2.StackVersionStatus
+	for i, sv := range stackResource.Status.Versions {
+		if sv.Version == curSpec.Version {
+			previous = &stackResource.Status.Versions[i]
+			break
+		}
+	}
+
+	if previous != nil && previous.Canary != nil && previous.Canary.Phase != kabanerov1alpha2.CanaryPhaseProgressing {
+		return previous.Canary.DeepCopy()
+	}
+
+	now := metav1.Now()
+	canary := &kabanerov1alpha2.StackCanaryStatus{Phase: kabanerov1alpha2.CanaryPhaseProgressing, StartTime: &now}
+	if previous != nil && previous.Canary != nil {
+		canary = previous.Canary.DeepCopy()
+	}
+	canary.Namespaces = getCanaryNamespaces(curSpec.Canary.Namespaces, targetNamespaces, logger)
+
+	// Count the outcome of the PipelineRuns of the version's pipelines in the canary namespaces since the rollout
+	// started.
+	if previous != nil {
+		pipelineNames := getPipelineNames(stackResource.GetNamespace(), *previous)
+		if len(pipelineNames) != 0 {
+			succeeded, failed, err := countPipelineRuns(c, canary.Namespaces, pipelineNames, canary.StartTime.Time)
+			if err != nil {
+				logger.Error(err, fmt.Sprintf("Unable to count the PipelineRuns of stack %v %v. The previous counts are kept.", stackResource.Spec.Name, curSpec.Version))
+			} else {
+				canary.SuccessfulRuns = succeeded
+				canary.FailedRuns = failed
+			}
+		}
+	}
+
+	phase := evaluateCanary(curSpec.Canary, *canary, now.Time, logger)
+	if phase != kabanerov1alpha2.CanaryPhaseProgressing {
+		logger.Info(fmt.Sprintf("The canary rollout of stack %v %v completed. Phase: %v. Successful PipelineRuns: %v. Failed PipelineRuns: %v", stackResource.Spec.Name, curSpec.Version, phase, canary.SuccessfulRuns, canary.FailedRuns))
+		canary.Phase = phase
+		canary.CompletionTime = &now
+	}
+
+	return canary
+}
+
+// Returns the canary namespaces that are also target namespaces. If the target namespaces are not known, the
+// canary namespaces are returned as is.
+func getCanaryNamespaces(canaryNamespaces []string, targetNamespaces []string, logger logr.Logger) []string {
+	if targetNamespaces == nil {
+		return append([]string{}, canaryNamespaces...)
+	}
+
+	namespaces := []string{}
+	for _, canaryNamespace := range canaryNamespaces {
+		found := false
+		for _, targetNamespace := range targetNamespaces {
+			if canaryNamespace == targetNamespace {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			namespaces = append(namespaces, canaryNamespace)
+		} else {
+			logger.Info(fmt.Sprintf("Canary namespace %v is not a target namespace and is ignored.", canaryNamespace))
+		}
+	}
+
+	return namespaces
+}
+
+// Determines whether a canary rollout should be promoted, rolled back, or continue.  A rollback takes precedence
+// over a promotion.
+func evaluateCanary(spec kabanerov1alpha2.StackCanary, status kabanerov1alpha2.StackCanaryStatus, now time.Time, logger logr.Logger) string {
+	completed := status.SuccessfulRuns + status.FailedRuns
+	minimumRuns := spec.MinimumRuns
+	if minimumRuns < 1 {
+		minimumRuns = 1
+	}
+
+	if spec.FailureThreshold > 0 && completed >= minimumRuns && status.FailedRuns*100 >= spec.FailureThreshold*completed {
+		return kabanerov1alpha2.CanaryPhaseRolledBack
+	}
+
+	if spec.SuccessfulRuns > 0 && status.SuccessfulRuns >= spec.SuccessfulRuns {
+		return kabanerov1alpha2.CanaryPhasePromoted
+	}
+
+	if len(spec.SoakPeriod) != 0 && status.StartTime != nil {
+		soakPeriod, err := time.ParseDuration(spec.SoakPeriod)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("Unable to parse the canary soak period %v", spec.SoakPeriod))
+		} else if now.Sub(status.StartTime.Time) >= soakPeriod {
+			return kabanerov1alpha2.CanaryPhasePromoted
+		}
+	}
+
+	return kabanerov1alpha2.CanaryPhaseProgressing
+}
+
+// Returns a message describing the canary rollout status.
+func canaryStatusMessage(canary kabanerov1alpha2.StackCanaryStatus) string {
+	switch canary.Phase {
+	case kabanerov1alpha2.CanaryPhasePromoted:
+		return fmt.Sprintf("The stack was promoted after a canary rollout with %v successful and %v failed PipelineRuns.", canary.SuccessfulRuns, canary.FailedRuns)
+	case kabanerov1alpha2.CanaryPhaseRolledBack:
+		return fmt.Sprintf("The stack was rolled back because its PipelineRun failure rate crossed the canary failure threshold. Successful PipelineRuns: %v. Failed PipelineRuns: %v.", canary.SuccessfulRuns, canary.FailedRuns)
+	}
+
+	if len(canary.Namespaces) == 0 {
+		return "The stack is being rolled out as a canary, but none of the canary namespaces are target namespaces."
+	}
+
+	return fmt.Sprintf("The stack is being rolled out as a canary in namespaces %v. Successful PipelineRuns: %v. Failed PipelineRuns: %v.", canary.Namespaces, canary.SuccessfulRuns, canary.FailedRuns)
+}
+
+// Returns the number of successful and failed PipelineRuns created since the input time, in the input namespaces,
+// of the input pipelines keyed by namespace. PipelineRuns that have not completed are not counted.
+func countPipelineRuns(c client.Client, namespaces []string, pipelineNames map[string]map[string]bool, since time.Time) (int64, int64, error) {
+	var succeeded, failed int64
+	for _, namespace := range namespaces {
+		if len(pipelineNames[namespace]) == 0 {
+			continue
+		}
+
+		runs, err := listPipelineRuns(c, namespace)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, run := range runs {
+			if run.GetCreationTimestamp().Time.Before(since) {
+				continue
+			}
+
+			pipelineName, _, _ := unstructured.NestedString(run.Object, "spec", "pipelineRef", "name")
+			if !pipelineNames[namespace][pipelineName] {
+				continue
+			}
+
+			switch getPipelineRunSucceeded(run) {
+			case "True":
+				succeeded++
+			case "False":
+				failed++
+			}
+		}
+	}
+
+	return succeeded, failed, nil
+}
+
+// Returns the status of the Succeeded condition of the input PipelineRun, or an empty string if it is not set.
+func getPipelineRunSucceeded(run unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(run.Object, "status", "conditions")
+	for _, condition := range conditions {
+		cond, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == "Succeeded" {
+			status, _ := cond["status"].(string)
+			return status
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package stack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Unit test client listing PipelineRuns.
+type canaryTestClient struct {
+	unitTestClient
+	runs []unstructured.Unstructured
+}
+
+func (c canaryTestClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	if ul, ok := list.(*unstructured.UnstructuredList); ok {
+		ul.Items = nil
+		for _, run := range c.runs {
+			if run.GetNamespace() == listOptions.Namespace {
+				ul.Items = append(ul.Items, run)
+			}
+		}
+	}
+	return nil
+}
+
+func canaryTestPipelineRun(pipeline string, succeeded string, created time.Time) unstructured.Unstructured {
+	return canaryTestPipelineRunInNamespace("team-a", pipeline, succeeded, created)
+}
+
+func canaryTestPipelineRunInNamespace(namespace string, pipeline string, succeeded string, created time.Time) unstructured.Unstructured {
+	run := unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"pipelineRef": map[string]interface{}{"name": pipeline}},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"type": "Succeeded", "status": succeeded}},
+		},
+	}}
+	run.SetNamespace(namespace)
+	run.SetCreationTimestamp(metav1.NewTime(created))
+	return run
+}
+
+// Test that canary rollouts are promoted or rolled back.
+func TestEvaluateCanary(t *testing.T) {
+	start := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	tests := []struct {
+		spec      kabanerov1alpha2.StackCanary
+		succeeded int64
+		failed    int64
+		expected  string
+	}{
+		{kabanerov1alpha2.StackCanary{SuccessfulRuns: 5}, 4, 0, kabanerov1alpha2.CanaryPhaseProgressing},
+		{kabanerov1alpha2.StackCanary{SuccessfulRuns: 5}, 5, 0, kabanerov1alpha2.CanaryPhasePromoted},
+		{kabanerov1alpha2.StackCanary{SoakPeriod: "1h"}, 0, 0, kabanerov1alpha2.CanaryPhasePromoted},
+		{kabanerov1alpha2.StackCanary{SoakPeriod: "24h"}, 0, 0, kabanerov1alpha2.CanaryPhaseProgressing},
+		{kabanerov1alpha2.StackCanary{SuccessfulRuns: 5, FailureThreshold: 50}, 5, 5, kabanerov1alpha2.CanaryPhaseRolledBack},
+		{kabanerov1alpha2.StackCanary{FailureThreshold: 50, MinimumRuns: 4}, 1, 2, kabanerov1alpha2.CanaryPhaseProgressing},
+		{kabanerov1alpha2.StackCanary{FailureThreshold: 50, MinimumRuns: 4}, 2, 2, kabanerov1alpha2.CanaryPhaseRolledBack},
+		{kabanerov1alpha2.StackCanary{FailureThreshold: 50}, 3, 1, kabanerov1alpha2.CanaryPhaseProgressing},
+	}
+
+	for _, test := range tests {
+		status := kabanerov1alpha2.StackCanaryStatus{StartTime: &start, SuccessfulRuns: test.succeeded, FailedRuns: test.failed}
+		phase := evaluateCanary(test.spec, status, time.Now(), sctlog)
+		if phase != test.expected {
+			t.Errorf("Canary %+v with %v successful and %v failed PipelineRuns: expected phase %v, but got %v", test.spec, test.succeeded, test.failed, test.expected, phase)
+		}
+	}
+}
+
+// Test that the PipelineRuns of the canary version are counted, and that a completed rollout does not change.
+func TestReconcileCanary(t *testing.T) {
+	start := metav1.NewTime(time.Now().Add(-time.Hour))
+	stackResource := kabanerov1alpha2.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero"},
+		Spec:       kabanerov1alpha2.StackSpec{Name: "java-microprofile"},
+		Status: kabanerov1alpha2.StackStatus{
+			Versions: []kabanerov1alpha2.StackVersionStatus{{
+				Version: "0.3.0",
+				Status:  kabanerov1alpha2.StackDesiredStateCanary,
+				Pipelines: []kabanerov1alpha2.PipelineStatus{{
+					ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{{Name: "build-pl-1234abcd", Namespace: "team-a", Kind: "Pipeline", NamespaceCopy: true}},
+				}},
+				Canary: &kabanerov1alpha2.StackCanaryStatus{Phase: kabanerov1alpha2.CanaryPhaseProgressing, StartTime: &start},
+			}},
+		},
+	}
+
+	curSpec := kabanerov1alpha2.StackVersion{
+		Version:      "0.3.0",
+		DesiredState: kabanerov1alpha2.StackDesiredStateCanary,
+		Canary:       kabanerov1alpha2.StackCanary{Namespaces: []string{"team-a", "team-z"}, SuccessfulRuns: 2, FailureThreshold: 50, MinimumRuns: 3},
+	}
+
+	c := canaryTestClient{runs: []unstructured.Unstructured{
+		canaryTestPipelineRun("build-pl-1234abcd", "True", time.Now()),
+		canaryTestPipelineRun("build-pl-1234abcd", "Unknown", time.Now()),
+		canaryTestPipelineRun("build-pl-1234abcd", "True", start.Add(-time.Minute)),
+		canaryTestPipelineRun("deploy-pl-1234abcd", "True", time.Now()),
+		canaryTestPipelineRunInNamespace("kabanero", "build-pl-1234abcd", "True", time.Now()),
+		canaryTestPipelineRunInNamespace("team-z", "build-pl-1234abcd", "True", time.Now()),
+	}}
+
+	canary := reconcileCanary(c, stackResource, curSpec, []string{"team-a", "team-b"}, sctlog)
+	if canary.Phase != kabanerov1alpha2.CanaryPhaseProgressing || canary.SuccessfulRuns != 1 || canary.FailedRuns != 0 {
+		t.Fatalf("Only the completed PipelineRuns of the canary pipelines in the canary namespaces started after the rollout should be counted: %+v", canary)
+	}
+	if len(canary.Namespaces) != 1 || canary.Namespaces[0] != "team-a" {
+		t.Fatalf("Only the canary namespaces that are target namespaces should be active: %v", canary.Namespaces)
+	}
+
+	c.runs = append(c.runs, canaryTestPipelineRun("build-pl-1234abcd", "True", time.Now()))
+	canary = reconcileCanary(c, stackResource, curSpec, []string{"team-a", "team-b"}, sctlog)
+	if canary.Phase != kabanerov1alpha2.CanaryPhasePromoted || canary.CompletionTime == nil {
+		t.Fatalf("The canary should have been promoted after 2 successful PipelineRuns: %+v", canary)
+	}
+
+	stackResource.Status.Versions[0].Canary = canary
+	c.runs = append(c.runs, canaryTestPipelineRun("build-pl-1234abcd", "False", time.Now()), canaryTestPipelineRun("build-pl-1234abcd", "False", time.Now()))
+	canary = reconcileCanary(c, stackResource, curSpec, []string{"team-a", "team-b"}, sctlog)
+	if canary.Phase != kabanerov1alpha2.CanaryPhasePromoted || canary.FailedRuns != 0 {
+		t.Fatalf("A promoted canary should not be re-evaluated: %+v", canary)
+	}
+}
@@ -0,0 +1,411 @@
+package stack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	sutils "github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
+	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/cache"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The default name of a stack index file.
+	defaultIndexFileName = "index.yaml"
+
+	// The OCI annotation holding the file name of an artifact layer.
+	ociTitleAnnotation = "org.opencontainers.image.title"
+)
+
+// IndexSource retrieves the content of a stack index file from one type of stack repository.
+type IndexSource interface {
+	// Returns the name identifying the source type.
+	Name() string
+
+	// Returns true if the repository configuration identifies an index held by this source type.
+	Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool
+
+	// Retrieves the content of the index file identified by the repository configuration.
+	GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error)
+
+	// Retrieves the detached signature of the index file. The signature is located next to the index file,
+	// under the index file's name followed by the input suffix.
+	GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error)
+}
+
+// IndexResolver is implemented by the index sources that update the index after it is read, for example to
+// locate the files referenced by the index.
+type IndexResolver interface {
+	ResolveIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, index *Index, reqLogger logr.Logger) error
+}
+
+// The registered index sources, in order of precedence.
+var indexSources []IndexSource
+
+// Mutex for concurrent index source registry access
+var indexSourcesLock sync.RWMutex
+
+func init() {
+	RegisterIndexSource(gitReleaseIndexSource{})
+	RegisterIndexSource(gitRepoIndexSource{})
+	RegisterIndexSource(httpsIndexSource{})
+	RegisterIndexSource(ociIndexSource{})
+	RegisterIndexSource(configMapIndexSource{})
+	RegisterIndexSource(bundleIndexSource{})
+}
+
+// Adds an index source to the registry. Sources registered first take precedence when a repository
+// configuration is handled by more than one source.
+func RegisterIndexSource(source IndexSource) {
+	indexSourcesLock.Lock()
+	defer indexSourcesLock.Unlock()
+	indexSources = append(indexSources, source)
+}
+
+// Returns the registered index source handling the input repository configuration, or nil if none does.
+func getIndexSource(repoConf kabanerov1alpha2.RepositoryConfig) IndexSource {
+	indexSourcesLock.RLock()
+	defer indexSourcesLock.RUnlock()
+	for _, source := range indexSources {
+		if source.Handles(repoConf) {
+			return source
+		}
+	}
+	return nil
+}
+
+// Retrieves the stack index from a GitHub release asset.
+type gitReleaseIndexSource struct{}
+
+func (gitReleaseIndexSource) Name() string {
+	return "gitRelease"
+}
+
+func (gitReleaseIndexSource) Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool {
+	return repoConf.GitRelease.IsUsable()
+}
+
+func (gitReleaseIndexSource) GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	return cache.GetStackDataUsingGit(c, gitReleaseSpecToGitReleaseInfo(repoConf.GitRelease), repoConf.GitRelease.SkipCertVerification, namespace, reqLogger)
+}
+
+func (gitReleaseIndexSource) GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error) {
+	gitRelease := gitReleaseSpecToGitReleaseInfo(repoConf.GitRelease)
+	gitRelease.AssetName = gitRelease.AssetName + suffix
+	return cache.GetStackDataUsingGit(c, gitRelease, repoConf.GitRelease.SkipCertVerification, namespace, reqLogger)
+}
+
+// Retrieves the stack index from a path in a Git repository at a commit or branch.
+type gitRepoIndexSource struct{}
+
+func (gitRepoIndexSource) Name() string {
+	return "gitRepo"
+}
+
+func (gitRepoIndexSource) Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool {
+	return repoConf.GitRepo.IsUsable()
+}
+
+func (gitRepoIndexSource) GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	return cache.GetFileUsingGitRepo(c, repoConf.GitRepo, namespace, reqLogger)
+}
+
+func (gitRepoIndexSource) GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error) {
+	gitRepo := repoConf.GitRepo
+	gitRepo.Path = gitRepo.Path + suffix
+	return cache.GetFileUsingGitRepo(c, gitRepo, namespace, reqLogger)
+}
+
+// Retrieves the stack index using HTTP.
+type httpsIndexSource struct{}
+
+func (httpsIndexSource) Name() string {
+	return "https"
+}
+
+func (httpsIndexSource) Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool {
+	return len(repoConf.Https.Url) != 0
+}
+
+func (httpsIndexSource) GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	return getStackIndexUsingHttp(c, repoConf)
+}
+
+func (httpsIndexSource) GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error) {
+	url, err := getStackIndexUrl(repoConf.Https.Url)
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetFromCache(c, url+suffix, repoConf.Https.SkipCertVerification)
+}
+
+// Retrieves the stack index from an OCI artifact in a container registry.
+type ociIndexSource struct{}
+
+func (ociIndexSource) Name() string {
+	return "oci"
+}
+
+func (ociIndexSource) Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool {
+	return len(repoConf.Oci.Image) != 0
+}
+
+func (ociIndexSource) GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	return getOciArtifactFile(c, repoConf.Oci, namespace, false, reqLogger)
+}
+
+func (ociIndexSource) GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error) {
+	oci := repoConf.Oci
+	if len(oci.FileName) == 0 {
+		oci.FileName = defaultIndexFileName
+	}
+	oci.FileName = oci.FileName + suffix
+	return getOciArtifactFile(c, oci, namespace, true, reqLogger)
+}
+
+// Retrieves the stack index from a ConfigMap in the Kabanero namespace.
+type configMapIndexSource struct{}
+
+func (configMapIndexSource) Name() string {
+	return "configMap"
+}
+
+func (configMapIndexSource) Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool {
+	return len(repoConf.ConfigMap.Name) != 0
+}
+
+func (configMapIndexSource) GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	return getConfigMapFile(c, repoConf.ConfigMap, namespace)
+}
+
+func (configMapIndexSource) GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error) {
+	configMapFile := repoConf.ConfigMap
+	if len(configMapFile.Key) == 0 {
+		configMapFile.Key = defaultIndexFileName
+	}
+	configMapFile.Key = configMapFile.Key + suffix
+	return getConfigMapFile(c, configMapFile, namespace)
+}
+
+// Retrieves the stack index from an offline bundle.  The relative pipeline and trigger URLs of the index
+// reference the archives held by the bundle, and the image digests are read from the bundle.
+type bundleIndexSource struct{}
+
+func (bundleIndexSource) Name() string {
+	return "bundle"
+}
+
+func (bundleIndexSource) Handles(repoConf kabanerov1alpha2.RepositoryConfig) bool {
+	return repoConf.Bundle.IsUsable()
+}
+
+func (bundleIndexSource) GetIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	return cutils.GetBundleFile(c, namespace, repoConf.Bundle, cutils.BundleIndexFile)
+}
+
+func (bundleIndexSource) GetIndexSignature(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, suffix string, reqLogger logr.Logger) ([]byte, error) {
+	return cutils.GetBundleFile(c, namespace, repoConf.Bundle, cutils.BundleIndexFile+suffix)
+}
+
+func (bundleIndexSource) ResolveIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, index *Index, reqLogger logr.Logger) error {
+	digests := cutils.BundleDigests{}
+	b, err := cutils.GetBundleFile(c, namespace, repoConf.Bundle, cutils.BundleDigestsFile)
+	if _, notFound := err.(cutils.BundleFileNotFoundError); notFound {
+		reqLogger.Info(fmt.Sprintf("The bundle of repository %v does not contain %v. The image digests are retrieved from the registries.", repoConf.Name, cutils.BundleDigestsFile))
+	} else if err != nil {
+		return err
+	} else if err = yaml.Unmarshal(b, &digests); err != nil {
+		return fmt.Errorf("Unable to read %v from the bundle of repository %v: %v", cutils.BundleDigestsFile, repoConf.Name, err)
+	}
+
+	for i := range index.Stacks {
+		stack := &index.Stacks[i]
+
+		// The pipelines may be shared with other stacks, so they are copied before they are updated.
+		pipelines := make([]Pipelines, len(stack.Pipelines))
+		for j, pipeline := range stack.Pipelines {
+			if !pipeline.GitRelease.IsUsable() && isRelativeUrl(pipeline.Url) {
+				pipeline.Url = cutils.BundleFileUrl(repoConf.Bundle, pipeline.Url)
+			}
+			pipelines[j] = pipeline
+		}
+		stack.Pipelines = pipelines
+
+		images := make([]Images, len(stack.Images))
+		for j, image := range stack.Images {
+			digest, ok := digests.Images[image.Image+":"+stack.Version]
+			if !ok {
+				digest = digests.Images[image.Image]
+			}
+			image.Digest = strings.TrimPrefix(digest, "sha256:")
+			images[j] = image
+		}
+		stack.Images = images
+	}
+
+	triggers := make([]Trigger, len(index.Triggers))
+	for i, trigger := range index.Triggers {
+		if isRelativeUrl(trigger.Url) {
+			trigger.Url = cutils.BundleFileUrl(repoConf.Bundle, trigger.Url)
+		}
+		triggers[i] = trigger
+	}
+	index.Triggers = triggers
+
+	return nil
+}
+
+// Returns true if the URL is a path relative to the location of the index.
+func isRelativeUrl(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && len(rawurl) != 0 && len(u.Scheme) == 0 && len(u.Host) == 0 && !path.IsAbs(u.Path)
+}
+
+// Retrieves a file stored as an OCI artifact. The file is read from the artifact layer whose title annotation
+// matches the configured file name. Unless an exact match is required, the layer of a single layer artifact is
+// used regardless of its title. Layers holding a gzipped tar archive are searched for the file.
+func getOciArtifactFile(c client.Client, oci kabanerov1alpha2.OciArtifactSpec, namespace string, exactMatch bool, reqLogger logr.Logger) ([]byte, error) {
+	fileName := oci.FileName
+	if len(fileName) == 0 {
+		fileName = defaultIndexFileName
+	}
+
+	registry, err := sutils.GetImageRegistry(oci.Image)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse registry from OCI artifact reference %v. Error: %v", oci.Image, err)
+	}
+
+	authenticator, err := getImageRegistryAuthenticator(c, namespace, registry, reqLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := name.ParseReference(oci.Image, name.WeakValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{}
+	if oci.SkipCertVerification {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: oci.SkipCertVerification}
+	}
+
+	img, err := remote.Image(ref, remote.WithAuth(authenticator), remote.WithTransport(transport))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve OCI artifact %v. Error: %v", oci.Image, err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve the manifest of OCI artifact %v. Error: %v", oci.Image, err)
+	}
+
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("OCI artifact %v does not contain any layers", oci.Image)
+	}
+
+	layerDesc := manifest.Layers[0]
+	found := !exactMatch && len(manifest.Layers) == 1
+	for _, desc := range manifest.Layers {
+		if desc.Annotations[ociTitleAnnotation] == fileName {
+			layerDesc = desc
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("OCI artifact %v does not contain a layer with the %v annotation set to %v", oci.Image, ociTitleAnnotation, fileName)
+	}
+
+	layer, err := img.LayerByDigest(layerDesc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := layer.Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read layer %v of OCI artifact %v. Error: %v", layerDesc.Digest, oci.Image, err)
+	}
+	defer reader.Close()
+
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read layer %v of OCI artifact %v. Error: %v", layerDesc.Digest, oci.Image, err)
+	}
+
+	// The layer holds the file itself, unless it is a gzipped archive.
+	if len(b) < 2 || b[0] != 0x1f || b[1] != 0x8b {
+		return b, nil
+	}
+
+	return getFileFromTarGz(b, fileName)
+}
+
+// Returns the content of the file with the input name from a gzipped tar archive.
+func getFileFromTarGz(archive []byte, fileName string) ([]byte, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == fileName {
+			return ioutil.ReadAll(tarReader)
+		}
+	}
+
+	return nil, fmt.Errorf("File %v was not found in the archive", fileName)
+}
+
+// Retrieves a file stored in a ConfigMap in the input namespace.
+func getConfigMapFile(c client.Client, configMapFile kabanerov1alpha2.ConfigMapFileSpec, namespace string) ([]byte, error) {
+	key := configMapFile.Key
+	if len(key) == 0 {
+		key = defaultIndexFileName
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: configMapFile.Name}, configMap)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve ConfigMap %v in namespace %v. Error: %v", configMapFile.Name, namespace, err)
+	}
+
+	if data, ok := configMap.Data[key]; ok {
+		return []byte(data), nil
+	}
+
+	if data, ok := configMap.BinaryData[key]; ok {
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("ConfigMap %v in namespace %v does not contain key %v", configMapFile.Name, namespace, key)
+}
@@ -0,0 +1,202 @@
+package stack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Unit test client returning a ConfigMap holding a stack index.
+type configMapIndexTestClient struct {
+	resolverTestClient
+}
+
+func (c configMapIndexTestClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok || key.Name != "stack-index" || key.Namespace != "kabanero" {
+		return c.resolverTestClient.Get(ctx, key, obj)
+	}
+
+	index, err := ioutil.ReadFile("testdata/incubator-index.yaml")
+	if err != nil {
+		return err
+	}
+
+	configMap.Data = map[string]string{"index.yaml": string(index)}
+	return nil
+}
+
+// Test that the registered index source with the highest precedence handles the repository configuration.
+func TestGetIndexSource(t *testing.T) {
+	tests := []struct {
+		repoConf kabanerov1alpha2.RepositoryConfig
+		expected string
+	}{
+		{kabanerov1alpha2.RepositoryConfig{Https: kabanerov1alpha2.HttpsProtocolFile{Url: "https://example.com/index.yaml"}}, "https"},
+		{kabanerov1alpha2.RepositoryConfig{GitRelease: kabanerov1alpha2.GitReleaseSpec{Hostname: "github.com", Organization: "kabanero-io", Project: "stacks", Release: "0.9.0", AssetName: "index.yaml"}, Https: kabanerov1alpha2.HttpsProtocolFile{Url: "https://example.com/index.yaml"}}, "gitRelease"},
+		{kabanerov1alpha2.RepositoryConfig{GitRepo: kabanerov1alpha2.GitRepoSpec{Hostname: "github.com", Organization: "kabanero-io", Project: "stacks", Path: "index.yaml", Revision: "main"}}, "gitRepo"},
+		{kabanerov1alpha2.RepositoryConfig{Oci: kabanerov1alpha2.OciArtifactSpec{Image: "registry.example.com/stacks/index:1.0.0"}}, "oci"},
+		{kabanerov1alpha2.RepositoryConfig{ConfigMap: kabanerov1alpha2.ConfigMapFileSpec{Name: "stack-index"}}, "configMap"},
+		{kabanerov1alpha2.RepositoryConfig{Bundle: kabanerov1alpha2.BundleSpec{Path: "/var/kabanero/bundles/stacks.tar.gz"}}, "bundle"},
+	}
+
+	for _, test := range tests {
+		source := getIndexSource(test.repoConf)
+		if source == nil {
+			t.Fatalf("No index source was found for repository configuration %+v", test.repoConf)
+		}
+		if source.Name() != test.expected {
+			t.Fatalf("Expected index source %v, but found %v", test.expected, source.Name())
+		}
+	}
+
+	if getIndexSource(kabanerov1alpha2.RepositoryConfig{Name: "empty"}) != nil {
+		t.Fatal("No index source should handle an empty repository configuration")
+	}
+
+	_, err := ResolveIndex(resolverTestClient{}, kabanerov1alpha2.RepositoryConfig{Name: "empty"}, "kabanero", []Pipelines{}, []Trigger{}, "", resolverTestLogger)
+	if err == nil {
+		t.Fatal("An error should have been returned for an empty repository configuration")
+	}
+}
+
+// Test that a stack index is resolved from a ConfigMap.
+func TestResolveIndexFromConfigMap(t *testing.T) {
+	repoConfig := kabanerov1alpha2.RepositoryConfig{
+		Name:      "mirror",
+		ConfigMap: kabanerov1alpha2.ConfigMapFileSpec{Name: "stack-index"},
+	}
+
+	index, err := ResolveIndex(configMapIndexTestClient{}, repoConfig, "kabanero", []Pipelines{}, []Trigger{}, "", resolverTestLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.Stacks) == 0 {
+		t.Fatal("The stack index read from the ConfigMap should contain stacks")
+	}
+
+	repoConfig.ConfigMap.Key = "missing.yaml"
+	_, err = ResolveIndex(configMapIndexTestClient{}, repoConfig, "kabanero", []Pipelines{}, []Trigger{}, "", resolverTestLogger)
+	if err == nil {
+		t.Fatal("An error should have been returned for a missing ConfigMap key")
+	}
+}
+
+// Unit test client returning a ConfigMap holding an offline bundle.
+type bundleTestClient struct {
+	resolverTestClient
+	bundle []byte
+}
+
+func (c bundleTestClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok || key.Name != "stacks-bundle" || key.Namespace != "kabanero" {
+		return c.resolverTestClient.Get(ctx, key, obj)
+	}
+
+	configMap.BinaryData = map[string][]byte{"bundle.tar.gz": c.bundle}
+	return nil
+}
+
+// Test that a stack index is resolved from an offline bundle, and that it references the bundle's archives
+// and image digests.
+func TestResolveIndexFromBundle(t *testing.T) {
+	files := map[string]string{
+		"index.yaml": `stacks:
+- id: nodejs
+  version: 0.3.1
+  images:
+  - id: nodejs
+    image: docker.io/kabanero/nodejs
+  pipelines:
+  - id: default
+    sha256: 0123456789abcdef
+    url: pipelines/default.tar.gz
+triggers:
+- id: triggers
+  url: https://example.com/triggers.tar.gz
+`,
+		"digests.yaml": `images:
+  docker.io/kabanero/nodejs:0.3.1: sha256:8f095a6e
+`,
+		"pipelines/default.tar.gz": "archive",
+	}
+
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, content := range files {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Close()
+	gzWriter.Close()
+
+	repoConfig := kabanerov1alpha2.RepositoryConfig{
+		Name:   "offline",
+		Bundle: kabanerov1alpha2.BundleSpec{ConfigMap: kabanerov1alpha2.ConfigMapFileSpec{Name: "stacks-bundle"}},
+	}
+
+	c := bundleTestClient{bundle: buf.Bytes()}
+	index, err := ResolveIndex(c, repoConfig, "kabanero", []Pipelines{}, []Trigger{}, "", resolverTestLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.Stacks) != 1 {
+		t.Fatalf("Expected one stack in the bundle index, but found: %v", index.Stacks)
+	}
+	stack := index.Stacks[0]
+	if stack.Pipelines[0].Url != "bundle://configmap/stacks-bundle/bundle.tar.gz#pipelines/default.tar.gz" {
+		t.Fatalf("Expected the pipeline to reference the bundle, but found: %v", stack.Pipelines[0].Url)
+	}
+	if stack.Images[0].Digest != "8f095a6e" {
+		t.Fatalf("Expected the image digest to be read from the bundle, but found: %v", stack.Images[0].Digest)
+	}
+	if index.Triggers[0].Url != "https://example.com/triggers.tar.gz" {
+		t.Fatalf("Expected the absolute trigger URL to be unchanged, but found: %v", index.Triggers[0].Url)
+	}
+
+	archive, err := cutils.DownloadToByte(c, "kabanero", stack.Pipelines[0].Url, kabanerov1alpha2.GitReleaseInfo{}, false, resolverTestLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(archive) != "archive" {
+		t.Fatalf("Expected the pipeline archive to be read from the bundle, but found: %v", string(archive))
+	}
+}
+
+// Test that a file is read from a gzipped tar archive.
+func TestGetFileFromTarGz(t *testing.T) {
+	archive, err := ioutil.ReadFile("testdata/basic.pipeline.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := getFileFromTarGz(archive, "manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) == 0 {
+		t.Fatal("The manifest.yaml file read from the archive should not be empty")
+	}
+
+	_, err = getFileFromTarGz(archive, "index.yaml")
+	if err == nil {
+		t.Fatal("An error should have been returned for a file that is not in the archive")
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-logr/logr"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/cache"
 	"gopkg.in/yaml.v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -13,36 +14,49 @@ import (
 
 // ResolveIndex returns a structure representation of the yaml file represented by the index.
 func ResolveIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, pipelines []Pipelines, triggers []Trigger, imagePrefix string, reqLogger logr.Logger) (*Index, error) {
-	var indexBytes []byte
+	return ResolveVerifiedIndex(c, repoConf, namespace, pipelines, triggers, imagePrefix, nil, reqLogger)
+}
+
+// ResolveVerifiedIndex returns a structure representation of the yaml file represented by the index. If a
+// signature verifier is provided, the detached signature of the index is verified before the index is read.
+func ResolveVerifiedIndex(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig, namespace string, pipelines []Pipelines, triggers []Trigger, imagePrefix string, verifier *cutils.SignatureVerifier, reqLogger logr.Logger) (*Index, error) {
+	source := getIndexSource(repoConf)
+	if source == nil {
+		return nil, fmt.Errorf("No information was provided to retrieve the stack's index file from the repository identified as %v. Specify a stack repository that includes a HTTP URL location, GitHub release information, Git repository information, an OCI artifact, a ConfigMap, or an offline bundle.", repoConf.Name)
+	}
 
-	switch {
-	// GIT:
-	case repoConf.GitRelease.IsUsable():
-		bytes, err := cache.GetStackDataUsingGit(c, gitReleaseSpecToGitReleaseInfo(repoConf.GitRelease), repoConf.GitRelease.SkipCertVerification, namespace, reqLogger)
+	indexBytes, err := source.GetIndex(c, repoConf, namespace, reqLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifier != nil {
+		signature, err := source.GetIndexSignature(c, repoConf, namespace, verifier.SignatureSuffix(), reqLogger)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Unable to retrieve the signature of the stack index of repository %v: %v", repoConf.Name, err)
 		}
-		indexBytes = bytes
-	// HTTPS:
-	case len(repoConf.Https.Url) != 0:
-		bytes, err := getStackIndexUsingHttp(c, repoConf)
+
+		err = verifier.Verify(fmt.Sprintf("the stack index of repository %v", repoConf.Name), indexBytes, signature)
 		if err != nil {
 			return nil, err
 		}
-		indexBytes = bytes
-	// NOT SUPPORTED:
-	default:
-		return nil, fmt.Errorf("No information was provided to retrieve the stack's index file from the repository identified as %v. Specify a stack repository that includes a HTTP URL location or GitHub release information.", repoConf.Name)
 	}
 
 	var index Index
-	err := yaml.Unmarshal(indexBytes, &index)
+	err = yaml.Unmarshal(indexBytes, &index)
 	if err != nil {
 		return nil, err
 	}
 
 	processIndexPostRead(&index, pipelines, triggers)
 
+	if resolver, ok := source.(IndexResolver); ok {
+		err = resolver.ResolveIndex(c, repoConf, namespace, &index, reqLogger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &index, nil
 }
 
@@ -118,16 +132,23 @@ func SearchStack(stackName string, index *Index) ([]Stack, error) {
 
 // Retrieves a stack index file content using HTTP.
 func getStackIndexUsingHttp(c client.Client, repoConf kabanerov1alpha2.RepositoryConfig) ([]byte, error) {
-	url := repoConf.Https.Url
+	url, err := getStackIndexUrl(repoConf.Https.Url)
+	if err != nil {
+		return nil, err
+	}
 
-	// user may specify url to yaml file or directory
+	return cache.GetFromCache(c, url, repoConf.Https.SkipCertVerification)
+}
+
+// Returns the URL of a stack index file. The configured URL may refer to the yaml file or to its directory.
+func getStackIndexUrl(url string) (string, error) {
 	matched, err := regexp.MatchString(`/([^/]+)[.]yaml$`, url)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	if !matched {
 		url = url + "/index.yaml"
 	}
 
-	return cache.GetFromCache(c, url, repoConf.Https.SkipCertVerification)
+	return url, nil
 }
@@ -24,6 +24,9 @@ type Stack struct {
 type Images struct {
 	Id    string `yaml:"id,omitempty"`
 	Image string `yaml:"image,omitempty"`
+
+	// The digest of the image, read from an offline bundle.
+	Digest string `yaml:"-"`
 }
 
 // Maintainers holds stack maintainer information.
@@ -40,6 +43,7 @@ type Pipelines struct {
 	Url                  string                          `yaml:"url,omitempty"`
 	GitRelease           kabanerov1alpha2.GitReleaseSpec `yaml:"gitRelease,omitempty"`
 	SkipCertVerification bool                            `yaml:"skipCertVerification,omitempty"`
+	Values               map[string]string               `yaml:"values,omitempty"`
 }
 
 // Templates holds the stack's associated template data.
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
@@ -21,6 +22,7 @@ import (
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
 	sutils "github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
 	cutils "github.com/kabanero-io/kabanero-operator/pkg/controller/utils"
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/metrics"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/secret"
 
 	"github.com/docker/docker/registry"
@@ -29,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -45,6 +48,12 @@ import (
 var log = logf.Log.WithName("controller_stack")
 var cIDRegex = regexp.MustCompile("^[a-z]([a-z0-9-]*[a-z0-9])?$")
 
+// The interval at which the digests of active stack images are re-resolved to detect re-pushed tags.
+var digestCheckInterval = 30 * time.Minute
+
+// The interval at which the activation plan of a stack in plan mode is refreshed.
+var planRefreshInterval = 5 * time.Minute
+
 // Add creates a new Stack Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
@@ -53,7 +62,7 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileStack{client: mgr.GetClient(), scheme: mgr.GetScheme(), indexResolver: ResolveIndex}
+	return &ReconcileStack{client: mgr.GetClient(), apiReader: mgr.GetAPIReader(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("stack-controller"), indexResolver: ResolveIndex}
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -72,8 +81,10 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			// Returning true only when the metadata generation has changed,
 			// allows us to ignore events where only the object status has changed,
-			// since the generation is not incremented when only the status changes
-			return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration()
+			// since the generation is not incremented when only the status changes.
+			// Plan mode is requested with an annotation, which does not change the generation either.
+			return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() ||
+				e.MetaOld.GetAnnotations()[cutils.PlanModeAnnotation] != e.MetaNew.GetAnnotations()[cutils.PlanModeAnnotation]
 		},
 	}
 
@@ -83,6 +94,27 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Reconcile the stacks of a Kabanero instance when the namespaces their pipelines are activated in change,
+	// or when plan mode is turned on or off for the Kabanero instance.
+	cl := mgr.GetClient()
+	err = c.Watch(&source.Kind{Type: &kabanerov1alpha2.Kabanero{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			return stackRequests(cl, a.Meta.GetNamespace())
+		})}, predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldKabanero, okOld := e.ObjectOld.(*kabanerov1alpha2.Kabanero)
+			newKabanero, okNew := e.ObjectNew.(*kabanerov1alpha2.Kabanero)
+			return okOld && okNew && (!reflect.DeepEqual(getActivationTargetNamespaces(oldKabanero), getActivationTargetNamespaces(newKabanero)) ||
+				oldKabanero.GetAnnotations()[cutils.PlanModeAnnotation] != newKabanero.GetAnnotations()[cutils.PlanModeAnnotation])
+		},
+	})
+	if err != nil {
+		return err
+	}
+
 	// Create a handler for handling Tekton Pipeline & Task events
 	tH := &handler.EnqueueRequestForOwner{
 		IsController: false,
@@ -125,6 +157,25 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Reconcile the stacks whose pipelines are run when the PipelineRuns complete, so that their usage is updated.
+	err = c.Watch(&source.Kind{Type: &pipelinev1alpha1.PipelineRun{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+			return pipelineRunStackRequests(cl, a)
+		})}, predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldRun, okOld := e.ObjectOld.(*pipelinev1alpha1.PipelineRun)
+			newRun, okNew := e.ObjectNew.(*pipelinev1alpha1.PipelineRun)
+			return okOld && okNew && oldRun.Status.CompletionTime == nil && newRun.Status.CompletionTime != nil
+		},
+	})
+	if err != nil {
+		log.Info(fmt.Sprintf("Tekton Pipelines may not be installed"))
+		return err
+	}
+
 	// Index ImageStreams by status.publicDockerImageRepository
 	if err := mgr.GetFieldIndexer().IndexField(&imagev1.ImageStream{}, "status.publicDockerImageRepository", func(rawObj k8runtime.Object) []string {
 		imagestream := rawObj.(*imagev1.ImageStream)
@@ -147,6 +198,13 @@ type ReconcileStack struct {
 	client client.Client
 	scheme *k8runtime.Scheme
 
+	// The uncached reader used to list the PipelineRuns in the target namespaces, which are outside of the
+	// namespace watched by the client.
+	apiReader client.Reader
+
+	// The recorder used to emit events associated with Stack objects
+	recorder record.EventRecorder
+
 	//The indexResolver which will be used during reconciliation
 	indexResolver func(client.Client, kabanerov1alpha2.RepositoryConfig, string, []Pipelines, []Trigger, string, logr.Logger) (*Index, error)
 }
@@ -185,6 +243,7 @@ func (r *ReconcileStack) Reconcile(request reconcile.Request) (reconcile.Result,
 	}
 
 	if beingDeleted {
+		metrics.DeleteStackStatus(instance.GetNamespace(), instance.GetName())
 		return reconcile.Result{}, nil
 	}
 
@@ -192,6 +251,8 @@ func (r *ReconcileStack) Reconcile(request reconcile.Request) (reconcile.Result,
 
 	r.client.Status().Update(ctx, instance)
 
+	recordStackMetrics(instance)
+
 	// Force a requeue if there are failed assets.  These should be retried, and since
 	// they are hosted outside of Kubernetes, the controller will not see when they
 	// are updated.
@@ -211,9 +272,89 @@ func (r *ReconcileStack) Reconcile(request reconcile.Request) (reconcile.Result,
 		rr.RequeueAfter = 60 * time.Second
 	}
 
+	// Requeue stacks with periodic checks, so that the checks are run.
+	if interval := periodicCheckInterval(instance.Status); interval != 0 && (rr.Requeue == false) {
+		rr.Requeue = true
+		rr.RequeueAfter = interval
+	}
+
 	return rr, err
 }
 
+// Returns the interval after which the stack must be reconciled again for its periodic checks, which is the
+// shortest interval of the checks that apply to the stack status.  Returns zero if no checks apply.
+func periodicCheckInterval(status kabanerov1alpha2.StackStatus) time.Duration {
+	var interval time.Duration
+	requeueAfter := func(checkInterval time.Duration) {
+		if interval == 0 || checkInterval < interval {
+			interval = checkInterval
+		}
+	}
+
+	// Stacks in plan mode are requeued so that the plan is refreshed, and so that plan mode being turned off
+	// on the Kabanero instance is noticed.
+	if strings.HasPrefix(status.StatusMessage, cutils.PlanSummaryPrefix) {
+		requeueAfter(planRefreshInterval)
+	}
+
+	// Stacks being rolled out as canaries are requeued so that their PipelineRuns are evaluated.
+	if progressingCanaries(status) {
+		requeueAfter(canaryCheckInterval)
+	}
+
+	// Active stacks are requeued so that the digests of their images are checked for drift periodically.
+	if activeImages(status) {
+		requeueAfter(digestCheckInterval)
+	}
+
+	// Stacks with activated pipelines are requeued so that their usage is refreshed.
+	if activePipelines(status) {
+		requeueAfter(usageCheckInterval)
+	}
+
+	return interval
+}
+
+// Records the number of versions of the stack in each state, and the number of its pipeline assets in each status.
+func recordStackMetrics(stack *kabanerov1alpha2.Stack) {
+	versionStates := map[string]int{
+		kabanerov1alpha2.StackDesiredStateActive:   0,
+		kabanerov1alpha2.StackDesiredStateInactive: 0,
+		kabanerov1alpha2.StackStateError:           0,
+	}
+	assetStatuses := make(map[string]int)
+	for _, version := range stack.Status.Versions {
+		versionStates[version.Status]++
+		for _, pipeline := range version.Pipelines {
+			for _, asset := range pipeline.ActiveAssets {
+				assetStatuses[asset.Status]++
+			}
+		}
+	}
+
+	metrics.RecordStackStatus(stack.GetNamespace(), stack.GetName(), versionStates, assetStatuses)
+}
+
+// Returns true if the status contains active versions with images.
+func activeImages(status kabanerov1alpha2.StackStatus) bool {
+	for _, version := range status.Versions {
+		if version.Status == kabanerov1alpha2.StackDesiredStateActive && len(version.Images) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the status contains versions being rolled out as canaries.
+func progressingCanaries(status kabanerov1alpha2.StackStatus) bool {
+	for _, version := range status.Versions {
+		if version.Canary != nil && version.Canary.Phase == kabanerov1alpha2.CanaryPhaseProgressing {
+			return true
+		}
+	}
+	return false
+}
+
 // Check to see if the status contains any assets that are failed
 func failedAssets(status kabanerov1alpha2.StackStatus) bool {
 	for _, version := range status.Versions {
@@ -241,6 +382,30 @@ func stackSummary(status kabanerov1alpha2.StackStatus) (string, string) {
 	return fmt.Sprintf("[ %v ]", strings.Join(summary, ", ")), fmt.Sprintf(strings.Join(errorSummary, ", "))
 }
 
+// Sets the Ready and Progressing conditions from the status of the stack versions.
+func setStackConditions(status *kabanerov1alpha2.StackStatus, generation int64) {
+	ready := kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeReady, Status: kabanerov1alpha2.ConditionTrue, Reason: "Reconciled", ObservedGeneration: generation}
+	_, errorSummary := stackSummary(*status)
+	if len(errorSummary) != 0 {
+		ready.Status = kabanerov1alpha2.ConditionFalse
+		ready.Reason = "VersionError"
+		ready.Message = fmt.Sprintf("An error was detected on stack versions [%v]. See the status message of each version for details.", errorSummary)
+	} else if failedAssets(*status) {
+		ready.Status = kabanerov1alpha2.ConditionFalse
+		ready.Reason = "AssetsFailed"
+		ready.Message = "One or more pipeline assets could not be activated. See the status of each asset for details."
+	}
+	cutils.SetStatusCondition(&status.Conditions, ready)
+
+	progressing := kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeProgressing, Status: kabanerov1alpha2.ConditionFalse, Reason: "RolloutComplete", ObservedGeneration: generation}
+	if progressingCanaries(*status) {
+		progressing.Status = kabanerov1alpha2.ConditionTrue
+		progressing.Reason = "CanaryRollout"
+		progressing.Message = "One or more stack versions are being rolled out as canaries."
+	}
+	cutils.SetStatusCondition(&status.Conditions, progressing)
+}
+
 // Used internally by ReconcileStack to store matching stacks
 // Could be less cumbersome to just use kabanerov1alpha2.Stack
 type resolvedStack struct {
@@ -266,20 +431,68 @@ func (r *ReconcileStack) ReconcileStack(c *kabanerov1alpha2.Stack) (reconcile.Re
 
 	r_log = r_log.WithValues("Stack.Name", stackName)
 
+	previousStatus := c.Status.DeepCopy()
+
 	// Process the versions array and activate (or deactivate) the desired versions.
-	err := reconcileActiveVersions(c, r.client, r_log)
+	err := reconcileActiveVersions(c, r.client, r.recorder, r_log)
 	if err != nil {
 		// TODO - what is useful to print?
 		log.Error(err, fmt.Sprintf("Error during reconcileActiveVersions"))
+		cutils.SetStatusCondition(&c.Status.Conditions, kabanerov1alpha2.Condition{
+			Type:               kabanerov1alpha2.ConditionTypeReady,
+			Status:             kabanerov1alpha2.ConditionFalse,
+			Reason:             "ReconcileFailed",
+			Message:            err.Error(),
+			ObservedGeneration: c.Generation,
+		})
 	}
 
+	// Report the use of the activated pipelines.
+	reconcileUsage(r.apiReader, c, *previousStatus, r_log)
+
+	// Report stack image tags that were re-pushed since the previous reconciliation.
+	r.recordImageDigestDrift(c, *previousStatus)
+
 	return reconcile.Result{}, nil
 }
 
+// Emits events for stack images whose digest drifted from, or returned to, the activation digest since the
+// previous reconciliation.
+func (r *ReconcileStack) recordImageDigestDrift(stack *kabanerov1alpha2.Stack, previousStatus kabanerov1alpha2.StackStatus) {
+	if r.recorder == nil {
+		return
+	}
+
+	for _, version := range stack.Status.Versions {
+		for _, image := range version.Images {
+			previousDigest := kabanerov1alpha2.ImageDigest{}
+			for _, pv := range previousStatus.Versions {
+				if pv.Version != version.Version {
+					continue
+				}
+				for _, pi := range pv.Images {
+					if pi.Image == image.Image {
+						previousDigest = pi.Digest
+					}
+				}
+			}
+
+			img := image.Image + ":" + version.Version
+			if image.Digest.DriftTime != nil {
+				if previousDigest.DriftTime == nil || previousDigest.Current != image.Digest.Current {
+					r.recorder.Event(stack, corev1.EventTypeWarning, "ImageDigestDrift", fmt.Sprintf("The tag of image %v was re-pushed. Activation digest: %v. Current digest: %v", img, image.Digest.Activation, image.Digest.Current))
+				}
+			} else if previousDigest.DriftTime != nil && len(image.Digest.Current) != 0 {
+				r.recorder.Event(stack, corev1.EventTypeNormal, "ImageDigestRestored", fmt.Sprintf("The digest of image %v matches its activation digest %v again", img, image.Digest.Activation))
+			}
+		}
+	}
+}
+
 func gitReleaseSpecToGitReleaseInfo(gitRelease kabanerov1alpha2.GitReleaseSpec) kabanerov1alpha2.GitReleaseInfo {
 	return kabanerov1alpha2.GitReleaseInfo{Hostname: gitRelease.Hostname, Organization: gitRelease.Organization, Project: gitRelease.Project, Release: gitRelease.Release, AssetName: gitRelease.AssetName}
 }
-func reconcileActiveVersions(stackResource *kabanerov1alpha2.Stack, c client.Client, logger logr.Logger) error {
+func reconcileActiveVersions(stackResource *kabanerov1alpha2.Stack, c client.Client, recorder record.EventRecorder, logger logr.Logger) error {
 
 	// Gather the known stack asset (*-tasks, *-pipeline) substitution data.
 	renderingContext := make(map[string]interface{})
@@ -309,22 +522,83 @@ func reconcileActiveVersions(stackResource *kabanerov1alpha2.Stack, c client.Cli
 		Controller: &ownerIsController,
 	}
 
+	// Determine the governance stack policy applied to the images used by this stack, and whether the
+	// signatures of its pipeline archives are verified.
+	kabanero := getKabaneroInstance(c, stackResource.GetNamespace(), logger)
+	renderingContext["TargetNamespaces"] = getTargetNamespaces(kabanero)
+	renderingContext["KabaneroNamespace"] = stackResource.GetNamespace()
+	renderingContext["KabaneroName"] = ""
+	if kabanero != nil {
+		renderingContext["KabaneroName"] = kabanero.GetName()
+	}
+	stackPolicy := getGovernanceStackPolicy(kabanero)
+	options := cutils.ActivationOptions{Verifier: getSignatureVerifier(c, kabanero), DriftPolicy: stackResource.Spec.AssetDriftPolicy, Recorder: recorder, EventObject: stackResource}
+	if isPlanMode(stackResource, kabanero) {
+		options.Plan = &cutils.ActivationPlan{}
+	}
+	options.TargetNamespaces = getActivationTargetNamespaces(kabanero)
+
+	// Evaluate the canary rollouts. The pipelines of versions being rolled out are only activated in their
+	// canary namespaces, and the pipelines of versions that were rolled back are deactivated.
+	activationSpec := stackResource.Spec.DeepCopy()
+	canaries := make(map[string]*kabanerov1alpha2.StackCanaryStatus)
+	options.VersionNamespaces = make(map[string][]string)
+	for i, curSpec := range activationSpec.Versions {
+		if strings.EqualFold(curSpec.DesiredState, kabanerov1alpha2.StackDesiredStateCanary) {
+			canary := reconcileCanary(c, *stackResource, curSpec, getTargetNamespaces(kabanero), logger)
+			canaries[curSpec.Version] = canary
+			switch canary.Phase {
+			case kabanerov1alpha2.CanaryPhaseProgressing:
+				options.VersionNamespaces[curSpec.Version] = canary.Namespaces
+			case kabanerov1alpha2.CanaryPhaseRolledBack:
+				activationSpec.Versions[i].DesiredState = kabanerov1alpha2.StackDesiredStateInactive
+			}
+		}
+	}
+
+	// Gather the values of each version that are made available to its pipeline manifests. The activation
+	// digests of the images are retrieved here, and reused when the status is updated below.
+	imageDigests := make(map[string]imageDigestResult)
+	options.VersionContext = make(map[string]map[string]interface{})
+	for _, curSpec := range activationSpec.Versions {
+		if !strings.EqualFold(curSpec.DesiredState, kabanerov1alpha2.StackDesiredStateInactive) {
+			options.VersionContext[curSpec.Version] = versionRenderingContext(c, *stackResource, curSpec, imageDigests, logger)
+		}
+	}
+
 	// Activate the pipelines used by this stack.
-	assetUseMap, err := cutils.ActivatePipelines(stackResource.Spec, stackResource.Status, stackResource.GetNamespace(), renderingContext, assetOwner, c, logger)
+	assetUseMap, err := cutils.ActivatePipelines(*activationSpec, stackResource.Status, stackResource.GetNamespace(), renderingContext, assetOwner, c, options, logger)
 
 	if err != nil {
 		return err
 	}
 
+	// In plan mode, publish the changes that would have been made, and leave the version status alone so
+	// that it still describes what is applied in the cluster.
+	if options.Plan != nil {
+		planName := stackResource.GetName() + "-activation-plan"
+		err = cutils.PublishActivationPlan(c, options.Plan, planName, stackResource.GetNamespace(), assetOwner, logger)
+		if err != nil {
+			return err
+		}
+		stackResource.Status.StatusMessage = fmt.Sprintf("%v The plan was published to ConfigMap %v.", options.Plan.Summary(), planName)
+		return nil
+	}
+
 	// Now update the StackStatus to reflect the current state of things.
 	newStackStatus := kabanerov1alpha2.StackStatus{}
 	for i, curSpec := range stackResource.Spec.Versions {
-		newStackVersionStatus := kabanerov1alpha2.StackVersionStatus{Version: curSpec.Version}
-		if !strings.EqualFold(curSpec.DesiredState, kabanerov1alpha2.StackDesiredStateInactive) {
-			if (len(curSpec.DesiredState) > 0) && (!strings.EqualFold(curSpec.DesiredState, kabanerov1alpha2.StackDesiredStateActive)) {
+		newStackVersionStatus := kabanerov1alpha2.StackVersionStatus{Version: curSpec.Version, Canary: canaries[curSpec.Version], Source: curSpec.Source}
+		if !strings.EqualFold(activationSpec.Versions[i].DesiredState, kabanerov1alpha2.StackDesiredStateInactive) {
+			newStackVersionStatus.Status = kabanerov1alpha2.StackDesiredStateActive
+			if newStackVersionStatus.Canary != nil {
+				if newStackVersionStatus.Canary.Phase == kabanerov1alpha2.CanaryPhaseProgressing {
+					newStackVersionStatus.Status = kabanerov1alpha2.StackDesiredStateCanary
+				}
+				newStackVersionStatus.StatusMessage = canaryStatusMessage(*newStackVersionStatus.Canary)
+			} else if (len(curSpec.DesiredState) > 0) && (!strings.EqualFold(curSpec.DesiredState, kabanerov1alpha2.StackDesiredStateActive)) {
 				newStackVersionStatus.StatusMessage = "An invalid desiredState value of " + curSpec.DesiredState + " was specified. The stack is activated by default."
 			}
-			newStackVersionStatus.Status = kabanerov1alpha2.StackDesiredStateActive
 
 			for _, pipeline := range curSpec.Pipelines {
 				key := cutils.PipelineUseMapKey{Digest: pipeline.Sha256}
@@ -361,15 +635,41 @@ func reconcileActiveVersions(stackResource *kabanerov1alpha2.Stack, c client.Cli
 
 			// Update the status of the Stack object to reflect the images used
 			for _, img := range curSpec.Images {
-				digest, err := getStatusImageDigest(c, *stackResource, curSpec, img.Image, logger)
+				activationRecorded := isActivationDigestRecorded(*stackResource, curSpec, img.Image)
+				digest, err := getCachedImageDigest(c, *stackResource, curSpec, img.Image, imageDigests, logger)
 				if err != nil {
 					newStackVersionStatus.Status = kabanerov1alpha2.StackStateError
+					if recorder != nil {
+						recorder.Event(stackResource, corev1.EventTypeWarning, "ImageDigestFailed", digest.Message)
+					}
+				} else if !activationRecorded {
+					digest.Current = digest.Activation
+				} else {
+					// Check whether the image tag was re-pushed, and apply the governance stack policy.
+					digest = checkImageDigestDrift(c, *stackResource, curSpec, img.Image, digest, logger)
+					decision := enforceStackPolicy(*stackResource, curSpec, img.Image, digest, stackPolicy, logger)
+					switch decision.Decision {
+					case sutils.PolicyDecisionReject:
+						digest.Message = decision.Reason
+						newStackVersionStatus.Status = kabanerov1alpha2.StackStateError
+						newStackVersionStatus.StatusMessage = decision.Reason
+					case sutils.PolicyDecisionWarn:
+						digest.Message = decision.Reason
+					default:
+						digest.Message = ""
+					}
 				}
 				newStackVersionStatus.Images = append(newStackVersionStatus.Images, kabanerov1alpha2.ImageStatus{Id: img.Id, Image: img.Image, Digest: digest})
 			}
 		} else {
 			newStackVersionStatus.Status = kabanerov1alpha2.StackDesiredStateInactive
 			newStackVersionStatus.StatusMessage = "The stack has been deactivated."
+			if reason, ok := sutils.GetDeactivationReasons(*stackResource)[curSpec.Version]; ok {
+				newStackVersionStatus.StatusMessage = reason
+			}
+			if newStackVersionStatus.Canary != nil {
+				newStackVersionStatus.StatusMessage = canaryStatusMessage(*newStackVersionStatus.Canary)
+			}
 		}
 
 		log.Info(fmt.Sprintf("Updated stack status: %+v", newStackVersionStatus))
@@ -378,11 +678,55 @@ func reconcileActiveVersions(stackResource *kabanerov1alpha2.Stack, c client.Cli
 
 	newStackStatus.Summary, _ = stackSummary(newStackStatus)
 
+	// Carry over the conditions so that their last transition times are preserved.
+	newStackStatus.Conditions = stackResource.Status.Conditions
+	setStackConditions(&newStackStatus, stackResource.Generation)
+
+	recordVersionTransitions(recorder, stackResource, stackResource.Status, newStackStatus)
+
 	stackResource.Status = newStackStatus
 
 	return nil
 }
 
+// Records events for the stack versions whose state changed since the previous reconciliation.
+func recordVersionTransitions(recorder record.EventRecorder, stackResource *kabanerov1alpha2.Stack, previousStatus kabanerov1alpha2.StackStatus, newStatus kabanerov1alpha2.StackStatus) {
+	if recorder == nil {
+		return
+	}
+
+	for _, version := range newStatus.Versions {
+		previousState := ""
+		for _, pv := range previousStatus.Versions {
+			if pv.Version == version.Version {
+				previousState = pv.Status
+				break
+			}
+		}
+
+		if version.Status == previousState {
+			continue
+		}
+
+		switch version.Status {
+		case kabanerov1alpha2.StackDesiredStateActive:
+			recorder.Eventf(stackResource, corev1.EventTypeNormal, "StackActivated", "Stack %v %v was activated", stackResource.Spec.Name, version.Version)
+		case kabanerov1alpha2.StackDesiredStateCanary:
+			recorder.Eventf(stackResource, corev1.EventTypeNormal, "StackCanaryRollout", "Stack %v %v is being rolled out as a canary", stackResource.Spec.Name, version.Version)
+		case kabanerov1alpha2.StackDesiredStateInactive:
+			if len(previousState) != 0 {
+				recorder.Eventf(stackResource, corev1.EventTypeNormal, "StackDeactivated", "Stack %v %v was deactivated", stackResource.Spec.Name, version.Version)
+			}
+		case kabanerov1alpha2.StackStateError:
+			message := version.StatusMessage
+			if len(message) == 0 {
+				message = "See the status of the stack version for details."
+			}
+			recorder.Eventf(stackResource, corev1.EventTypeWarning, "StackVersionError", "Stack %v %v is in error: %v", stackResource.Spec.Name, version.Version, message)
+		}
+	}
+}
+
 func getStackForSpecVersion(spec kabanerov1alpha2.StackVersion, stacks []resolvedStack) *resolvedStack {
 	for _, stack := range stacks {
 		if stack.stack.Version == spec.Version {
@@ -421,6 +765,11 @@ func getStatusImageDigest(c client.Client, stackResource kabanerov1alpha2.Stack,
 		}
 	}
 
+	// If the activation digest was not set, use the digest provided by an offline bundle.
+	if digest == (kabanerov1alpha2.ImageDigest{}) {
+		digest.Activation = getSpecImageDigest(curSpec, targetImg)
+	}
+
 	// If the activation digest was not set, find it.
 	if digest == (kabanerov1alpha2.ImageDigest{}) {
 		digest.Message = ""
@@ -432,6 +781,7 @@ func getStatusImageDigest(c client.Client, stackResource kabanerov1alpha2.Stack,
 		} else {
 			imgDig, err := retrieveImageDigest(c, stackResource.GetNamespace(), registry, curSpec.SkipRegistryCertVerification, logger, img)
 			if err != nil {
+				metrics.RecordDigestFailure(registry)
 				digest.Message = fmt.Sprintf("Unable to retrieve stack activation digest for image: %v. Associated stack: %v %v. Error: %v", img, stackResource.Spec.Name, curSpec.Version, err)
 				return digest, err
 			} else {
@@ -443,6 +793,216 @@ func getStatusImageDigest(c client.Client, stackResource kabanerov1alpha2.Stack,
 	return digest, nil
 }
 
+// The result of retrieving the activation digest of an image.
+type imageDigestResult struct {
+	digest kabanerov1alpha2.ImageDigest
+	err    error
+}
+
+// Returns the activation digest of an image, retrieving it only once per reconciliation.
+func getCachedImageDigest(c client.Client, stackResource kabanerov1alpha2.Stack, curSpec kabanerov1alpha2.StackVersion, targetImg string, imageDigests map[string]imageDigestResult, logger logr.Logger) (kabanerov1alpha2.ImageDigest, error) {
+	key := curSpec.Version + "/" + targetImg
+	result, ok := imageDigests[key]
+	if !ok {
+		result.digest, result.err = getStatusImageDigest(c, stackResource, curSpec, targetImg, logger)
+		imageDigests[key] = result
+	}
+	return result.digest, result.err
+}
+
+// Returns the values of a stack version that are made available to its pipeline manifests: the version, its
+// user-defined parameters, and its images, keyed by image id and referenced by their activation digest.
+func versionRenderingContext(c client.Client, stackResource kabanerov1alpha2.Stack, curSpec kabanerov1alpha2.StackVersion, imageDigests map[string]imageDigestResult, logger logr.Logger) map[string]interface{} {
+	images := make(map[string]string)
+	imageSpec := curSpec.DeepCopy()
+	err := sutils.RemoveTagFromStackImages(imageSpec, stackResource.Spec.Name)
+	if err == nil {
+		for _, img := range imageSpec.Images {
+			images[img.Id] = img.Image
+			digest, err := getCachedImageDigest(c, stackResource, *imageSpec, img.Image, imageDigests, logger)
+			if err == nil && len(digest.Activation) != 0 {
+				images[img.Id] = img.Image + "@sha256:" + digest.Activation
+			}
+		}
+	}
+
+	parameters := make(map[string]string)
+	for key, value := range curSpec.Parameters {
+		parameters[key] = value
+	}
+
+	return map[string]interface{}{
+		"StackVersion": curSpec.Version,
+		"Images":       images,
+		"Parameters":   parameters,
+	}
+}
+
+// Returns true if the activation digest of the input image was recorded in the stack status by a previous reconciliation.
+func isActivationDigestRecorded(stackResource kabanerov1alpha2.Stack, curSpec kabanerov1alpha2.StackVersion, targetImg string) bool {
+	for _, ssv := range stackResource.Status.Versions {
+		if ssv.Version != curSpec.Version {
+			continue
+		}
+		for _, ssvi := range ssv.Images {
+			if targetImg == ssvi.Image {
+				return len(ssvi.Digest.Activation) != 0
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns the Kabanero instance in the input namespace, or nil if one could not be found.
+func getKabaneroInstance(c client.Client, namespace string, logger logr.Logger) *kabanerov1alpha2.Kabanero {
+	kabaneroList := &kabanerov1alpha2.KabaneroList{}
+	err := c.List(context.TODO(), kabaneroList, client.InNamespace(namespace))
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("Unable to list Kabanero instances in namespace %v.", namespace))
+		return nil
+	}
+
+	if len(kabaneroList.Items) == 0 {
+		return nil
+	}
+
+	return &kabaneroList.Items[0]
+}
+
+// Returns the target namespaces of the input Kabanero instance, or nil if a Kabanero instance could not be found.
+func getTargetNamespaces(kabanero *kabanerov1alpha2.Kabanero) []string {
+	if kabanero == nil {
+		return nil
+	}
+
+	return kabanero.GetTargetNamespaces()
+}
+
+// Returns a reconcile request for each stack in the input namespace.
+func stackRequests(c client.Client, namespace string) []reconcile.Request {
+	stacks := &kabanerov1alpha2.StackList{}
+	err := c.List(context.TODO(), stacks, client.InNamespace(namespace))
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Unable to list the stacks in namespace %v", namespace))
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, stack := range stacks.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: stack.Name, Namespace: stack.Namespace}})
+	}
+	return requests
+}
+
+// Returns the target namespaces the pipelines are also activated in, or nil if activation in the target
+// namespaces was not requested on the input Kabanero instance.
+func getActivationTargetNamespaces(kabanero *kabanerov1alpha2.Kabanero) []string {
+	if kabanero == nil || !kabanero.Spec.ActivateInTargetNamespaces {
+		return nil
+	}
+	return getTargetNamespaces(kabanero)
+}
+
+// Returns true if plan mode was requested on the stack, or on the Kabanero instance in its namespace.
+func isPlanMode(stackResource *kabanerov1alpha2.Stack, kabanero *kabanerov1alpha2.Kabanero) bool {
+	if kabanero != nil && cutils.IsPlanMode(kabanero) {
+		return true
+	}
+
+	return cutils.IsPlanMode(stackResource)
+}
+
+// Returns the governance stack policy configured in the input Kabanero instance. If a Kabanero instance
+// could not be found, the stack policy is not enforced.
+func getGovernanceStackPolicy(kabanero *kabanerov1alpha2.Kabanero) string {
+	if kabanero == nil {
+		return kabanerov1alpha2.StackPolicyNone
+	}
+
+	return sutils.EffectiveStackPolicy(kabanero.Spec.GovernancePolicy.StackPolicy)
+}
+
+// Returns the verifier of pipeline archive signatures configured in the input Kabanero instance, or nil if
+// signature verification is not configured.
+func getSignatureVerifier(c client.Client, kabanero *kabanerov1alpha2.Kabanero) *cutils.SignatureVerifier {
+	if kabanero == nil {
+		return nil
+	}
+
+	return cutils.NewSignatureVerifier(c, kabanero.Spec.Stacks.SignatureVerification, kabanero.GetNamespace())
+}
+
+// Returns the digest of the image provided in the stack version spec (i.e. from an offline bundle), if any.
+func getSpecImageDigest(curSpec kabanerov1alpha2.StackVersion, targetImg string) string {
+	for _, image := range curSpec.Images {
+		if image.Image == targetImg {
+			return image.Digest
+		}
+	}
+	return ""
+}
+
+// Re-resolves the digest the registry currently serves for the stack version's tag and records it in the input
+// digest. If the current digest differs from the activation digest, the time at which the drift was first observed
+// is recorded as well. If the current digest could not be retrieved, the previously recorded values are kept.
+func checkImageDigestDrift(c client.Client, stackResource kabanerov1alpha2.Stack, curSpec kabanerov1alpha2.StackVersion, targetImg string, digest kabanerov1alpha2.ImageDigest, logger logr.Logger) kabanerov1alpha2.ImageDigest {
+	// The images of an offline bundle are not checked: the registry may not be reachable.
+	if len(getSpecImageDigest(curSpec, targetImg)) != 0 {
+		return digest
+	}
+
+	// The registry is only queried once per check interval.  A failed lookup is not retried before the next
+	// interval either.
+	now := metav1.Now()
+	if digest.LastCheckTime != nil && now.Sub(digest.LastCheckTime.Time) < digestCheckInterval {
+		return digest
+	}
+	digest.LastCheckTime = &now
+
+	img := targetImg + ":" + curSpec.Version
+	registry, err := sutils.GetImageRegistry(img)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("Unable to parse registry from image: %v. Associated stack: %v %v. The image digest was not checked for drift.", img, stackResource.Spec.Name, curSpec.Version))
+		return digest
+	}
+
+	currentDigest, err := retrieveImageDigest(c, stackResource.GetNamespace(), registry, curSpec.SkipRegistryCertVerification, logger, img)
+	if err != nil {
+		metrics.RecordDigestFailure(registry)
+		logger.Error(err, fmt.Sprintf("Unable to retrieve the current digest for image: %v. Associated stack: %v %v. The image digest was not checked for drift.", img, stackResource.Spec.Name, curSpec.Version))
+		return digest
+	}
+
+	if sutils.NormalizeDigest(currentDigest) == sutils.NormalizeDigest(digest.Activation) {
+		digest.Current = currentDigest
+		digest.DriftTime = nil
+		return digest
+	}
+
+	// Record the drift time when the drift is first observed, or when the tag was re-pushed again.
+	if digest.DriftTime == nil || sutils.NormalizeDigest(digest.Current) != sutils.NormalizeDigest(currentDigest) {
+		logger.Info(fmt.Sprintf("The digest of image %v has drifted from its activation digest. Activation digest: %v. Current digest: %v. Associated stack: %v %v", img, digest.Activation, currentDigest, stackResource.Spec.Name, curSpec.Version))
+		digest.DriftTime = &now
+	}
+	digest.Current = currentDigest
+
+	return digest
+}
+
+// Applies the governance stack policy to a stack image whose activation digest is known. The digest the registry
+// currently serves for the stack version's tag is compared with the activation digest. If the current digest
+// is not known, the policy is not enforced during this reconciliation.
+func enforceStackPolicy(stackResource kabanerov1alpha2.Stack, curSpec kabanerov1alpha2.StackVersion, targetImg string, digest kabanerov1alpha2.ImageDigest, stackPolicy string, logger logr.Logger) sutils.PolicyDecision {
+	img := targetImg + ":" + curSpec.Version
+	decision := sutils.EvaluateStackDigestDrift(stackPolicy, img, digest.Activation, digest.Current)
+	if decision.Decision != sutils.PolicyDecisionAllow {
+		logger.Info(fmt.Sprintf("Stack policy %v violation (%v). Associated stack: %v %v. %v", stackPolicy, decision.Decision, stackResource.Spec.Name, curSpec.Version, decision.Reason))
+	}
+
+	return decision
+}
+
 // Retrieves the input image digest from the hosting repository.
 func retrieveImageDigest(c client.Client, namespace string, imgRegistry string, skipCertVerification bool, logr logr.Logger, image string) (string, error) {
 	// Check if the image is in the local registry - imagestream using the external route
@@ -486,12 +1046,51 @@ func retrieveImageDigest(c client.Client, namespace string, imgRegistry string,
 		}
 	}
 	
+	authenticator, err := getImageRegistryAuthenticator(c, namespace, imgRegistry, logr)
+	if err != nil {
+		return "", err
+	}
+
+	// Retrieve the image manifest.
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return "", err
+	}
+
+	transport := &http.Transport{}
+	if skipCertVerification {
+		tlsConf := &tls.Config{InsecureSkipVerify: skipCertVerification}
+		transport.TLSClientConfig = tlsConf
+	}
+
+	img, err := remote.Image(ref,
+		remote.WithAuth(authenticator),
+		remote.WithPlatform(v1.Platform{Architecture: runtime.GOARCH, OS: runtime.GOOS}),
+		remote.WithTransport(transport))
+	if err != nil {
+		return "", err
+	}
+
+	// Get the image's Digest (i.e sha256:8f095a6e...)
+	h, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+
+	// Return the actual digest part only.
+	return h.Hex, nil
+}
+
+// Returns the authenticator used to access the input image registry. The authentication credentials are read
+// from the secret in the input namespace annotated with the registry's hostname. If no such secret exists,
+// anonymous authentication is used.
+func getImageRegistryAuthenticator(c client.Client, namespace string, imgRegistry string, logr logr.Logger) (authn.Authenticator, error) {
 	// Search all secrets under the given namespace for the one containing the required hostname.
 	annotationKey := "kabanero.io/docker-"
 	secret, err := secret.GetMatchingSecret(c, namespace, sutils.SecretAnnotationFilter, imgRegistry, annotationKey)
 	if err != nil {
 		newError := fmt.Errorf("Unable to find secret matching annotation values: %v and %v in namespace %v Error: %v", annotationKey, imgRegistry, namespace, err)
-		return "", newError
+		return nil, newError
 	}
 
 	// If a secret was found, retrieve the needed information from it.
@@ -513,43 +1112,16 @@ func retrieveImageDigest(c client.Client, namespace string, imgRegistry string,
 	if len(username) != 0 && len(password) != 0 {
 		authenticator, err = getBasicSecAuth(username, password)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	} else if len(dockerconfig) != 0 || len(dockerconfigjson) != 0 {
 		authenticator, err = getDockerCfgSecAuth(dockerconfigjson, dockerconfig, imgRegistry, logr)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 
-	// Retrieve the image manifest.
-	ref, err := name.ParseReference(image, name.WeakValidation)
-	if err != nil {
-		return "", err
-	}
-
-	transport := &http.Transport{}
-	if skipCertVerification {
-		tlsConf := &tls.Config{InsecureSkipVerify: skipCertVerification}
-		transport.TLSClientConfig = tlsConf
-	}
-
-	img, err := remote.Image(ref,
-		remote.WithAuth(authenticator),
-		remote.WithPlatform(v1.Platform{Architecture: runtime.GOARCH, OS: runtime.GOOS}),
-		remote.WithTransport(transport))
-	if err != nil {
-		return "", err
-	}
-
-	// Get the image's Digest (i.e sha256:8f095a6e...)
-	h, err := img.Digest()
-	if err != nil {
-		return "", err
-	}
-
-	// Return the actual digest part only.
-	return h.Hex, nil
+	return authenticator, nil
 }
 
 // Returns an authenticator object containing basic authentication credentials.
@@ -8,8 +8,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
@@ -20,6 +22,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -146,6 +149,209 @@ func TestNoFailedAssetsEmptyStatus(t *testing.T) {
 	}
 }
 
+// Test that events are recorded when the state of a stack version changes
+func TestRecordVersionTransitions(t *testing.T) {
+	stack := &kabanerov1alpha2.Stack{Spec: kabanerov1alpha2.StackSpec{Name: "nodejs"}}
+	previous := kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{
+		{Version: "0.2.5", Status: kabanerov1alpha2.StackDesiredStateActive},
+		{Version: "0.2.6", Status: kabanerov1alpha2.StackDesiredStateActive},
+	}}
+	current := kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{
+		{Version: "0.2.5", Status: kabanerov1alpha2.StackDesiredStateActive},
+		{Version: "0.2.6", Status: kabanerov1alpha2.StackDesiredStateInactive},
+		{Version: "0.3.0", Status: kabanerov1alpha2.StackDesiredStateActive},
+		{Version: "0.3.1", Status: kabanerov1alpha2.StackDesiredStateInactive},
+	}}
+
+	recorder := record.NewFakeRecorder(10)
+	recordVersionTransitions(recorder, stack, previous, current)
+	close(recorder.Events)
+
+	events := []string{}
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+
+	expected := []string{"Normal StackDeactivated Stack nodejs 0.2.6 was deactivated", "Normal StackActivated Stack nodejs 0.3.0 was activated"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatal(fmt.Sprintf("Expected events %v, but found %v", expected, events))
+	}
+}
+
+// Test that the version, parameters and images with their activation digest are made available to the manifests
+func TestVersionRenderingContext(t *testing.T) {
+	stack := kabanerov1alpha2.Stack{
+		Spec: kabanerov1alpha2.StackSpec{Name: "nodejs"},
+		Status: kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{{
+			Version: "0.3.0",
+			Images:  []kabanerov1alpha2.ImageStatus{{Id: "nodejs", Image: "docker.io/kabanero/nodejs", Digest: kabanerov1alpha2.ImageDigest{Activation: "abc"}}},
+		}}},
+	}
+	spec := kabanerov1alpha2.StackVersion{
+		Version:    "0.3.0",
+		Images:     []kabanerov1alpha2.Image{{Id: "nodejs", Image: "docker.io/kabanero/nodejs:0.3"}},
+		Parameters: map[string]string{"registry": "registry.example.com"},
+	}
+
+	imageDigests := make(map[string]imageDigestResult)
+	context := versionRenderingContext(nil, stack, spec, imageDigests, sctlog)
+
+	if context["StackVersion"] != "0.3.0" {
+		t.Fatal(fmt.Sprintf("Expected the stack version 0.3.0, but found %v", context["StackVersion"]))
+	}
+	if images := context["Images"].(map[string]string); images["nodejs"] != "docker.io/kabanero/nodejs@sha256:abc" {
+		t.Fatal(fmt.Sprintf("Expected the image to be referenced by its activation digest: %v", images))
+	}
+	if parameters := context["Parameters"].(map[string]string); parameters["registry"] != "registry.example.com" {
+		t.Fatal(fmt.Sprintf("Expected the registry parameter: %v", parameters))
+	}
+	if _, ok := imageDigests["0.3.0/docker.io/kabanero/nodejs"]; !ok {
+		t.Fatal(fmt.Sprintf("Expected the image digest to be cached: %v", imageDigests))
+	}
+}
+
+// Test that the Ready and Progressing conditions are set from the status of the stack versions
+func TestSetStackConditions(t *testing.T) {
+	status := kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{{Version: "0.2.5", Status: kabanerov1alpha2.StackStateError}}}
+	setStackConditions(&status, 3)
+
+	ready := utils.FindStatusCondition(status.Conditions, kabanerov1alpha2.ConditionTypeReady)
+	if ready == nil || ready.Status != kabanerov1alpha2.ConditionFalse || ready.Reason != "VersionError" || ready.ObservedGeneration != 3 {
+		t.Fatal(fmt.Sprintf("Stack should have a false Ready condition with reason VersionError: %v", status.Conditions))
+	}
+
+	status.Versions[0].Status = kabanerov1alpha2.StackDesiredStateCanary
+	status.Versions[0].Canary = &kabanerov1alpha2.StackCanaryStatus{Phase: kabanerov1alpha2.CanaryPhaseProgressing}
+	setStackConditions(&status, 4)
+
+	ready = utils.FindStatusCondition(status.Conditions, kabanerov1alpha2.ConditionTypeReady)
+	if ready.Status != kabanerov1alpha2.ConditionTrue || ready.ObservedGeneration != 4 {
+		t.Fatal(fmt.Sprintf("Stack should have a true Ready condition: %v", status.Conditions))
+	}
+
+	progressing := utils.FindStatusCondition(status.Conditions, kabanerov1alpha2.ConditionTypeProgressing)
+	if progressing == nil || progressing.Status != kabanerov1alpha2.ConditionTrue {
+		t.Fatal(fmt.Sprintf("Stack should have a true Progressing condition: %v", status.Conditions))
+	}
+}
+
+// Test that events are emitted when a stack image tag is re-pushed, and when its digest is restored.
+func TestRecordImageDigestDrift(t *testing.T) {
+	driftTime := metav1.Now()
+	imageStatus := func(digest kabanerov1alpha2.ImageDigest) kabanerov1alpha2.StackStatus {
+		return kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{{
+			Version: "0.2.6",
+			Status:  kabanerov1alpha2.StackDesiredStateActive,
+			Images:  []kabanerov1alpha2.ImageStatus{{Id: "java-microprofile", Image: "docker.io/kabanero/java-microprofile", Digest: digest}},
+		}}}
+	}
+
+	inSync := kabanerov1alpha2.ImageDigest{Activation: "abc", Current: "abc"}
+	drifted := kabanerov1alpha2.ImageDigest{Activation: "abc", Current: "def", DriftTime: &driftTime}
+	drifted2 := kabanerov1alpha2.ImageDigest{Activation: "abc", Current: "ghi", DriftTime: &driftTime}
+
+	tests := []struct {
+		previous kabanerov1alpha2.ImageDigest
+		current  kabanerov1alpha2.ImageDigest
+		reason   string
+	}{
+		{inSync, inSync, ""},
+		{inSync, drifted, "ImageDigestDrift"},
+		{drifted, drifted, ""},
+		{drifted, drifted2, "ImageDigestDrift"},
+		{drifted, inSync, "ImageDigestRestored"},
+	}
+
+	for i, test := range tests {
+		recorder := record.NewFakeRecorder(10)
+		r := &ReconcileStack{recorder: recorder}
+		stack := &kabanerov1alpha2.Stack{Status: imageStatus(test.current)}
+		r.recordImageDigestDrift(stack, imageStatus(test.previous))
+
+		select {
+		case event := <-recorder.Events:
+			if len(test.reason) == 0 || !strings.Contains(event, test.reason) {
+				t.Fatal(fmt.Sprintf("Test %v: unexpected event: %v", i, event))
+			}
+		default:
+			if len(test.reason) != 0 {
+				t.Fatal(fmt.Sprintf("Test %v: expected a %v event, but no event was emitted", i, test.reason))
+			}
+		}
+	}
+}
+
+// Test that the registry is only queried for the current digest once per check interval.
+func TestCheckImageDigestDriftInterval(t *testing.T) {
+	stack := kabanerov1alpha2.Stack{Spec: kabanerov1alpha2.StackSpec{Name: "java-microprofile"}}
+	curSpec := kabanerov1alpha2.StackVersion{Version: "0.2.6"}
+
+	// The lookup is skipped: the client is not used.
+	lastCheckTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	digest := kabanerov1alpha2.ImageDigest{Activation: "abc", Current: "abc", LastCheckTime: &lastCheckTime}
+	checked := checkImageDigestDrift(nil, stack, curSpec, "docker.io/kabanero/java-microprofile", digest, sctlog)
+	if !checked.LastCheckTime.Equal(&lastCheckTime) || checked.Current != "abc" {
+		t.Fatalf("The digest should not have been checked before the end of the check interval: %+v", checked)
+	}
+
+	// Once the interval elapsed, the lookup is attempted again.  The image cannot be parsed, so the previous
+	// digest is kept.
+	staleCheckTime := metav1.NewTime(time.Now().Add(-digestCheckInterval))
+	digest.LastCheckTime = &staleCheckTime
+	checked = checkImageDigestDrift(nil, stack, curSpec, "docker.io/kabanero/Java-Microprofile", digest, sctlog)
+	if checked.LastCheckTime.Equal(&staleCheckTime) || checked.Current != "abc" {
+		t.Fatalf("The digest should have been checked after the end of the check interval: %+v", checked)
+	}
+}
+
+// Test that active stacks with images are detected for periodic digest checks
+func TestActiveImages(t *testing.T) {
+	status := kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{{
+		Version: "0.2.6",
+		Status:  kabanerov1alpha2.StackDesiredStateInactive,
+		Images:  []kabanerov1alpha2.ImageStatus{{Id: "java-microprofile", Image: "docker.io/kabanero/java-microprofile"}},
+	}}}
+
+	if activeImages(status) {
+		t.Fatal("Inactive stack versions should not be checked for digest drift")
+	}
+
+	status.Versions[0].Status = kabanerov1alpha2.StackDesiredStateActive
+	if !activeImages(status) {
+		t.Fatal("Active stack versions with images should be checked for digest drift")
+	}
+}
+
+// Test that stacks are requeued after the shortest interval of the periodic checks that apply to them
+func TestPeriodicCheckInterval(t *testing.T) {
+	status := kabanerov1alpha2.StackStatus{Versions: []kabanerov1alpha2.StackVersionStatus{{
+		Version: "0.2.6",
+		Status:  kabanerov1alpha2.StackDesiredStateInactive,
+		Images:  []kabanerov1alpha2.ImageStatus{{Id: "java-microprofile", Image: "docker.io/kabanero/java-microprofile"}},
+	}}}
+
+	if interval := periodicCheckInterval(status); interval != 0 {
+		t.Fatalf("Inactive stack versions should not be checked periodically, but the interval is %v", interval)
+	}
+
+	status.Versions[0].Status = kabanerov1alpha2.StackDesiredStateActive
+	if interval := periodicCheckInterval(status); interval != digestCheckInterval {
+		t.Fatalf("Active stack versions with images should be checked after %v, but the interval is %v", digestCheckInterval, interval)
+	}
+
+	// The usage of the activated pipelines is checked more often than the image digests.
+	status.Versions[0].Pipelines = []kabanerov1alpha2.PipelineStatus{{
+		Name:         "default",
+		ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{{Name: "build-pipeline", Status: "active"}},
+	}}
+	if !activePipelines(status) {
+		t.Fatal("The stack version should have activated pipelines")
+	}
+	if interval := periodicCheckInterval(status); interval != usageCheckInterval {
+		t.Fatalf("Stack versions with activated pipelines should be checked after %v, but the interval is %v", usageCheckInterval, interval)
+	}
+}
+
 func TestImageActivationDigestInStackStatus(t *testing.T) {
 	v026Digest := "026abcde"
 	v027Digest := "027abcde"
@@ -203,7 +409,7 @@ func TestImageActivationDigestInStackStatus(t *testing.T) {
 	// Test 1. Stack with activation digest already set in status. Expectation: The same digest continues to be set.
 	stackResourceT1 := stackResource.DeepCopy()
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
-	err := reconcileActiveVersions(stackResourceT1, client, sctlog)
+	err := reconcileActiveVersions(stackResourceT1, client, nil, sctlog)
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
 	}
@@ -223,7 +429,7 @@ func TestImageActivationDigestInStackStatus(t *testing.T) {
 	stackResourceT2.Spec.Versions = append(stackResourceT2.Spec.Versions, stackVersion027T2)
 	stackResourceT2.Status.Versions = append(stackResourceT2.Status.Versions, stackVersion027StatusT2)
 
-	err = reconcileActiveVersions(stackResourceT2, client, sctlog)
+	err = reconcileActiveVersions(stackResourceT2, client, nil, sctlog)
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
 	}
@@ -330,7 +536,7 @@ func TestImageActivationDigestInStackStatus(t *testing.T) {
 	stackResourceT6.Spec.Versions[1].DesiredState = "inactive"
 
 	// Deactivate:
-	err = reconcileActiveVersions(stackResourceT6, client, sctlog)
+	err = reconcileActiveVersions(stackResourceT6, client, nil, sctlog)
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
 	}
@@ -344,7 +550,7 @@ func TestImageActivationDigestInStackStatus(t *testing.T) {
 	stackResourceT6.Spec.Versions[0].DesiredState = "active"
 	stackResourceT6.Spec.Versions[1].DesiredState = "active"
 
-	err = reconcileActiveVersions(stackResourceT6, client, sctlog)
+	err = reconcileActiveVersions(stackResourceT6, client, nil, sctlog)
 	if err == nil {
 		t.Fatal("An error should have been reported.")
 	} else if !(strings.Contains(err.Error(), "image") && strings.Contains(err.Error(), "invalid reference format")) {
@@ -550,7 +756,7 @@ func TestStackIDValidation(t *testing.T) {
 	invalidID := "java-microprofile-"
 	stackResource.Spec.Name = invalidID
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -563,7 +769,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id containing an upper case char.
 	invalidID = "java-Microprofile"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -576,7 +782,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id staritng with a number.
 	invalidID = "0-java-microprofile"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -589,7 +795,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id staritng with a dot char.
 	invalidID = "java-microprofile.1-0"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -602,7 +808,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id starting with invalid chars.
 	invalidID = "java#-microprofile@1-0"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -615,7 +821,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id containing a single '-'.
 	invalidID = "-"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -628,7 +834,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id containing a single number.
 	invalidID = "9"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -641,7 +847,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test invalid id with a length greater than 68 characters.
 	invalidID = "abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghij-69c"
 	stackResource.Spec.Name = invalidID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err == nil {
 		t.Fatal(fmt.Sprintf("An error was expected because stack id %v is invalid. No error was issued.", invalidID))
@@ -654,7 +860,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test a valid id containing multiple [a-z0-9-] chars.
 	validID := "j-m-1-2-3"
 	stackResource.Spec.Name = validID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal(fmt.Sprintf("An error was NOT expected. Stack Id: %v is valid. Error: %v", validID, err))
@@ -663,7 +869,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test a valid id containing several '-' chars.
 	validID = "n---0"
 	stackResource.Spec.Name = validID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal(fmt.Sprintf("An error was NOT expected. Stack Id: %v is valid. Error: %v", validID, err))
@@ -672,7 +878,7 @@ func TestStackIDValidation(t *testing.T) {
 	// Test a valid id containing only one valid char.
 	validID = "x"
 	stackResource.Spec.Name = validID
-	err = reconcileActiveVersions(&stackResource, client, sctlog)
+	err = reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal(fmt.Sprintf("An error was NOT expected. Stack Id: %v is valid. Error: %v", validID, err))
@@ -886,7 +1092,7 @@ func TestReconcileActiveVersionsInitial(t *testing.T) {
 
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1034,7 +1240,7 @@ func TestReconcileActiveVersionsUpgrade(t *testing.T) {
 		client.ObjectKey{Name: "java-microprofile-build-pipeline", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: myuid}},
 		client.ObjectKey{Name: "java-microprofile-old-asset", Namespace: "kabanero"}:      []metav1.OwnerReference{{UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1178,7 +1384,7 @@ func TestReconcileActiveVersionsDeactivate(t *testing.T) {
 		client.ObjectKey{Name: "java-microprofile-build-task", Namespace: "kabanero"}:     []metav1.OwnerReference{{UID: myuid}},
 		client.ObjectKey{Name: "java-microprofile-build-pipeline", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1259,7 +1465,7 @@ func TestReconcileActiveVersionsSharedAsset(t *testing.T) {
 		client.ObjectKey{Name: "java-microprofile-build-task", Namespace: "kabanero"}:     []metav1.OwnerReference{{UID: otheruid}},
 		client.ObjectKey{Name: "java-microprofile-build-pipeline", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: otheruid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1376,7 +1582,7 @@ func TestReconcileActiveVersionsSharedAssetDeactivate(t *testing.T) {
 		client.ObjectKey{Name: "java-microprofile-build-task", Namespace: "kabanero"}:     []metav1.OwnerReference{{UID: otheruid}, {UID: myuid}},
 		client.ObjectKey{Name: "java-microprofile-build-pipeline", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: otheruid}, {UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1466,7 +1672,7 @@ func TestReconcileActiveVersionsRecreatedDeletedAssets(t *testing.T) {
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{
 		client.ObjectKey{Name: "java-microprofile-build-task", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1578,7 +1784,7 @@ func TestReconcileActiveVersionsRecreatedDeletedAssetsNoManifest(t *testing.T) {
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{
 		client.ObjectKey{Name: "java-microprofile-build-task", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1684,7 +1890,7 @@ func TestReconcileActiveVersionsBadAsset(t *testing.T) {
 
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1731,6 +1937,12 @@ func TestReconcileActiveVersionsBadAsset(t *testing.T) {
 		t.Fatal(fmt.Sprintf("Did not find expected assets: %v", pipeline.ActiveAssets))
 	}
 
+	// Make sure the failed asset is reported by the Ready condition.
+	ready := utils.FindStatusCondition(stackResource.Status.Conditions, kabanerov1alpha2.ConditionTypeReady)
+	if ready == nil || ready.Status != kabanerov1alpha2.ConditionFalse || ready.Reason != "AssetsFailed" {
+		t.Fatal(fmt.Sprintf("Stack should have a false Ready condition with reason AssetsFailed: %v", stackResource.Status.Conditions))
+	}
+
 	// Make sure the client has the correct objects.
 	if len(client.objs) != 1 {
 		t.Fatal(fmt.Sprintf("Client map should have 1 entry, but has %v: %v", len(client.objs), client.objs))
@@ -1790,7 +2002,7 @@ func TestReconcileActiveVersionsWithTriggers(t *testing.T) {
 
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1945,7 +2157,7 @@ func TestReconcileActiveVersionsSkipCertVerify(t *testing.T) {
 
 	kubeClient := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
 
-	err := reconcileActiveVersions(&stackResource, kubeClient, sctlog)
+	err := reconcileActiveVersions(&stackResource, kubeClient, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -1979,7 +2191,7 @@ func TestReconcileActiveVersionsSkipCertVerify(t *testing.T) {
 	stackResource.Spec.Versions[0].Pipelines[0].Https.SkipCertVerification = true
 
 	kubeClient = unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
-	err = reconcileActiveVersions(&stackResource, kubeClient, sctlog)
+	err = reconcileActiveVersions(&stackResource, kubeClient, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -2067,7 +2279,7 @@ func TestReconcileActiveVersionsInternalTwoInitial(t *testing.T) {
 
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -2196,7 +2408,7 @@ func TestReconcileActiveVersionsInternalTwoInitialDiffPipelines(t *testing.T) {
 
 	client := unitTestClient{map[client.ObjectKey][]metav1.OwnerReference{}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -2337,7 +2549,7 @@ func TestReconcileActiveVersionsInternalTwoDeactivateOne(t *testing.T) {
 		client.ObjectKey{Name: "build-task-c3f28ffc", Namespace: "kabanero"}:     []metav1.OwnerReference{{UID: myuid}},
 		client.ObjectKey{Name: "build-pipeline-c3f28ffc", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
@@ -2482,7 +2694,7 @@ func TestReconcileActiveVersionsInternalTwoDeleteOne(t *testing.T) {
 		client.ObjectKey{Name: "build-task-c3f28ffc", Namespace: "kabanero"}:     []metav1.OwnerReference{{UID: myuid}},
 		client.ObjectKey{Name: "build-pipeline-c3f28ffc", Namespace: "kabanero"}: []metav1.OwnerReference{{UID: myuid}}}}
 
-	err := reconcileActiveVersions(&stackResource, client, sctlog)
+	err := reconcileActiveVersions(&stackResource, client, nil, sctlog)
 
 	if err != nil {
 		t.Fatal("Returned error: " + err.Error())
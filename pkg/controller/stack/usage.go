@@ -0,0 +1,187 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// The interval at which the use of the pipelines of active stack versions is refreshed.  Only the PipelineRuns in
+// the Kabanero namespace are watched, so this is how the use of the pipelines in the other target namespaces is
+// noticed.
+var usageCheckInterval = 15 * time.Minute
+
+// The label Tekton sets on a PipelineRun to the name of the pipeline it runs.
+const pipelineRunPipelineLabel = "tekton.dev/pipeline"
+
+// Sets the usage status of each stack version from the PipelineRuns that reference its activated pipelines.
+// The last run time is carried over from the previous status, so that it is kept after the PipelineRuns are
+// pruned, and after the version is deactivated.  If the PipelineRuns cannot be listed, the previous usage is kept.
+func reconcileUsage(c client.Reader, stackResource *kabanerov1alpha2.Stack, previousStatus kabanerov1alpha2.StackStatus, logger logr.Logger) {
+	runsByNamespace := make(map[string][]unstructured.Unstructured)
+	for i, version := range stackResource.Status.Versions {
+		var previous *kabanerov1alpha2.StackUsageStatus
+		for _, pv := range previousStatus.Versions {
+			if pv.Version == version.Version {
+				previous = pv.Usage
+				break
+			}
+		}
+
+		usage, err := getUsage(c, stackResource.GetNamespace(), version, previous, runsByNamespace)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("Unable to list the PipelineRuns of stack %v %v. The previous usage is kept.", stackResource.Spec.Name, version.Version))
+			usage = previous.DeepCopy()
+		}
+		stackResource.Status.Versions[i].Usage = usage
+	}
+}
+
+// Returns the usage of the activated pipelines of the input stack version, or nil if the version never had
+// activated pipelines.  The PipelineRuns listed in each namespace are cached in runsByNamespace, since the versions
+// of a stack often share their namespaces.
+func getUsage(c client.Reader, stackNamespace string, version kabanerov1alpha2.StackVersionStatus, previous *kabanerov1alpha2.StackUsageStatus, runsByNamespace map[string][]unstructured.Unstructured) (*kabanerov1alpha2.StackUsageStatus, error) {
+	pipelineNames := getPipelineNames(stackNamespace, version)
+	if len(pipelineNames) == 0 && previous == nil {
+		return nil, nil
+	}
+
+	// The usage is tracked from the first time the version is seen with activated pipelines.
+	now := metav1.Now()
+	usage := &kabanerov1alpha2.StackUsageStatus{TrackedSince: &now}
+	if previous != nil {
+		if previous.TrackedSince != nil {
+			usage.TrackedSince = previous.TrackedSince.DeepCopy()
+		}
+		if previous.LastRunTime != nil {
+			usage.LastRunTime = previous.LastRunTime.DeepCopy()
+		}
+	}
+
+	namespaces := sets.NewString()
+	for namespace, names := range pipelineNames {
+		runs, ok := runsByNamespace[namespace]
+		if !ok {
+			var err error
+			runs, err = listPipelineRuns(c, namespace)
+			if err != nil {
+				return nil, err
+			}
+			runsByNamespace[namespace] = runs
+		}
+
+		for _, run := range runs {
+			pipelineName, _, _ := unstructured.NestedString(run.Object, "spec", "pipelineRef", "name")
+			if !names[pipelineName] {
+				continue
+			}
+
+			namespaces.Insert(namespace)
+			created := run.GetCreationTimestamp()
+			if usage.LastRunTime == nil || usage.LastRunTime.Before(&created) {
+				usage.LastRunTime = &created
+			}
+
+			switch getPipelineRunSucceeded(run) {
+			case "True":
+				usage.SuccessfulRuns++
+			case "False":
+				usage.FailedRuns++
+			}
+		}
+	}
+
+	usage.Namespaces = namespaces.List()
+
+	return usage, nil
+}
+
+// Returns the names of the activated pipelines of the input stack version, by namespace.
+func getPipelineNames(stackNamespace string, version kabanerov1alpha2.StackVersionStatus) map[string]map[string]bool {
+	pipelineNames := make(map[string]map[string]bool)
+	for _, pipeline := range version.Pipelines {
+		for _, asset := range pipeline.ActiveAssets {
+			if asset.Kind != "Pipeline" {
+				continue
+			}
+
+			namespace := asset.Namespace
+			if len(namespace) == 0 {
+				namespace = stackNamespace
+			}
+			if pipelineNames[namespace] == nil {
+				pipelineNames[namespace] = make(map[string]bool)
+			}
+			pipelineNames[namespace][asset.Name] = true
+		}
+	}
+	return pipelineNames
+}
+
+// Returns the PipelineRuns in the input namespace.
+func listPipelineRuns(c client.Reader, namespace string) ([]unstructured.Unstructured, error) {
+	runs := &unstructured.UnstructuredList{}
+	runs.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "tekton.dev",
+		Version: "v1alpha1",
+		Kind:    "PipelineRunList",
+	})
+
+	err := c.List(context.TODO(), runs, client.InNamespace(namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	return runs.Items, nil
+}
+
+// Returns true if the status contains active versions with activated pipelines.
+func activePipelines(status kabanerov1alpha2.StackStatus) bool {
+	for _, version := range status.Versions {
+		if version.Status != kabanerov1alpha2.StackDesiredStateInactive && len(version.Pipelines) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a reconcile request for each stack in the namespace of the input PipelineRun that activated the
+// pipeline it runs.
+func pipelineRunStackRequests(c client.Client, a handler.MapObject) []reconcile.Request {
+	pipelineName := a.Meta.GetLabels()[pipelineRunPipelineLabel]
+	if len(pipelineName) == 0 {
+		return nil
+	}
+
+	stacks := &kabanerov1alpha2.StackList{}
+	err := c.List(context.TODO(), stacks, client.InNamespace(a.Meta.GetNamespace()))
+	if err != nil {
+		log.Error(err, fmt.Sprintf("Could not process the completion of PipelineRun %v", a.Meta.GetName()))
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, stack := range stacks.Items {
+		found := false
+		for _, version := range stack.Status.Versions {
+			if getPipelineNames(stack.GetNamespace(), version)[a.Meta.GetNamespace()][pipelineName] {
+				found = true
+				break
+			}
+		}
+		if found {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: stack.GetNamespace(), Name: stack.GetName()}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,135 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// Unit test client listing the PipelineRuns of a namespace, and the stacks.
+type usageTestClient struct {
+	unitTestClient
+	runs   []unstructured.Unstructured
+	stacks []kabanerov1alpha2.Stack
+	err    error
+}
+
+func (c usageTestClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	switch l := list.(type) {
+	case *unstructured.UnstructuredList:
+		for _, run := range c.runs {
+			if run.GetNamespace() == listOptions.Namespace {
+				l.Items = append(l.Items, run)
+			}
+		}
+	case *kabanerov1alpha2.StackList:
+		l.Items = c.stacks
+	}
+	return nil
+}
+
+func usageTestPipelineRun(namespace string, pipeline string, succeeded string, created time.Time) unstructured.Unstructured {
+	run := canaryTestPipelineRun(pipeline, succeeded, created)
+	run.SetNamespace(namespace)
+	run.SetLabels(map[string]string{pipelineRunPipelineLabel: pipeline})
+	return run
+}
+
+func usageTestStack() kabanerov1alpha2.Stack {
+	return kabanerov1alpha2.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero"},
+		Spec:       kabanerov1alpha2.StackSpec{Name: "java-microprofile"},
+		Status: kabanerov1alpha2.StackStatus{
+			Versions: []kabanerov1alpha2.StackVersionStatus{{
+				Version: "0.2.19",
+				Status:  kabanerov1alpha2.StackDesiredStateActive,
+				Pipelines: []kabanerov1alpha2.PipelineStatus{{
+					ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{
+						{Name: "build-pl-1234abcd", Kind: "Pipeline"},
+						{Name: "build-pl-1234abcd", Namespace: "team-a", Kind: "Pipeline"},
+						{Name: "build-task-1234abcd", Kind: "Task"},
+					},
+				}},
+			}, {
+				Version: "0.2.18",
+				Status:  kabanerov1alpha2.StackDesiredStateInactive,
+			}},
+		},
+	}
+}
+
+// Test that the PipelineRuns of the activated pipelines are aggregated into the version status.
+func TestReconcileUsage(t *testing.T) {
+	lastRun := time.Now().Add(-time.Hour).Truncate(time.Second)
+	idle := metav1.NewTime(time.Now().Add(-30 * 24 * time.Hour).Truncate(time.Second))
+
+	stackResource := usageTestStack()
+	previousStatus := *stackResource.Status.DeepCopy()
+	previousStatus.Versions[1].Usage = &kabanerov1alpha2.StackUsageStatus{LastRunTime: &idle, SuccessfulRuns: 3}
+
+	c := usageTestClient{runs: []unstructured.Unstructured{
+		usageTestPipelineRun("kabanero", "build-pl-1234abcd", "True", lastRun.Add(-time.Hour)),
+		usageTestPipelineRun("team-a", "build-pl-1234abcd", "False", lastRun),
+		usageTestPipelineRun("team-a", "build-pl-1234abcd", "Unknown", lastRun.Add(-time.Minute)),
+		usageTestPipelineRun("team-b", "build-pl-1234abcd", "True", time.Now()),
+		usageTestPipelineRun("kabanero", "deploy-pl-1234abcd", "True", time.Now()),
+	}}
+
+	reconcileUsage(c, &stackResource, previousStatus, sctlog)
+
+	usage := stackResource.Status.Versions[0].Usage
+	if usage == nil || usage.SuccessfulRuns != 1 || usage.FailedRuns != 1 || !usage.LastRunTime.Time.Equal(lastRun) {
+		t.Fatalf("Only the PipelineRuns of the activated pipelines should be counted: %+v", usage)
+	}
+	if len(usage.Namespaces) != 2 || usage.Namespaces[0] != "kabanero" || usage.Namespaces[1] != "team-a" {
+		t.Fatalf("The PipelineRuns should have run in namespaces kabanero and team-a: %v", usage.Namespaces)
+	}
+	if usage.TrackedSince == nil {
+		t.Fatalf("The time at which the usage started to be tracked should be set: %+v", usage)
+	}
+
+	// The last run time of the deactivated version is kept, but its PipelineRuns are gone.
+	usage = stackResource.Status.Versions[1].Usage
+	if usage == nil || !usage.LastRunTime.Equal(&idle) || usage.SuccessfulRuns != 0 {
+		t.Fatalf("The last run time of the inactive version should be kept: %+v", usage)
+	}
+
+	// If the PipelineRuns cannot be listed, the previous usage is kept.
+	previousStatus = *stackResource.Status.DeepCopy()
+	c.err = errors.New("pipelineruns is forbidden")
+	reconcileUsage(c, &stackResource, previousStatus, sctlog)
+	if usage = stackResource.Status.Versions[0].Usage; usage == nil || usage.FailedRuns != 1 {
+		t.Fatalf("The previous usage should be kept: %+v", usage)
+	}
+}
+
+// Test that a completed PipelineRun is mapped to the stacks that activated its pipeline.
+func TestPipelineRunStackRequests(t *testing.T) {
+	c := usageTestClient{stacks: []kabanerov1alpha2.Stack{usageTestStack()}}
+
+	run := usageTestPipelineRun("kabanero", "build-pl-1234abcd", "True", time.Now())
+	requests := pipelineRunStackRequests(c, handler.MapObject{Meta: &run, Object: &run})
+	if len(requests) != 1 || requests[0].Name != "java-microprofile" {
+		t.Fatalf("The PipelineRun should be mapped to stack java-microprofile: %v", requests)
+	}
+
+	run = usageTestPipelineRun("team-b", "build-pl-1234abcd", "True", time.Now())
+	requests = pipelineRunStackRequests(c, handler.MapObject{Meta: &run, Object: &run})
+	if len(requests) != 0 {
+		t.Fatalf("The pipeline is not activated in namespace team-b: %v", requests)
+	}
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+)
+
+// Matches a version comparator whose version may be missing its minor or patch components (i.e. >=0.2).
+var partialComparatorRegex = regexp.MustCompile(`^([<>=!]*)v?(\d+)(\.\d+)?(\.\d+)?(.*)$`)
+
+// StackFilter selects the stacks and stack versions imported from a repository index.
+type StackFilter struct {
+	include             map[string]semver.Range
+	exclude             map[string]semver.Range
+	latestPatchVersions int
+}
+
+// A stack version, identified by its stack id and version.
+type StackIdVersion struct {
+	Id      string
+	Version string
+}
+
+// Returns a stack filter for the input filter configuration, or an error if one of its ranges is not valid.
+func NewStackFilter(spec kabanerov1alpha2.StackFilterSpec) (*StackFilter, error) {
+	filter := &StackFilter{latestPatchVersions: spec.LatestPatchVersions}
+
+	var err error
+	filter.include, err = parseVersionRanges(spec.Include)
+	if err != nil {
+		return nil, fmt.Errorf("The include filter is not valid: %v", err)
+	}
+
+	filter.exclude, err = parseVersionRanges(spec.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("The exclude filter is not valid: %v", err)
+	}
+
+	if spec.LatestPatchVersions < 0 {
+		return nil, fmt.Errorf("The number of latest patch versions may not be negative: %v", spec.LatestPatchVersions)
+	}
+
+	return filter, nil
+}
+
+// Returns the input stack versions selected by the filter, in their original order.
+func (f *StackFilter) Filter(versions []StackIdVersion) []StackIdVersion {
+	selected := []StackIdVersion{}
+	for _, version := range versions {
+		if f.matches(version) {
+			selected = append(selected, version)
+		}
+	}
+
+	if f.latestPatchVersions == 0 {
+		return selected
+	}
+
+	// Keep the latest N patch versions of each major.minor version of a stack.
+	groups := make(map[string][]semver.Version)
+	for _, version := range selected {
+		v, err := semver.ParseTolerant(version.Version)
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%v:%v.%v", version.Id, v.Major, v.Minor)
+		groups[key] = append(groups[key], v)
+	}
+
+	latest := make(map[string]bool)
+	for key, group := range groups {
+		sort.Sort(sort.Reverse(semver.Versions(group)))
+		for i := 0; i < len(group) && i < f.latestPatchVersions; i++ {
+			latest[key+":"+group[i].String()] = true
+		}
+	}
+
+	result := []StackIdVersion{}
+	for _, version := range selected {
+		v, err := semver.ParseTolerant(version.Version)
+		if err != nil {
+			// Versions that are not semver cannot be ordered, and are kept.
+			result = append(result, version)
+			continue
+		}
+		if latest[fmt.Sprintf("%v:%v.%v:%v", version.Id, v.Major, v.Minor, v.String())] {
+			result = append(result, version)
+		}
+	}
+
+	return result
+}
+
+// Returns true if the stack version passes the include and exclude filters.
+func (f *StackFilter) matches(version StackIdVersion) bool {
+	if len(f.include) != 0 {
+		r, ok := f.include[version.Id]
+		if !ok || !inRange(r, version.Version) {
+			return false
+		}
+	}
+
+	if r, ok := f.exclude[version.Id]; ok && inRange(r, version.Version) {
+		return false
+	}
+
+	return true
+}
+
+// Returns true if the version is in the range. A nil range matches all versions, and a version that is not
+// semver only matches a nil range.
+func inRange(r semver.Range, version string) bool {
+	if r == nil {
+		return true
+	}
+
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return false
+	}
+
+	return r(v)
+}
+
+// Parses the input semver ranges, keyed by stack id.
+func parseVersionRanges(ranges map[string]string) (map[string]semver.Range, error) {
+	parsed := make(map[string]semver.Range)
+	for id, rangeString := range ranges {
+		r, err := ParseVersionRange(rangeString)
+		if err != nil {
+			return nil, fmt.Errorf("stack %v: %v", id, err)
+		}
+		parsed[id] = r
+	}
+	return parsed, nil
+}
+
+// Parses a semver range, such as ">=0.2 <0.3" or "0.2.x || >=1.0.0". Versions missing their minor or patch
+// components are completed with zeros. An empty range returns a nil range, matching all versions.
+func ParseVersionRange(rangeString string) (semver.Range, error) {
+	rangeString = strings.TrimSpace(rangeString)
+	if len(rangeString) == 0 || rangeString == "*" {
+		return nil, nil
+	}
+
+	parts := strings.Fields(rangeString)
+	for i, part := range parts {
+		if part == "||" {
+			continue
+		}
+		m := partialComparatorRegex.FindStringSubmatch(part)
+		if m == nil || len(m[5]) != 0 {
+			continue
+		}
+		minor := m[3]
+		if len(minor) == 0 {
+			minor = ".0"
+		}
+		patch := m[4]
+		if len(patch) == 0 {
+			patch = ".0"
+		}
+		parts[i] = m[1] + m[2] + minor + patch
+	}
+
+	r, err := semver.ParseRange(strings.Join(parts, " "))
+	if err != nil {
+		return nil, fmt.Errorf("%v is not a valid semver range: %v", rangeString, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+)
+
+var indexVersions = []StackIdVersion{
+	{"java-openliberty", "0.1.9"},
+	{"java-openliberty", "0.2.1"},
+	{"java-openliberty", "0.2.3"},
+	{"java-openliberty", "0.2.2"},
+	{"java-openliberty", "0.3.0"},
+	{"nodejs", "0.3.5"},
+	{"nodejs", "0.4.0"},
+	{"python-flask", "0.1.0"},
+}
+
+// Tests that partial versions are completed in semver ranges.
+func TestParseVersionRange(t *testing.T) {
+	r, err := ParseVersionRange(">=0.2 <0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inRange(r, "0.2.9") || inRange(r, "0.3.0") || inRange(r, "0.1.9") {
+		t.Fatal("The range >=0.2 <0.3 should only match 0.2.x versions")
+	}
+
+	r, err = ParseVersionRange("")
+	if err != nil || r != nil {
+		t.Fatal("An empty range should match all versions")
+	}
+
+	if _, err = ParseVersionRange(">=zero"); err == nil {
+		t.Fatal("An error should have been returned for an invalid range")
+	}
+}
+
+// Tests that stack versions are selected by the include and exclude filters.
+func TestStackFilterIncludeExclude(t *testing.T) {
+	filter, err := NewStackFilter(kabanerov1alpha2.StackFilterSpec{
+		Include: map[string]string{"java-openliberty": ">=0.2 <0.3", "nodejs": ""},
+		Exclude: map[string]string{"java-openliberty": "0.2.2", "nodejs": ">=0.4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []StackIdVersion{{"java-openliberty", "0.2.1"}, {"java-openliberty", "0.2.3"}, {"nodejs", "0.3.5"}}
+	if selected := filter.Filter(indexVersions); !reflect.DeepEqual(selected, expected) {
+		t.Fatalf("Expected %v, but found %v", expected, selected)
+	}
+}
+
+// Tests that only the latest patch versions of each major.minor version are selected.
+func TestStackFilterLatestPatchVersions(t *testing.T) {
+	filter, err := NewStackFilter(kabanerov1alpha2.StackFilterSpec{LatestPatchVersions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []StackIdVersion{{"java-openliberty", "0.1.9"}, {"java-openliberty", "0.2.3"}, {"java-openliberty", "0.2.2"}, {"java-openliberty", "0.3.0"}, {"nodejs", "0.3.5"}, {"nodejs", "0.4.0"}, {"python-flask", "0.1.0"}}
+	if selected := filter.Filter(indexVersions); !reflect.DeepEqual(selected, expected) {
+		t.Fatalf("Expected %v, but found %v", expected, selected)
+	}
+
+	if _, err := NewStackFilter(kabanerov1alpha2.StackFilterSpec{Exclude: map[string]string{"nodejs": "latest"}}); err == nil {
+		t.Fatal("An error should have been returned for an invalid exclude range")
+	}
+}
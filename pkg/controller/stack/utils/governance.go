@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blang/semver"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+)
+
+const (
+	// Label set by Appsody on deployed workloads identifying the stack the application was built from.
+	StackIdLabel = "stack.appsody.dev/id"
+
+	// Label set by Appsody on deployed workloads identifying the stack version the application was built from.
+	StackVersionLabel = "stack.appsody.dev/version"
+
+	// Annotation identifying the digest of the stack image the application was built from.
+	StackDigestAnnotation = "stack.appsody.dev/digest"
+
+	// The governance policy decision allowing the operation.
+	PolicyDecisionAllow = "allow"
+
+	// The governance policy decision allowing the operation, but reporting a violation.
+	PolicyDecisionWarn = "warn"
+
+	// The governance policy decision rejecting the operation.
+	PolicyDecisionReject = "reject"
+)
+
+// PolicyDecision is the outcome of applying the governance stack policy.
+type PolicyDecision struct {
+	Decision string
+	Reason   string
+}
+
+// Returns the stack policy in effect. If a policy was not configured, activeDigest is used.
+func EffectiveStackPolicy(policy string) string {
+	if len(policy) == 0 {
+		return kabanerov1alpha2.StackPolicyActiveDigest
+	}
+	return policy
+}
+
+// Returns the input digest without the algorithm prefix (i.e. sha256:).
+func NormalizeDigest(digest string) string {
+	return digest[strings.LastIndex(digest, ":")+1:]
+}
+
+// Applies the stack policy to a stack image whose activation digest was recorded.  The current digest is the
+// digest the registry is presently serving for the image's tag.
+// - strictDigest: A drifted digest is rejected.
+// - activeDigest: A drifted digest is reported as a warning.
+// - ignoreDigest and none: Digests are not compared.
+func EvaluateStackDigestDrift(policy string, image string, activationDigest string, currentDigest string) PolicyDecision {
+	policy = EffectiveStackPolicy(policy)
+	if policy == kabanerov1alpha2.StackPolicyNone || policy == kabanerov1alpha2.StackPolicyIgnoreDigest {
+		return PolicyDecision{Decision: PolicyDecisionAllow}
+	}
+
+	// Nothing to compare.
+	if len(activationDigest) == 0 || len(currentDigest) == 0 {
+		return PolicyDecision{Decision: PolicyDecisionAllow}
+	}
+
+	if NormalizeDigest(activationDigest) == NormalizeDigest(currentDigest) {
+		return PolicyDecision{Decision: PolicyDecisionAllow}
+	}
+
+	reason := fmt.Sprintf("The digest of image %v has drifted from its activation digest. Activation digest: %v. Current digest: %v. Stack policy: %v", image, activationDigest, currentDigest, policy)
+	if policy == kabanerov1alpha2.StackPolicyStrictDigest {
+		return PolicyDecision{Decision: PolicyDecisionReject, Reason: reason}
+	}
+
+	return PolicyDecision{Decision: PolicyDecisionWarn, Reason: reason}
+}
+
+// Applies the stack policy to a workload built from the stack identified by the input stack id, version
+// and stack image digest.
+//   - strictDigest: The workload must use an active stack version matching its version exactly, and its
+//     digest must match the activation digest of that version.
+//   - activeDigest: The workload must use a stack version for which an active version with the same
+//     major.minor exists.  A digest that does not match the activation digest of an active version of the
+//     stack with the same major.minor is rejected.
+//   - ignoreDigest: Same as activeDigest, but a digest mismatch is reported as a warning.
+//   - none: Workloads are not validated.
+//
+// Stack versions being rolled out as canaries are only considered active in their canary namespaces.
+func EvaluateWorkloadStack(policy string, stacks []kabanerov1alpha2.Stack, stackId string, version string, digest string, namespace string) PolicyDecision {
+	policy = EffectiveStackPolicy(policy)
+	if policy == kabanerov1alpha2.StackPolicyNone {
+		return PolicyDecision{Decision: PolicyDecisionAllow}
+	}
+
+	var stack *kabanerov1alpha2.Stack
+	for i, s := range stacks {
+		if s.Spec.Name == stackId || (len(s.Spec.Name) == 0 && s.Name == stackId) {
+			stack = &stacks[i]
+			break
+		}
+	}
+
+	if stack == nil {
+		return PolicyDecision{Decision: PolicyDecisionReject, Reason: fmt.Sprintf("Stack %v is not managed by Kabanero. Stack policy: %v", stackId, policy)}
+	}
+
+	// Find the active stack version the workload is governed by.
+	var activeVersion *kabanerov1alpha2.StackVersionStatus
+	for i, sv := range stack.Status.Versions {
+		if sv.Status != kabanerov1alpha2.StackDesiredStateActive && !isCanaryNamespace(sv, namespace) {
+			continue
+		}
+
+		var match bool
+		if policy == kabanerov1alpha2.StackPolicyStrictDigest {
+			match = sv.Version == version
+		} else {
+			match = sameMajorMinor(sv.Version, version)
+		}
+
+		if match {
+			activeVersion = &stack.Status.Versions[i]
+			break
+		}
+	}
+
+	if activeVersion == nil {
+		return PolicyDecision{Decision: PolicyDecisionReject, Reason: fmt.Sprintf("Stack %v %v does not match an active version of the stack. Stack policy: %v", stackId, version, policy)}
+	}
+
+	if len(digest) == 0 {
+		if policy == kabanerov1alpha2.StackPolicyStrictDigest {
+			return PolicyDecision{Decision: PolicyDecisionReject, Reason: fmt.Sprintf("The stack image digest used to build the workload from stack %v %v is unknown. Stack policy: %v", stackId, version, policy)}
+		}
+		return PolicyDecision{Decision: PolicyDecisionWarn, Reason: fmt.Sprintf("The stack image digest used to build the workload from stack %v %v is unknown. Stack policy: %v", stackId, version, policy)}
+	}
+
+	// The workload may have been built from another patch version than the active version, so the activation
+	// digests of all the active versions of the stack with the same major.minor are accepted, unless the policy
+	// is strictDigest.  The digests of inactive versions are not accepted, and the versions being rolled out as
+	// canaries only count in their canary namespaces.
+	for i, sv := range stack.Status.Versions {
+		if policy == kabanerov1alpha2.StackPolicyStrictDigest {
+			if &stack.Status.Versions[i] != activeVersion {
+				continue
+			}
+		} else if !sameMajorMinor(sv.Version, activeVersion.Version) || (sv.Status != kabanerov1alpha2.StackDesiredStateActive && !isCanaryNamespace(sv, namespace)) {
+			continue
+		}
+
+		for _, image := range sv.Images {
+			if len(image.Digest.Activation) != 0 && NormalizeDigest(image.Digest.Activation) == NormalizeDigest(digest) {
+				return PolicyDecision{Decision: PolicyDecisionAllow}
+			}
+		}
+	}
+
+	reason := fmt.Sprintf("The stack image digest %v used to build the workload does not match the activation digest of stack %v %v. Stack policy: %v", digest, stackId, activeVersion.Version, policy)
+	if policy == kabanerov1alpha2.StackPolicyIgnoreDigest {
+		return PolicyDecision{Decision: PolicyDecisionWarn, Reason: reason}
+	}
+
+	return PolicyDecision{Decision: PolicyDecisionReject, Reason: reason}
+}
+
+// Returns true if the input stack version is being rolled out as a canary in the input namespace.
+func isCanaryNamespace(sv kabanerov1alpha2.StackVersionStatus, namespace string) bool {
+	if sv.Status != kabanerov1alpha2.StackDesiredStateCanary || sv.Canary == nil {
+		return false
+	}
+
+	for _, canaryNamespace := range sv.Canary.Namespaces {
+		if canaryNamespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if both versions share the same major and minor semver components.
+func sameMajorMinor(v1 string, v2 string) bool {
+	sv1, err := semver.ParseTolerant(v1)
+	if err != nil {
+		return v1 == v2
+	}
+	sv2, err := semver.ParseTolerant(v2)
+	if err != nil {
+		return v1 == v2
+	}
+	return sv1.Major == sv2.Major && sv1.Minor == sv2.Minor
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var governedStacks = []kabanerov1alpha2.Stack{{
+	ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero"},
+	Spec:       kabanerov1alpha2.StackSpec{Name: "java-microprofile"},
+	Status: kabanerov1alpha2.StackStatus{
+		Versions: []kabanerov1alpha2.StackVersionStatus{{
+			Version: "0.2.5",
+			Status:  kabanerov1alpha2.StackDesiredStateActive,
+			Images: []kabanerov1alpha2.ImageStatus{{
+				Id:     "java-microprofile",
+				Image:  "docker.io/kabanero/java-microprofile",
+				Digest: kabanerov1alpha2.ImageDigest{Activation: "0123456789abcdef"},
+			}},
+		}, {
+			Version: "0.2.6",
+			Status:  kabanerov1alpha2.StackDesiredStateActive,
+			Images: []kabanerov1alpha2.ImageStatus{{
+				Id:     "java-microprofile",
+				Image:  "docker.io/kabanero/java-microprofile",
+				Digest: kabanerov1alpha2.ImageDigest{Activation: "0266abcdef012345"},
+			}},
+		}, {
+			Version: "0.1.0",
+			Status:  kabanerov1alpha2.StackDesiredStateInactive,
+		}, {
+			Version: "0.2.4",
+			Status:  kabanerov1alpha2.StackDesiredStateInactive,
+			Images: []kabanerov1alpha2.ImageStatus{{
+				Id:     "java-microprofile",
+				Image:  "docker.io/kabanero/java-microprofile",
+				Digest: kabanerov1alpha2.ImageDigest{Activation: "abcdef0123456789"},
+			}},
+		}, {
+			Version: "0.3.0",
+			Status:  kabanerov1alpha2.StackDesiredStateCanary,
+			Canary:  &kabanerov1alpha2.StackCanaryStatus{Phase: kabanerov1alpha2.CanaryPhaseProgressing, Namespaces: []string{"team-a"}},
+			Images: []kabanerov1alpha2.ImageStatus{{
+				Id:     "java-microprofile",
+				Image:  "docker.io/kabanero/java-microprofile",
+				Digest: kabanerov1alpha2.ImageDigest{Activation: "fedcba9876543210"},
+			}},
+		}},
+	},
+}}
+
+// Tests that image digest drift is evaluated according to the stack policy.
+func TestEvaluateStackDigestDrift(t *testing.T) {
+	tests := []struct {
+		policy     string
+		activation string
+		current    string
+		expected   string
+	}{
+		{kabanerov1alpha2.StackPolicyStrictDigest, "abc", "abc", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "abc", "sha256:abc", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "abc", "def", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "abc", "def", PolicyDecisionWarn},
+		{"", "abc", "def", PolicyDecisionWarn},
+		{kabanerov1alpha2.StackPolicyIgnoreDigest, "abc", "def", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyNone, "abc", "def", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "", "def", PolicyDecisionAllow},
+	}
+
+	for _, test := range tests {
+		result := EvaluateStackDigestDrift(test.policy, "docker.io/kabanero/java-microprofile", test.activation, test.current)
+		if result.Decision != test.expected {
+			t.Errorf("Policy %v, activation %v, current %v: expected decision %v, but got %v (%v)", test.policy, test.activation, test.current, test.expected, result.Decision, result.Reason)
+		}
+	}
+}
+
+// Tests that workloads are evaluated according to the stack policy.
+func TestEvaluateWorkloadStack(t *testing.T) {
+	tests := []struct {
+		policy   string
+		stackId  string
+		version  string
+		digest   string
+		expected string
+	}{
+		{kabanerov1alpha2.StackPolicyStrictDigest, "java-microprofile", "0.2.5", "sha256:0123456789abcdef", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "java-microprofile", "0.2.4", "0123456789abcdef", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "java-microprofile", "0.2.5", "", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "java-microprofile", "0.2.5", "fedcba", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.2.4", "0123456789abcdef", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.2.4", "abcdef0123456789", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyIgnoreDigest, "java-microprofile", "0.2.4", "abcdef0123456789", PolicyDecisionWarn},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.2.5", "0266abcdef012345", PolicyDecisionAllow},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.2.4", "fedcba", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.2.5", "fedcba9876543210", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyStrictDigest, "java-microprofile", "0.2.5", "abcdef0123456789", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.2.4", "", PolicyDecisionWarn},
+		{kabanerov1alpha2.StackPolicyActiveDigest, "java-microprofile", "0.1.0", "0123456789abcdef", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyIgnoreDigest, "java-microprofile", "0.2.9", "fedcba", PolicyDecisionWarn},
+		{kabanerov1alpha2.StackPolicyIgnoreDigest, "nodejs", "0.2.5", "fedcba", PolicyDecisionReject},
+		{kabanerov1alpha2.StackPolicyNone, "nodejs", "0.2.5", "fedcba", PolicyDecisionAllow},
+	}
+
+	for _, test := range tests {
+		result := EvaluateWorkloadStack(test.policy, governedStacks, test.stackId, test.version, test.digest, "team-b")
+		if result.Decision != test.expected {
+			t.Errorf("Policy %v, stack %v %v, digest %v: expected decision %v, but got %v (%v)", test.policy, test.stackId, test.version, test.digest, test.expected, result.Decision, result.Reason)
+		}
+	}
+}
+
+// Tests that stack versions being rolled out as canaries are only active in their canary namespaces.
+func TestEvaluateWorkloadStackCanary(t *testing.T) {
+	result := EvaluateWorkloadStack(kabanerov1alpha2.StackPolicyActiveDigest, governedStacks, "java-microprofile", "0.3.0", "fedcba9876543210", "team-a")
+	if result.Decision != PolicyDecisionAllow {
+		t.Errorf("A workload in a canary namespace should be allowed, but got %v (%v)", result.Decision, result.Reason)
+	}
+
+	result = EvaluateWorkloadStack(kabanerov1alpha2.StackPolicyActiveDigest, governedStacks, "java-microprofile", "0.3.0", "fedcba9876543210", "team-b")
+	if result.Decision != PolicyDecisionReject {
+		t.Errorf("A workload outside of the canary namespaces should be rejected, but got %v (%v)", result.Decision, result.Reason)
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+)
+
+// The annotation holding the reasons why versions of a stack were deactivated by the retention policy, as a JSON
+// object keyed by version.
+const DeactivationReasonsAnnotation = "kabanero.io/deactivation-reasons"
+
+// Returns an error if the input retention policy is not valid.
+func ValidateRetentionPolicy(spec kabanerov1alpha2.StackRetentionSpec) error {
+	if spec.MaxActiveVersions < 0 {
+		return fmt.Errorf("The maximum number of active stack versions may not be negative: %v", spec.MaxActiveVersions)
+	}
+	if spec.MaxIdleDays < 0 {
+		return fmt.Errorf("The maximum number of idle days of a stack version may not be negative: %v", spec.MaxIdleDays)
+	}
+	return nil
+}
+
+// Deactivates the versions of the input stack that the retention policy does not keep, and records why in the
+// stack annotations.  Only the versions without a desired state are deactivated, but the versions that are active
+// because their desired state says so count towards the maximum number of active versions.  Returns true if
+// the stack was changed.
+func ApplyRetentionPolicy(spec kabanerov1alpha2.StackRetentionSpec, stack *kabanerov1alpha2.Stack, now time.Time) bool {
+	reasons := make(map[string]string)
+
+	if spec.MaxActiveVersions > 0 {
+		type activeVersion struct {
+			index   int
+			version semver.Version
+		}
+		var active []activeVersion
+		for i, version := range stack.Spec.Versions {
+			if strings.EqualFold(version.DesiredState, kabanerov1alpha2.StackDesiredStateInactive) {
+				continue
+			}
+			v, err := semver.ParseTolerant(version.Version)
+			if err != nil {
+				continue
+			}
+			active = append(active, activeVersion{index: i, version: v})
+		}
+
+		sort.SliceStable(active, func(i, j int) bool { return active[i].version.GT(active[j].version) })
+		for _, av := range active[min(spec.MaxActiveVersions, len(active)):] {
+			version := stack.Spec.Versions[av.index]
+			if len(version.DesiredState) == 0 {
+				reasons[version.Version] = fmt.Sprintf("The stack version was deactivated by the retention policy, which keeps the %v newest versions active.", spec.MaxActiveVersions)
+			}
+		}
+	}
+
+	if spec.MaxIdleDays > 0 {
+		maxIdle := time.Duration(spec.MaxIdleDays) * 24 * time.Hour
+		for _, versionStatus := range stack.Status.Versions {
+			usage := versionStatus.Usage
+			if usage == nil || versionStatus.Status == kabanerov1alpha2.StackDesiredStateInactive {
+				continue
+			}
+
+			lastUse := usage.TrackedSince
+			if usage.LastRunTime != nil {
+				lastUse = usage.LastRunTime
+			}
+			if lastUse == nil || now.Sub(lastUse.Time) < maxIdle {
+				continue
+			}
+
+			for _, version := range stack.Spec.Versions {
+				if version.Version == versionStatus.Version && len(version.DesiredState) == 0 {
+					if _, ok := reasons[version.Version]; !ok {
+						reasons[version.Version] = fmt.Sprintf("The stack version was deactivated by the retention policy because its pipelines were not run in the last %v days.", spec.MaxIdleDays)
+					}
+				}
+			}
+		}
+	}
+
+	// Deactivate the versions, and keep the reasons of the versions that are still inactive.
+	changed := false
+	previousReasons := GetDeactivationReasons(*stack)
+	for i, version := range stack.Spec.Versions {
+		if _, ok := reasons[version.Version]; ok {
+			stack.Spec.Versions[i].DesiredState = kabanerov1alpha2.StackDesiredStateInactive
+			changed = true
+		} else if reason, ok := previousReasons[version.Version]; ok && strings.EqualFold(version.DesiredState, kabanerov1alpha2.StackDesiredStateInactive) {
+			reasons[version.Version] = reason
+		}
+	}
+
+	if len(reasons) != len(previousReasons) {
+		changed = true
+	}
+	for version, reason := range reasons {
+		if previousReasons[version] != reason {
+			changed = true
+		}
+	}
+	if changed {
+		setDeactivationReasons(stack, reasons)
+	}
+
+	return changed
+}
+
+// Returns the reasons why versions of the input stack were deactivated by the retention policy, keyed by version.
+func GetDeactivationReasons(stack kabanerov1alpha2.Stack) map[string]string {
+	reasons := make(map[string]string)
+	value, ok := stack.GetAnnotations()[DeactivationReasonsAnnotation]
+	if ok {
+		json.Unmarshal([]byte(value), &reasons)
+	}
+	return reasons
+}
+
+// Records the reasons why versions of the input stack were deactivated by the retention policy.  The annotation
+// is removed when there are no reasons.
+func setDeactivationReasons(stack *kabanerov1alpha2.Stack, reasons map[string]string) {
+	annotations := stack.GetAnnotations()
+	if len(reasons) == 0 {
+		delete(annotations, DeactivationReasonsAnnotation)
+		stack.SetAnnotations(annotations)
+		return
+	}
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	value, _ := json.Marshal(reasons)
+	annotations[DeactivationReasonsAnnotation] = string(value)
+	stack.SetAnnotations(annotations)
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
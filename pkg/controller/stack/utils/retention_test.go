@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func retentionTestStack(now time.Time) kabanerov1alpha2.Stack {
+	lastWeek := metav1.NewTime(now.Add(-7 * 24 * time.Hour))
+	lastMonth := metav1.NewTime(now.Add(-30 * 24 * time.Hour))
+	return kabanerov1alpha2.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero"},
+		Spec: kabanerov1alpha2.StackSpec{
+			Name: "java-microprofile",
+			Versions: []kabanerov1alpha2.StackVersion{
+				{Version: "0.2.9"},
+				{Version: "0.2.19"},
+				{Version: "0.2.10", DesiredState: kabanerov1alpha2.StackDesiredStateActive},
+				{Version: "0.2.8"},
+			},
+		},
+		Status: kabanerov1alpha2.StackStatus{
+			Versions: []kabanerov1alpha2.StackVersionStatus{
+				{Version: "0.2.9", Status: kabanerov1alpha2.StackDesiredStateActive, Usage: &kabanerov1alpha2.StackUsageStatus{TrackedSince: &lastMonth, LastRunTime: &lastWeek}},
+				{Version: "0.2.19", Status: kabanerov1alpha2.StackDesiredStateActive, Usage: &kabanerov1alpha2.StackUsageStatus{TrackedSince: &lastWeek}},
+				{Version: "0.2.10", Status: kabanerov1alpha2.StackDesiredStateActive, Usage: &kabanerov1alpha2.StackUsageStatus{TrackedSince: &lastMonth}},
+				{Version: "0.2.8", Status: kabanerov1alpha2.StackDesiredStateActive, Usage: &kabanerov1alpha2.StackUsageStatus{TrackedSince: &lastMonth}},
+			},
+		},
+	}
+}
+
+// Tests that only the newest versions are kept active, and that the versions with a desired state are not changed.
+func TestApplyRetentionPolicyMaxActiveVersions(t *testing.T) {
+	now := time.Now()
+	stack := retentionTestStack(now)
+
+	if !ApplyRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{MaxActiveVersions: 2}, &stack, now) {
+		t.Fatal("The stack should have been changed")
+	}
+
+	// 0.2.19 and 0.2.10 are the newest versions, and 0.2.10 has a desired state.
+	expected := []string{kabanerov1alpha2.StackDesiredStateInactive, "", kabanerov1alpha2.StackDesiredStateActive, kabanerov1alpha2.StackDesiredStateInactive}
+	for i, version := range stack.Spec.Versions {
+		if version.DesiredState != expected[i] {
+			t.Fatalf("Stack version %v should have desired state %q, but has %q", version.Version, expected[i], version.DesiredState)
+		}
+	}
+
+	reasons := GetDeactivationReasons(stack)
+	if len(reasons) != 2 || !strings.Contains(reasons["0.2.9"], "keeps the 2 newest versions") || len(reasons["0.2.8"]) == 0 {
+		t.Fatalf("The reasons of the deactivated versions should have been recorded: %v", reasons)
+	}
+
+	// Applying the same policy again does not change the stack.
+	if ApplyRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{MaxActiveVersions: 2}, &stack, now) {
+		t.Fatal("The stack should not have been changed")
+	}
+
+	// The reasons are dropped once the versions are activated again.
+	for i := range stack.Spec.Versions {
+		stack.Spec.Versions[i].DesiredState = kabanerov1alpha2.StackDesiredStateActive
+	}
+	if !ApplyRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{}, &stack, now) {
+		t.Fatal("The stack should have been changed")
+	}
+	if _, ok := stack.GetAnnotations()[DeactivationReasonsAnnotation]; ok {
+		t.Fatalf("The deactivation reasons should have been removed: %v", stack.GetAnnotations())
+	}
+}
+
+// Tests that the versions whose pipelines were not run recently are deactivated.
+func TestApplyRetentionPolicyMaxIdleDays(t *testing.T) {
+	now := time.Now()
+	stack := retentionTestStack(now)
+
+	if !ApplyRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{MaxIdleDays: 14}, &stack, now) {
+		t.Fatal("The stack should have been changed")
+	}
+
+	// 0.2.9 ran last week and 0.2.19 is tracked since last week, 0.2.10 has a desired state.
+	expected := []string{"", "", kabanerov1alpha2.StackDesiredStateActive, kabanerov1alpha2.StackDesiredStateInactive}
+	for i, version := range stack.Spec.Versions {
+		if version.DesiredState != expected[i] {
+			t.Fatalf("Stack version %v should have desired state %q, but has %q", version.Version, expected[i], version.DesiredState)
+		}
+	}
+
+	reasons := GetDeactivationReasons(stack)
+	if len(reasons) != 1 || !strings.Contains(reasons["0.2.8"], "not run in the last 14 days") {
+		t.Fatalf("The reason of the deactivated version should have been recorded: %v", reasons)
+	}
+}
+
+// Tests that negative retention values are rejected.
+func TestValidateRetentionPolicy(t *testing.T) {
+	if err := ValidateRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{MaxActiveVersions: 3, MaxIdleDays: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{MaxActiveVersions: -1}); err == nil {
+		t.Fatal("An error should have been returned for a negative maximum number of active versions")
+	}
+	if err := ValidateRetentionPolicy(kabanerov1alpha2.StackRetentionSpec{MaxIdleDays: -1}); err == nil {
+		t.Fatal("An error should have been returned for a negative maximum number of idle days")
+	}
+}
@@ -1,6 +1,8 @@
 package transforms
 
 import (
+	"strings"
+
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,3 +19,40 @@ func InjectOwnerReference(ownerReference metav1.OwnerReference) func(u *unstruct
 		return nil
 	}
 }
+
+// The annotation listing the UIDs of the owners of an object created in a different namespace than its
+// owners.  Owner references cannot cross namespaces, so these objects are owned through the annotation.
+const OwnersAnnotation = "kabanero.io/owners"
+
+// Records the owner in the owners annotation of the object, instead of in an owner reference.
+func InjectOwnerAnnotation(ownerReference metav1.OwnerReference) func(u *unstructured.Unstructured) error {
+	return func(u *unstructured.Unstructured) error {
+		SetAnnotationOwners(u, []string{string(ownerReference.UID)})
+		return nil
+	}
+}
+
+// Returns the UIDs listed in the owners annotation of the object.
+func AnnotationOwners(u *unstructured.Unstructured) []string {
+	owners := []string{}
+	for _, owner := range strings.Split(u.GetAnnotations()[OwnersAnnotation], ",") {
+		if len(owner) != 0 {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// Sets the owners annotation of the object.  The annotation is removed if there are no owners.
+func SetAnnotationOwners(u *unstructured.Unstructured, owners []string) {
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	if len(owners) == 0 {
+		delete(annotations, OwnersAnnotation)
+	} else {
+		annotations[OwnersAnnotation] = strings.Join(owners, ",")
+	}
+	u.SetAnnotations(annotations)
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"path"
 	"strings"
 	"unicode"
 
@@ -25,6 +26,14 @@ import (
 // Stack archive manifest.yaml
 type StackManifest struct {
 	Contents []StackContents `yaml:"contents,omitempty"`
+
+	// The renderer applied to the yaml files of the archive (directive or template).  Defaults to directive.
+	Renderer string `yaml:"renderer,omitempty"`
+
+	// The directory containing a kustomization: a base directory and an overlays directory, with an overlay
+	// per target namespace or Kabanero instance.  The files in this directory are only activated through the
+	// kustomization.
+	Kustomize string `yaml:"kustomize,omitempty"`
 }
 
 type StackContents struct {
@@ -40,8 +49,14 @@ type StackAsset struct {
 	Kind    string
 	Sha256  string
 	Yaml    unstructured.Unstructured
+
+	// The action requested by an "on deactivate" directive, if any.
+	OnDeactivate string
 }
 
+// Annotation set on the objects that should be left in place when the pipeline that created them is deactivated.
+const OnDeactivateAnnotation = "kabanero.io/on-deactivate"
+
 func DownloadToByte(c client.Client, namespace string, url string, gitRelease kabanerov1alpha2.GitReleaseInfo, skipCertVerification bool, reqLogger logr.Logger) ([]byte, error) {
 	var archiveBytes []byte
 	switch {
@@ -52,6 +67,17 @@ func DownloadToByte(c client.Client, namespace string, url string, gitRelease ka
 			return nil, err
 		}
 		archiveBytes = bytes
+	// Offline bundle:
+	case IsBundleUrl(url):
+		bundle, name, err := parseBundleUrl(url)
+		if err != nil {
+			return nil, err
+		}
+		bytes, err := GetBundleFile(c, namespace, bundle, name)
+		if err != nil {
+			return nil, err
+		}
+		archiveBytes = bytes
 	// HTTPS:
 	case len(url) != 0:
 		bytes, err := cache.GetFromCache(c, url, skipCertVerification)
@@ -134,7 +160,7 @@ func readBytesFromReader(size int64, r io.Reader) ([]byte, error) {
 //Read the manifests from a tar.gz archive
 //It would be better to use the manifest.yaml as the index, and check the signatures
 //For now, ignore manifest.yaml and return all other yaml files from the archive
-func decodeManifests(archive []byte, renderingContext map[string]interface{}, reqLogger logr.Logger) ([]StackAsset, error) {
+func decodeManifests(archive []byte, namespace string, renderingContext map[string]interface{}, reqLogger logr.Logger) ([]StackAsset, error) {
 	manifests := []StackAsset{}
 	var stackmanifest StackManifest
 
@@ -147,6 +173,7 @@ func decodeManifests(archive []byte, renderingContext map[string]interface{}, re
 	tarReader := tar.NewReader(gzReader)
 
 	foundManifest := false
+	chartDir := ""
 	var headers []string
 	for {
 		header, err := tarReader.Next()
@@ -173,15 +200,36 @@ func decodeManifests(archive []byte, renderingContext map[string]interface{}, re
 				return nil, err
 			}
 			foundManifest = true
+		default:
+			if dir, ok := helmChartDir(header.Name); ok {
+				chartDir = dir
+			}
 		}
 	}
 
 	reqLogger.Info(fmt.Sprintf("Header names: %v", strings.Join(headers, ",")))
 
+	// An archive without a manifest.yaml may be a packaged Helm chart.
+	if foundManifest != true && len(chartDir) != 0 {
+		return renderHelmChart(archive, chartDir, namespace, renderingContext, reqLogger)
+	}
+
 	if foundManifest != true {
 		return nil, fmt.Errorf("Error reading archive, unable to read manifest.yaml")
 	}
 
+	renderer, err := getActivationRenderer(stackmanifest.Renderer)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading archive manifest.yaml: %v", err)
+	}
+
+	var kustomize *kustomizeArchive
+	kustomizeDir := ""
+	if len(stackmanifest.Kustomize) != 0 {
+		kustomize = newKustomizeArchive(renderer, renderingContext)
+		kustomizeDir = path.Clean(strings.TrimPrefix(stackmanifest.Kustomize, "./")) + "/"
+	}
+
 	// Re-Read the archive and validate against archive manifest.yaml
 	r = bytes.NewReader(archive)
 	gzReader, err = gzip.NewReader(r)
@@ -228,7 +276,7 @@ func decodeManifests(archive []byte, renderingContext map[string]interface{}, re
 						}
 						copy(c_sum[:], decoded)
 						if b_sum != c_sum {
-							return nil, fmt.Errorf("Archive file: %v  manifest.yaml checksum: %x  did not match file checksum: %x", header.Name, c_sum, b_sum)
+							return nil, ManifestChecksumError{File: header.Name, Expected: c_sum, Actual: b_sum}
 						}
 						match = true
 					} else {
@@ -244,35 +292,89 @@ func decodeManifests(archive []byte, renderingContext map[string]interface{}, re
 				return nil, fmt.Errorf("File %v was found in the archive, but not in the manifest.yaml", header.Name)
 			}
 
+			// The files of the kustomization are processed when it is built.
+			if kustomize != nil && strings.HasPrefix(path.Clean(strings.TrimPrefix(header.Name, "./")), kustomizeDir) {
+				err = kustomize.addFile(header.Name, b, assetSumString)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
 			//Apply the Kabanero yaml directive processor
-			pmanifests, err := processManifest(b, renderingContext, header.Name, assetSumString)
+			pmanifests, err := processManifest(b, renderer, renderingContext, header.Name, assetSumString)
 			if (err != nil) && (err != io.EOF) {
 				return nil, fmt.Errorf("Error decoding %v: %v", header.Name, err.Error())
 			}
 			manifests = append(manifests, pmanifests...)
 		}
 	}
+
+	if kustomize != nil {
+		instanceName, _ := renderingContext["KabaneroName"].(string)
+		kmanifests, err := kustomize.buildOverlay(stackmanifest.Kustomize, namespace, instanceName)
+		if err != nil {
+			return nil, fmt.Errorf("Error building the kustomization: %v", err)
+		}
+		manifests = append(manifests, kmanifests...)
+	}
+
 	return manifests, nil
 }
 
-//Apply the Kabanero yaml directive processor
-func processManifest(b []byte, renderingContext map[string]interface{}, filename string, assetSumString string) ([]StackAsset, error) {
+// ManifestChecksumError is returned when the checksum of a file in a pipeline archive does not match the checksum
+// listed in the archive's manifest.yaml.
+type ManifestChecksumError struct {
+	File     string
+	Expected [32]byte
+	Actual   [32]byte
+}
+
+func (e ManifestChecksumError) Error() string {
+	return fmt.Sprintf("Archive file: %v  manifest.yaml checksum: %x  did not match file checksum: %x", e.File, e.Expected, e.Actual)
+}
+
+//Apply the renderer, then the Kabanero yaml directive processor
+func processManifest(b []byte, renderer ActivationRenderer, renderingContext map[string]interface{}, filename string, assetSumString string) ([]StackAsset, error) {
 	manifests := []StackAsset{}
+
+	// The directives found in the output of other renderers are processed as well.
+	if _, ok := renderer.(DirectiveProcessor); renderer != nil && !ok {
+		rb, err := renderer.Render(b, renderingContext)
+		if err != nil {
+			return manifests, fmt.Errorf("Error rendering %v: %v", filename, err.Error())
+		}
+		b = rb
+	}
+
 	s := &DirectiveProcessor{}
-	rb, err := s.Render(b, renderingContext)
+	documents, err := s.RenderDocuments(b, renderingContext)
 	if err != nil {
 		return manifests, fmt.Errorf("Error processing directives %v: %v", filename, err.Error())
 	}
 
-	decoder := yaml.NewYAMLToJSONDecoder(bytes.NewReader(rb))
-	out := unstructured.Unstructured{}
-	for err = decoder.Decode(&out); err == nil; {
-		gvk := out.GroupVersionKind()
-		manifests = append(manifests, StackAsset{Name: out.GetName(), Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Yaml: out, Sha256: assetSumString})
-		out = unstructured.Unstructured{}
-		err = decoder.Decode(&out)
+	for _, document := range documents {
+		decoder := yaml.NewYAMLToJSONDecoder(bytes.NewReader(document.Text))
+		out := unstructured.Unstructured{}
+		for err = decoder.Decode(&out); err == nil; {
+			gvk := out.GroupVersionKind()
+			if document.OnDeactivate == DeactivateActionRetain {
+				annotations := out.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[OnDeactivateAnnotation] = DeactivateActionRetain
+				out.SetAnnotations(annotations)
+			}
+			manifests = append(manifests, StackAsset{Name: out.GetName(), Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Yaml: out, Sha256: assetSumString, OnDeactivate: document.OnDeactivate})
+			out = unstructured.Unstructured{}
+			err = decoder.Decode(&out)
+		}
+		if err != io.EOF {
+			return manifests, err
+		}
 	}
-	return manifests, err
+	return manifests, io.EOF
 }
 
 type fileType string
@@ -286,6 +388,9 @@ func getPipelineFileType(pipelineStatus kabanerov1alpha2.PipelineStatus) (fileTy
 		return "", err
 	}
 	fileName := fileNameURL.Path
+	if fileNameURL.Scheme == BundleScheme {
+		fileName = fileNameURL.Fragment
+	}
 	if pipelineStatus.GitRelease.IsUsable() {
 		fileName = pipelineStatus.GitRelease.AssetName
 	}
@@ -300,11 +405,30 @@ func getPipelineFileType(pipelineStatus kabanerov1alpha2.PipelineStatus) (fileTy
 }
 
 func GetManifests(c client.Client, namespace string, pipelineStatus kabanerov1alpha2.PipelineStatus, renderingContext map[string]interface{}, skipCertVerification bool, reqLogger logr.Logger) ([]StackAsset, error) {
+	return GetVerifiedManifests(c, namespace, pipelineStatus, renderingContext, skipCertVerification, nil, reqLogger)
+}
+
+// Retrieves the manifests of a pipeline archive. If a signature verifier is provided, the detached signature
+// of the archive is verified before the archive content is processed.
+func GetVerifiedManifests(c client.Client, namespace string, pipelineStatus kabanerov1alpha2.PipelineStatus, renderingContext map[string]interface{}, skipCertVerification bool, verifier *SignatureVerifier, reqLogger logr.Logger) ([]StackAsset, error) {
+	return getManifestsForNamespace(c, namespace, namespace, pipelineStatus, renderingContext, skipCertVerification, verifier, reqLogger)
+}
+
+// Retrieves the manifests of a pipeline archive, and renders them for the input target namespace. The archive,
+// its signature, and the credentials used to retrieve them are read from the input namespace.
+func getManifestsForNamespace(c client.Client, namespace string, targetNamespace string, pipelineStatus kabanerov1alpha2.PipelineStatus, renderingContext map[string]interface{}, skipCertVerification bool, verifier *SignatureVerifier, reqLogger logr.Logger) ([]StackAsset, error) {
 	b, err := DownloadToByte(c, namespace, pipelineStatus.Url, pipelineStatus.GitRelease,skipCertVerification, reqLogger)
 	if err != nil {
 		return nil, err
 	}
 
+	if verifier != nil {
+		err = verifyPipelineSignature(c, namespace, pipelineStatus, b, skipCertVerification, verifier, reqLogger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	b_sum := sha256.Sum256(b)
 	var c_sum [32]byte
 	decoded, err := hex.DecodeString(pipelineStatus.Digest)
@@ -321,7 +445,7 @@ func GetManifests(c client.Client, namespace string, pipelineStatus kabanerov1al
 		if b_sum != c_sum {
 			return nil, fmt.Errorf("Index checksum: %x not match download checksum: %x for Pipeline Name %v", c_sum, b_sum, pipelineStatus.Name)
 		}
-		manifests, err := decodeManifests(b, renderingContext, reqLogger)
+		manifests, err := decodeManifests(b, targetNamespace, renderingContext, reqLogger)
 		if err != nil {
 			return nil, err
 		}
@@ -330,7 +454,7 @@ func GetManifests(c client.Client, namespace string, pipelineStatus kabanerov1al
 		if b_sum != c_sum {
 			reqLogger.Info(fmt.Sprintf("Index checksum: %x not match download checksum: %x for Pipeline Name %v", c_sum, b_sum, pipelineStatus.Name))
 		}
-		manifests, err := processManifest(b, renderingContext, pipelineStatus.Name, hex.EncodeToString(b_sum[:]))
+		manifests, err := processManifest(b, DirectiveProcessor{}, renderingContext, pipelineStatus.Name, hex.EncodeToString(b_sum[:]))
 		if (err != nil) && (err != io.EOF) {
 			return nil, err
 		}
@@ -339,3 +463,24 @@ func GetManifests(c client.Client, namespace string, pipelineStatus kabanerov1al
 
 	return nil, fmt.Errorf("Can not decode file type of file for Pipeline %v. Must be .tar.gz or .yaml.", pipelineStatus.Name)
 }
+
+// Retrieves the detached signature of a pipeline archive and verifies it. The signature is located by appending
+// the verifier's signature suffix to the archive URL or GitHub release asset name.
+func verifyPipelineSignature(c client.Client, namespace string, pipelineStatus kabanerov1alpha2.PipelineStatus, archive []byte, skipCertVerification bool, verifier *SignatureVerifier, reqLogger logr.Logger) error {
+	name := pipelineStatus.Url
+	url := pipelineStatus.Url
+	gitRelease := pipelineStatus.GitRelease
+	if gitRelease.IsUsable() {
+		name = gitRelease.AssetName
+		gitRelease.AssetName = gitRelease.AssetName + verifier.SignatureSuffix()
+	} else {
+		url = url + verifier.SignatureSuffix()
+	}
+
+	signature, err := DownloadToByte(c, namespace, url, gitRelease, skipCertVerification, reqLogger)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve the signature of pipeline archive %v: %v", name, err)
+	}
+
+	return verifier.Verify(fmt.Sprintf("pipeline archive %v", name), archive, signature)
+}
@@ -1,16 +1,23 @@
 package utils
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"testing"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -170,3 +177,232 @@ func TestCommTraceThirtyTwo(t *testing.T) {
 		t.Fatal(fmt.Sprintf("Trace of 9 bytes incorrect output: %v", out))
 	}
 }
+
+// Test that checksum failures are reported with their own event reason.
+func TestRecordManifestError(t *testing.T) {
+	recorder := record.NewFakeRecorder(2)
+	options := ActivationOptions{Recorder: recorder, EventObject: &kabanerov1alpha2.Stack{}}
+	pipeline := kabanerov1alpha2.PipelineStatus{Url: "https://github.com/kabanero-io/pipelines.tar.gz"}
+
+	recordManifestError(options, pipeline, ManifestChecksumError{File: "build-task.yaml"})
+	recordManifestError(options, pipeline, errors.New("not found"))
+
+	checksumEvent := <-recorder.Events
+	if !strings.HasPrefix(checksumEvent, "Warning ManifestChecksumFailed ") {
+		t.Fatalf("Expected a ManifestChecksumFailed event, but found: %v", checksumEvent)
+	}
+	errorEvent := <-recorder.Events
+	if !strings.HasPrefix(errorEvent, "Warning ManifestError ") {
+		t.Fatalf("Expected a ManifestError event, but found: %v", errorEvent)
+	}
+
+	// No recorder configured
+	recordManifestError(ActivationOptions{}, pipeline, errors.New("not found"))
+}
+
+// Test that the deactivate directives are carried over to the stack assets.
+func TestProcessManifestDeactivate(t *testing.T) {
+	b := []byte(`#Kabanero! on deactivate retain
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: shared-task
+---
+#Kabanero! on deactivate apply
+apiVersion: tekton.dev/v1alpha1
+kind: TaskRun
+metadata:
+  name: cleanup
+`)
+
+	manifests, err := processManifest(b, DirectiveProcessor{}, map[string]interface{}{}, "test.yaml", "")
+	if (err != nil) && (err != io.EOF) {
+		t.Fatal(err)
+	}
+	if len(manifests) != 2 {
+		t.Fatalf("Expected 2 manifests, but found %v: %v", len(manifests), manifests)
+	}
+	if manifests[0].Yaml.GetAnnotations()[OnDeactivateAnnotation] != DeactivateActionRetain {
+		t.Fatalf("Expected the retained asset to be annotated: %v", manifests[0].Yaml)
+	}
+	if manifests[1].OnDeactivate != DeactivateActionApply {
+		t.Fatalf("Expected the deactivate hook to be marked: %v", manifests[1])
+	}
+}
+
+// Creates a pipeline archive containing the input files, and a manifest.yaml listing them after the input fields.
+func createTestArchive(t *testing.T, fields string, files map[string]string) []byte {
+	manifest := fields + "\ncontents:\n"
+	for name := range files {
+		manifest = manifest + "- file: " + name + "\n"
+	}
+
+	entries := map[string]string{"manifest.yaml": manifest}
+	for name, content := range files {
+		entries[name] = content
+	}
+	return createTestTarGz(t, entries)
+}
+
+// Creates a .tar.gz file with the input files.
+func createTestTarGz(t *testing.T, entries map[string]string) []byte {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	for name, content := range entries {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tarWriter.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Test that the renderer requested by the manifest.yaml is applied to the archive files.
+func TestDecodeManifestsTemplateRenderer(t *testing.T) {
+	files := map[string]string{"tasks.yaml": `{{- range .TargetNamespaces }}
+---
+#Kabanero! on deactivate retain
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: {{ $.StackId }}-{{ . }}-task
+{{- end }}
+`}
+
+	context := map[string]interface{}{"StackId": "nodejs", "TargetNamespaces": []string{"dev", "test"}}
+	manifests, err := decodeManifests(createTestArchive(t, "renderer: "+RendererTemplate, files), "kabanero", context, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifests) != 2 || manifests[0].Name != "nodejs-dev-task" || manifests[1].Name != "nodejs-test-task" {
+		t.Fatalf("Expected a task per target namespace, but found: %v", manifests)
+	}
+	if manifests[1].OnDeactivate != DeactivateActionRetain {
+		t.Fatalf("Expected the directives in the template output to be processed: %v", manifests[1])
+	}
+
+	_, err = decodeManifests(createTestArchive(t, "renderer: unknown", files), "kabanero", context, logf.NullLogger{})
+	if err == nil || !strings.Contains(err.Error(), "Unknown renderer") {
+		t.Fatalf("Expected an unknown renderer error, but found: %v", err)
+	}
+}
+
+// Test that the overlay of the target namespace is built, and that the base is used otherwise.
+func TestDecodeManifestsKustomize(t *testing.T) {
+	files := map[string]string{
+		"kustomize/base/kustomization.yaml": `resources:
+- task.yaml
+`,
+		"kustomize/base/task.yaml": `#Kabanero! on activate substitute StackId for text 'STACK'
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: STACK-build-task
+spec:
+  steps:
+  - name: build
+    image: docker.io/kabanero/nodejs:0.3
+  - name: push
+    image: docker.io/buildah/buildah:latest
+`,
+		"kustomize/overlays/dev/kustomization.yaml": `resources:
+- ../../base
+namePrefix: dev-
+commonLabels:
+  environment: dev
+patchesStrategicMerge:
+- patch.yaml
+images:
+- name: docker.io/kabanero/nodejs
+  newName: registry.example.com/kabanero/nodejs
+`,
+		"kustomize/overlays/dev/patch.yaml": `#Kabanero! on activate substitute StackId for text 'STACK'
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: STACK-build-task
+spec:
+  steps:
+  - name: push
+    $patch: delete
+  - name: scan
+    image: docker.io/kabanero/scanner
+`,
+	}
+
+	context := map[string]interface{}{"StackId": "nodejs", "KabaneroName": "kabanero"}
+	archive := createTestArchive(t, "kustomize: kustomize", files)
+
+	manifests, err := decodeManifests(archive, "dev", context, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 || manifests[0].Name != "dev-nodejs-build-task" {
+		t.Fatalf("Expected the dev overlay to be built, but found: %v", manifests)
+	}
+
+	u := manifests[0].Yaml
+	if u.GetLabels()["environment"] != "dev" {
+		t.Fatalf("Expected the common labels to be set: %v", u.GetLabels())
+	}
+	steps, _, _ := unstructured.NestedSlice(u.Object, "spec", "steps")
+	if len(steps) != 2 {
+		t.Fatalf("Expected the push step to be removed and the scan step to be added: %v", steps)
+	}
+	if image := steps[0].(map[string]interface{})["image"]; image != "registry.example.com/kabanero/nodejs:0.3" {
+		t.Fatalf("Expected the image to be renamed, but found %v", image)
+	}
+
+	manifests, err = decodeManifests(archive, "kabanero", context, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 || manifests[0].Name != "nodejs-build-task" {
+		t.Fatalf("Expected the base to be built, but found: %v", manifests)
+	}
+}
+
+// Test that the bundle URLs identify the bundle and the file it holds.
+func TestBundleFileUrl(t *testing.T) {
+	bundles := []kabanerov1alpha2.BundleSpec{
+		{ConfigMap: kabanerov1alpha2.ConfigMapFileSpec{Name: "stacks-bundle", Key: "stacks.tar.gz"}},
+		{Path: "/var/kabanero/bundles/stacks.tar.gz"},
+	}
+
+	for _, bundle := range bundles {
+		u := BundleFileUrl(bundle, "./pipelines/default.tar.gz")
+		if !IsBundleUrl(u) {
+			t.Fatalf("Expected a bundle URL, but found: %v", u)
+		}
+
+		parsed, name, err := parseBundleUrl(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != bundle || name != "pipelines/default.tar.gz" {
+			t.Fatalf("Unexpected bundle %v and file %v parsed from %v", parsed, name, u)
+		}
+
+		fileType, err := getPipelineFileType(kabanerov1alpha2.PipelineStatus{Url: u})
+		if err != nil || fileType != tarGzType {
+			t.Fatalf("Expected the file type of the bundle file to be %v, but found: %v", tarGzType, fileType)
+		}
+	}
+
+	_, err := GetBundleFile(nil, "kabanero", kabanerov1alpha2.BundleSpec{Path: "/etc/passwd"}, "index.yaml")
+	if err == nil {
+		t.Fatal("Expected an error for a bundle outside of the bundle directory")
+	}
+}
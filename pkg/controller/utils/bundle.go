@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The URL scheme of the files held by an offline bundle.  The bundle location is the host and path of the
+	// URL, and the file is the fragment (i.e. bundle://configmap/stacks/bundle.tar.gz#pipelines/default.tar.gz).
+	BundleScheme = "bundle"
+
+	// The stack index of an offline bundle.
+	BundleIndexFile = "index.yaml"
+
+	// The image digests of an offline bundle.
+	BundleDigestsFile = "digests.yaml"
+
+	// The directory the volumes holding offline bundles are mounted in.  Bundles are only read from this directory.
+	BundleDir = "/var/kabanero/bundles"
+
+	// The default ConfigMap key holding an offline bundle.
+	defaultBundleKey = "bundle.tar.gz"
+
+	bundleConfigMapHost = "configmap"
+	bundleFileHost      = "file"
+)
+
+// The digests.yaml file of an offline bundle.
+type BundleDigests struct {
+	// The digests keyed by image reference, including the tag (i.e. docker.io/kabanero/nodejs:0.3.1: sha256:8f09...).
+	Images map[string]string `yaml:"images,omitempty"`
+}
+
+// The error returned when a file is not held by an offline bundle.
+type BundleFileNotFoundError struct {
+	Name string
+}
+
+func (e BundleFileNotFoundError) Error() string {
+	return fmt.Sprintf("File %v was not found in the bundle", e.Name)
+}
+
+// Returns the URL of a file held by an offline bundle.
+func BundleFileUrl(bundle kabanerov1alpha2.BundleSpec, name string) string {
+	u := url.URL{Scheme: BundleScheme, Fragment: path.Clean(strings.TrimPrefix(name, "./"))}
+	if len(bundle.ConfigMap.Name) != 0 {
+		key := bundle.ConfigMap.Key
+		if len(key) == 0 {
+			key = defaultBundleKey
+		}
+		u.Host = bundleConfigMapHost
+		u.Path = "/" + bundle.ConfigMap.Name + "/" + key
+	} else {
+		u.Host = bundleFileHost
+		u.Path = bundle.Path
+	}
+	return u.String()
+}
+
+// Returns true if the URL references a file held by an offline bundle.
+func IsBundleUrl(rawurl string) bool {
+	return strings.HasPrefix(rawurl, BundleScheme+"://")
+}
+
+// Returns the bundle and the name of the file referenced by a bundle URL.
+func parseBundleUrl(rawurl string) (kabanerov1alpha2.BundleSpec, string, error) {
+	bundle := kabanerov1alpha2.BundleSpec{}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return bundle, "", err
+	}
+
+	switch u.Host {
+	case bundleConfigMapHost:
+		parts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+		if len(parts) != 2 {
+			return bundle, "", fmt.Errorf("Invalid bundle URL: %v", rawurl)
+		}
+		bundle.ConfigMap = kabanerov1alpha2.ConfigMapFileSpec{Name: parts[0], Key: parts[1]}
+	case bundleFileHost:
+		bundle.Path = u.Path
+	default:
+		return bundle, "", fmt.Errorf("Invalid bundle URL: %v", rawurl)
+	}
+
+	return bundle, u.Fragment, nil
+}
+
+// Reads a file held by an offline bundle.  The bundle is read from a ConfigMap in the input namespace, or
+// from a volume mounted in the bundle directory.
+func GetBundleFile(c client.Client, namespace string, bundle kabanerov1alpha2.BundleSpec, name string) ([]byte, error) {
+	archive, err := readBundle(c, namespace, bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read bundle gzip: %v", err)
+	}
+	defer gzReader.Close()
+
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read bundle tar: %v", err)
+		}
+
+		if header.Typeflag == tar.TypeReg && path.Clean(strings.TrimPrefix(header.Name, "./")) == name {
+			return readBytesFromReader(header.Size, tarReader)
+		}
+	}
+
+	return nil, BundleFileNotFoundError{Name: name}
+}
+
+// Reads the gzipped tar archive of an offline bundle.
+func readBundle(c client.Client, namespace string, bundle kabanerov1alpha2.BundleSpec) ([]byte, error) {
+	if len(bundle.ConfigMap.Name) != 0 {
+		key := bundle.ConfigMap.Key
+		if len(key) == 0 {
+			key = defaultBundleKey
+		}
+
+		configMap := &corev1.ConfigMap{}
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: bundle.ConfigMap.Name}, configMap)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to retrieve bundle ConfigMap %v in namespace %v. Error: %v", bundle.ConfigMap.Name, namespace, err)
+		}
+
+		if data, ok := configMap.BinaryData[key]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("Bundle ConfigMap %v in namespace %v does not contain binary data key %v", bundle.ConfigMap.Name, namespace, key)
+	}
+
+	// Only the mounted bundle volumes are read.
+	bundlePath := path.Clean(bundle.Path)
+	if !strings.HasPrefix(bundlePath, BundleDir+"/") {
+		return nil, fmt.Errorf("The bundle %v is not in the %v directory", bundle.Path, BundleDir)
+	}
+
+	b, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read bundle %v. Error: %v", bundlePath, err)
+	}
+	return b, nil
+}
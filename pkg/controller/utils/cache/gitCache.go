@@ -12,6 +12,7 @@ import (
 	"github.com/google/go-github/v29/github"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
 	sutils "github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/metrics"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/secret"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/timer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -20,17 +21,8 @@ import (
 
 var gitCachelog = rlog.Log.WithName("gitcache")
 
-// Value in the cache map.  This contains the etag returned from the remote
-// server, which is used on subsequent requests to use the cached data.
-type gitCacheData struct {
-	assetId      int64
-	size         int
-	creationTime time.Time
-	lastUsed     time.Time
-	data         []byte
-}
-
-var gitCache = make(map[string]gitCacheData)
+// Initialization mutex
+var startGitPurgeTicker sync.Once
 
 // The Duration at which a cache entry will be purged.
 const gitPurgeDuration = 12 * time.Hour
@@ -38,9 +30,6 @@ const gitPurgeDuration = 12 * time.Hour
 // The amount of time between cache purge ticker cycles
 const gitTickerDuration = 30 * time.Minute
 
-// Mutex for concurrent map access
-var gitCacheLock sync.Mutex
-
 // Retrieves a stack index file content using GitHub APIs
 func GetStackDataUsingGit(c client.Client, gitRelease kabanerov1alpha2.GitReleaseInfo, skipCertVerification bool, namespace string, reqLogger logr.Logger) ([]byte, error) {
 
@@ -59,6 +48,30 @@ func GetStackDataUsingGit(c client.Client, gitRelease kabanerov1alpha2.GitReleas
 	return getReleaseAsset(gclient, release.Assets, gitRelease)
 }
 
+// Retrieves the content of a file located at a path in a Git repository at the configured commit or branch.
+// If a revision is not configured, the repository's default branch is used.
+func GetFileUsingGitRepo(c client.Client, gitRepo kabanerov1alpha2.GitRepoSpec, namespace string, reqLogger logr.Logger) ([]byte, error) {
+	// Get a Github client. The client is only configured using the hostname.
+	gclient, err := getGitClient(c, kabanerov1alpha2.GitReleaseInfo{Hostname: gitRepo.Hostname}, gitRepo.SkipCertVerification, namespace, reqLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &github.RepositoryContentGetOptions{Ref: gitRepo.Revision}
+	reader, err := gclient.Repositories.DownloadContents(context.Background(), gitRepo.Organization, gitRepo.Project, gitRepo.Path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to download file %v from Git repository %v/%v/%v at revision %v. Error: %v", gitRepo.Path, gitRepo.Hostname, gitRepo.Organization, gitRepo.Project, gitRepo.Revision, err)
+	}
+	defer reader.Close()
+
+	bytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read file %v from Git repository %v/%v/%v at revision %v. Error: %v", gitRepo.Path, gitRepo.Hostname, gitRepo.Organization, gitRepo.Project, gitRepo.Revision, err)
+	}
+
+	return bytes, nil
+}
+
 // Retrieves a Git client.
 func getGitClient(c client.Client, gitRelease kabanerov1alpha2.GitReleaseInfo, skipCertVerification bool, namespace string, reqLogger logr.Logger) (*github.Client, error) {
 	var client *github.Client
@@ -107,47 +120,43 @@ func getGitClient(c client.Client, gitRelease kabanerov1alpha2.GitReleaseInfo, s
 }
 
 func getReleaseAsset(gclient *github.Client, assets []github.ReleaseAsset, gitRelease kabanerov1alpha2.GitReleaseInfo) ([]byte, error) {
-	var indexBytes []byte
-
 	// Find the asset identified as repoConf.GitRelease.AssetName and download it.
 	for _, asset := range assets {
 		if asset.GetName() == gitRelease.AssetName {
 			path := fmt.Sprintf("%s:%s:%s:%s:%s", gitRelease.Hostname, gitRelease.Organization, gitRelease.Project, gitRelease.Release, gitRelease.AssetName)
 
 			// Return the cached data if it was found in the cache and the current/cached asset IDs match.
-			gitCacheLock.Lock()
-			cacheData, found := gitCache[path]
-			gitCacheLock.Unlock()
+			cacheData, found := getStore().get(metrics.CacheGit, path)
 			if found && isAssetUnchanged(cacheData, asset) {
 				gitCachelog.Info(fmt.Sprintf("Git data retrieved from cache. The data is associated with gitRelease containing: %v", path))
-				cacheData.lastUsed = time.Now()
-				return cacheData.data, nil
+				metrics.RecordCacheLookup(metrics.CacheGit, true)
+				metrics.RecordCacheEntryHit(metrics.CacheGit, path)
+				return cacheData.Body, nil
 			}
 
 			// The asset is being read for the first time or it was modified and is being read again.
+			metrics.RecordCacheLookup(metrics.CacheGit, false)
 			indexBytes, err := downloadReleaseAsset(gclient, gitRelease, asset)
 			if err != nil {
 				return nil, err
 			}
 
 			// Add downloaded data to cache if the data needed for caching is present.
-			gitCacheLock.Lock()
 			if asset.GetID() != 0 && (asset.GetCreatedAt() != github.Timestamp{}) && (asset.GetSize() != 0) {
-				startPurgeTicker.Do(func() {
+				startGitPurgeTicker.Do(func() {
 					timer.ScheduleWork(gitTickerDuration, gitCachelog, gitPurgeCache, gitPurgeDuration)
 				})
-				gitCache[path] = gitCacheData{assetId: asset.GetID(), creationTime: asset.GetCreatedAt().Time, size: asset.GetSize(), data: indexBytes, lastUsed: time.Now()}
+				getStore().put(cacheEntry{Cache: metrics.CacheGit, Key: path, AssetId: asset.GetID(), CreationTime: asset.GetCreatedAt().Time, AssetSize: asset.GetSize(), Body: indexBytes})
 				gitCachelog.Info(fmt.Sprintf("Git data cached. The data is associated with gitRelease containing: %v", path))
 			} else {
-				delete(gitCache, path)
+				getStore().remove(metrics.CacheGit, path)
 			}
-			gitCacheLock.Unlock()
 
-			break
+			return indexBytes, nil
 		}
 	}
 
-	return indexBytes, nil
+	return nil, nil
 }
 
 // Downloads a release asset.
@@ -167,21 +176,14 @@ func downloadReleaseAsset(gclient *github.Client, gitRelease kabanerov1alpha2.Gi
 }
 
 // Returns true if there is indication that the asset is unchanged. False, otherwise.
-func isAssetUnchanged(cacheData gitCacheData, asset github.ReleaseAsset) bool {
-	unchanged := (cacheData.assetId == asset.GetID()) &&
-		(cacheData.creationTime.Equal(asset.GetCreatedAt().Time)) &&
-		(cacheData.size == asset.GetSize())
+func isAssetUnchanged(cacheData cacheEntry, asset github.ReleaseAsset) bool {
+	unchanged := (cacheData.AssetId == asset.GetID()) &&
+		(cacheData.CreationTime.Equal(asset.GetCreatedAt().Time)) &&
+		(cacheData.AssetSize == asset.GetSize())
 	return unchanged
 }
 
 // Purges the git cache. This function is scheduled to execute by a timer scheduler.
 func gitPurgeCache(localPurgeDuration time.Duration) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-	for key, _ := range gitCache {
-		if time.Since(gitCache[key].lastUsed) > localPurgeDuration {
-			gitCachelog.Info("Purging Git cache entry: " + key)
-			delete(gitCache, key)
-		}
-	}
+	getStore().purge(metrics.CacheGit, localPurgeDuration)
 }
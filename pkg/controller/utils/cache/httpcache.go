@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/metrics"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/timer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	rlog "sigs.k8s.io/controller-runtime/pkg/log"
@@ -14,20 +17,6 @@ import (
 
 var cachelog = rlog.Log.WithName("httpcache")
 
-// Value in the cache map.  This contains the etag returned from the remote
-// server, which is used on subsequent requests to use the cached data.
-type cacheValue struct {
-	etag     string
-	date     string
-	body     []byte
-	lastUsed time.Time
-}
-
-// The cache is stored as a map.  We are storing the value as a struct
-// instead of a pointer because multiple threads will be using the values
-// concurrently.
-var httpCache = make(map[string]cacheValue)
-
 // Initialization mutex
 var startPurgeTicker sync.Once
 
@@ -37,9 +26,6 @@ const purgeDuration = 12 * time.Hour
 // The amount of time between cache purge ticker cycles
 const tickerDuration = 30 * time.Minute
 
-// Mutex for concurrent map access
-var cacheLock sync.Mutex
-
 // Returns the requested resource, either from the cache, or from the
 // remote server.  The cache is not meant to be a "high performance" or
 // "heavily concurrent" cache.
@@ -51,14 +37,23 @@ func GetFromCache(c client.Client, url string, skipCertVerify bool) ([]byte, err
 		return nil, err
 	}
 
-	// See if the object is in the cache.  Drop the lock after adding the
-	// header so we're not holding the lock around the HTTP request.
-	cacheLock.Lock()
-	cacheData, ok := httpCache[url]
-	cacheLock.Unlock()
+	// See if the object is in the cache.  If it has not expired yet, it is
+	// returned without contacting the server.  Otherwise, the validators are
+	// added to the request.
+	cacheData, ok := getStore().get(metrics.CacheHTTP, url)
+	if ok && time.Now().Before(cacheData.Expires) {
+		cachelog.Info(fmt.Sprintf("Retrieved from cache without revalidation: %v", url))
+		metrics.RecordCacheLookup(metrics.CacheHTTP, true)
+		metrics.RecordCacheEntryHit(metrics.CacheHTTP, url)
+		return cacheData.Body, nil
+	}
 	if ok {
-		req.Header.Add("If-None-Match", cacheData.etag)
-		req.Header.Add("If-Modified-Since", cacheData.date)
+		if len(cacheData.ETag) != 0 {
+			req.Header.Add("If-None-Match", cacheData.ETag)
+		}
+		if len(cacheData.Date) != 0 {
+			req.Header.Add("If-Modified-Since", cacheData.Date)
+		}
 	}
 
 	// Drive the request. Certificate validation is not disabled by default.
@@ -82,21 +77,24 @@ func GetFromCache(c client.Client, url string, skipCertVerify bool) ([]byte, err
 	defer resp.Body.Close()
 
 	// Check to see if we're going to use the cached data.
-	if resp.StatusCode == http.StatusNotModified {
+	if ok && resp.StatusCode == http.StatusNotModified {
 		cachelog.Info(fmt.Sprintf("Retrieved from cache: %v", url))
+		metrics.RecordCacheLookup(metrics.CacheHTTP, true)
+		metrics.RecordCacheEntryHit(metrics.CacheHTTP, url)
 
-		// Update the last used time so the entry does not get purged.
-		cacheData.lastUsed = time.Now()
-		cacheLock.Lock()
-		httpCache[url] = cacheData
-		cacheLock.Unlock()
+		// The server may have extended the lifetime of the entry.
+		if expires, cacheable := responseExpiration(resp.Header, time.Now()); cacheable && !expires.Equal(cacheData.Expires) {
+			cacheData.Expires = expires
+			getStore().put(cacheData)
+		}
 
-		return cacheData.body, nil
+		return cacheData.Body, nil
 	} else if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf(fmt.Sprintf("Could not retrieve the resource: %v. Http status code: %v", url, resp.StatusCode))
 	}
 
 	// We got some new data back.  Read it, and then see if we can cache it.
+	metrics.RecordCacheLookup(metrics.CacheHTTP, false)
 	r := resp.Body
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -104,34 +102,89 @@ func GetFromCache(c client.Client, url string, skipCertVerify bool) ([]byte, err
 	}
 
 	etag := resp.Header.Get("ETag")
-	date := resp.Header.Get("Date")
+	date := resp.Header.Get("Last-Modified")
+	if len(date) == 0 {
+		date = resp.Header.Get("Date")
+	}
+	expires, cacheable := responseExpiration(resp.Header, time.Now())
 
-	// Re-lock the cache before either adding or removing the response from it.
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-	if (len(etag) > 0) && (len(date) > 0) {
+	// Cache the response if it can be revalidated, or if it does not expire right away.
+	if cacheable && (((len(etag) > 0) && (len(date) > 0)) || time.Now().Before(expires)) {
 		// Before adding an entry to the cache, make sure the purge task is running.
 		startPurgeTicker.Do(func() {
 			timer.ScheduleWork(tickerDuration, cachelog, purgeCache, purgeDuration)
 		})
-		httpCache[url] = cacheValue{etag: etag, date: date, body: b, lastUsed: time.Now()}
+		getStore().put(cacheEntry{Cache: metrics.CacheHTTP, Key: url, ETag: etag, Date: date, Expires: expires, Body: b})
 		cachelog.Info(fmt.Sprintf("Stored to cache: %v", url))
 	} else {
-		// Take the entry out of the map if it's already there.
-		delete(httpCache, url)
+		// Take the entry out of the cache if it's already there.
+		getStore().remove(metrics.CacheHTTP, url)
 	}
 
 	return b, nil
 }
 
-// Purges the cache
-func purgeCache(localPurgeDuration time.Duration) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-	for key, _ := range httpCache {
-		if time.Since(httpCache[key].lastUsed) > localPurgeDuration {
-			cachelog.Info("Purging from cache: " + key)
-			delete(httpCache, key)
+// Returns the time until which a response can be used without revalidation, from its Cache-Control or Expires
+// header, and false if the response must not be stored.  All of the Cache-Control directives are read:
+//   - no-store: The response is not stored, whatever the other directives are.
+//   - no-cache: The response is stored, but is revalidated before each use.
+//   - max-age: The response is used until it is max-age seconds old, minus the Age it already had when it was
+//     received.  It takes precedence over the Expires header.
+//   - must-revalidate: The response is revalidated once it expires.  The cache never uses an expired response
+//     without revalidating it, so nothing else is needed.
+//   - private: The cache belongs to the operator only, so private responses are stored.
+func responseExpiration(header http.Header, now time.Time) (time.Time, bool) {
+	noCache := false
+	maxAge := -1
+	for _, directive := range strings.Split(strings.Join(header["Cache-Control"], ","), ",") {
+		name := strings.ToLower(strings.TrimSpace(directive))
+		value := ""
+		if i := strings.Index(name, "="); i >= 0 {
+			value = strings.Trim(strings.TrimSpace(name[i+1:]), "\"")
+			name = strings.TrimSpace(name[:i])
+		}
+
+		switch name {
+		case "no-store":
+			return time.Time{}, false
+		case "no-cache":
+			noCache = true
+		case "max-age":
+			seconds, err := strconv.Atoi(value)
+			if err == nil && seconds >= 0 {
+				maxAge = seconds
+			}
+		case "must-revalidate", "private":
+			// Honored as described above.
 		}
 	}
+
+	if noCache {
+		return time.Time{}, true
+	}
+
+	if maxAge >= 0 {
+		// The Age header holds the number of seconds the response spent in other caches before it was received.
+		age, err := strconv.Atoi(strings.TrimSpace(header.Get("Age")))
+		if err != nil || age < 0 {
+			age = 0
+		}
+		return now.Add(time.Duration(maxAge-age) * time.Second), true
+	}
+
+	// An invalid Expires header means the response has already expired.
+	if expires := header.Get("Expires"); len(expires) != 0 {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return time.Time{}, true
+		}
+		return t, true
+	}
+
+	return time.Time{}, true
+}
+
+// Purges the cache
+func purgeCache(localPurgeDuration time.Duration) {
+	getStore().purge(metrics.CacheHTTP, localPurgeDuration)
 }
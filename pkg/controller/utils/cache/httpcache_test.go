@@ -222,3 +222,37 @@ func TestCachePurge(t *testing.T) {
 		t.Fatalf("Wrong number of cache hits: %v", cacheHits)
 	}
 }
+
+// HTTP handler that allows the response to be cached for a minute.
+type MaxAgeHandler struct {
+	requests *int32
+}
+
+func (ch MaxAgeHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	*(ch.requests) += 1
+	rw.Header().Add("Cache-Control", "max-age=60")
+	rw.Write([]byte(theResponse))
+}
+
+// Show that a response is not revalidated until it expires.
+func TestCacheMaxAge(t *testing.T) {
+	var requests int32 = 0
+	handler := MaxAgeHandler{requests: &requests}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		data, err := GetFromCache(httpCacheTestClient{}, server.URL, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Compare([]byte(theResponse), data) != 0 {
+			t.Fatalf("Response %v not correct", i+1)
+		}
+	}
+
+	// Make sure that the server was only contacted once.
+	if requests != 1 {
+		t.Fatalf("Wrong number of requests: %v", requests)
+	}
+}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/metrics"
+)
+
+// The environment variable holding the maximum size of the cache, in bytes.
+const cacheMaxBytesEnv = "KABANERO_CACHE_MAX_BYTES"
+
+// The environment variable holding the directory the cache is persisted to.  The cache is only kept in memory
+// if it is not set.
+const cacheDirEnv = "KABANERO_CACHE_DIR"
+
+// The default maximum size of the cache.
+const defaultCacheMaxBytes = 64 * 1024 * 1024
+
+// The extension of the files holding the persisted cache entries.
+const cacheEntryExtension = ".entry"
+
+// An entry of the HTTP or Git cache.  The fields are exported so the entry can be persisted.
+type cacheEntry struct {
+	Cache string
+	Key   string
+	Body  []byte
+
+	// HTTP validators and expiration.
+	ETag    string
+	Date    string
+	Expires time.Time
+
+	// Git release asset validators.
+	AssetId      int64
+	AssetSize    int
+	CreationTime time.Time
+
+	LastUsed time.Time
+}
+
+// Returns the size of the entry counted against the cache limit.
+func (e *cacheEntry) size() int64 {
+	return int64(len(e.Body) + len(e.Key))
+}
+
+// A size-bounded cache shared by the HTTP and Git caches.  The least recently used entries are evicted when the
+// limit is exceeded.  If a directory is configured, the entries are written to it, and read back when the
+// process restarts.
+type store struct {
+	lock     sync.Mutex
+	maxBytes int64
+	dir      string
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+var sharedStore *store
+var sharedStoreInit sync.Once
+
+// Returns the cache shared by the process, configured from the environment on first use.
+func getStore() *store {
+	sharedStoreInit.Do(func() {
+		maxBytes := int64(defaultCacheMaxBytes)
+		if value, ok := os.LookupEnv(cacheMaxBytesEnv); ok {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				cachelog.Error(err, fmt.Sprintf("Invalid value for %v: %v. Using the default of %v bytes", cacheMaxBytesEnv, value, maxBytes))
+			} else {
+				maxBytes = parsed
+			}
+		}
+
+		sharedStore = newStore(maxBytes, os.Getenv(cacheDirEnv))
+	})
+	return sharedStore
+}
+
+func newStore(maxBytes int64, dir string) *store {
+	s := &store{maxBytes: maxBytes, dir: dir, lru: list.New(), entries: make(map[string]*list.Element)}
+	if len(dir) != 0 {
+		s.load()
+	}
+	return s
+}
+
+func storeKey(cache string, key string) string {
+	return cache + ":" + key
+}
+
+// Returns a copy of the entry, and marks it as used.
+func (s *store) get(cache string, key string) (cacheEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	element, ok := s.entries[storeKey(cache, key)]
+	if !ok {
+		return cacheEntry{}, false
+	}
+
+	s.lru.MoveToFront(element)
+	entry := element.Value.(*cacheEntry)
+	entry.LastUsed = time.Now()
+	return *entry, true
+}
+
+// Adds or replaces an entry, and evicts the least recently used entries if the cache is too large.  Entries
+// larger than the cache are not stored.
+func (s *store) put(entry cacheEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry.LastUsed = time.Now()
+	if entry.size() > s.maxBytes {
+		cachelog.Info(fmt.Sprintf("Not caching %v: its size exceeds the cache limit of %v bytes", entry.Key, s.maxBytes))
+		s.removeLocked(entry.Cache, entry.Key, "")
+		return
+	}
+
+	// A replaced entry keeps its metric series, so that its hits are not reset when it is revalidated.
+	s.unlinkLocked(entry.Cache, entry.Key)
+	s.insertLocked(&entry)
+	s.persist(&entry)
+	s.evictLocked()
+}
+
+// Removes an entry, if present.
+func (s *store) remove(cache string, key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removeLocked(cache, key, "")
+}
+
+// Removes the entries of the input cache that were not used for the input duration.
+func (s *store) purge(cache string, idle time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, element := range s.entries {
+		entry := element.Value.(*cacheEntry)
+		if entry.Cache == cache && time.Since(entry.LastUsed) > idle {
+			cachelog.Info(fmt.Sprintf("Purging from %v cache: %v", entry.Cache, entry.Key))
+			s.removeLocked(entry.Cache, entry.Key, metrics.CacheEvictionIdle)
+		}
+	}
+}
+
+func (s *store) insertLocked(entry *cacheEntry) {
+	s.entries[storeKey(entry.Cache, entry.Key)] = s.lru.PushFront(entry)
+	s.size += entry.size()
+	metrics.RecordCacheEntry(entry.Cache, entry.Key, len(entry.Body))
+	metrics.RecordCacheSize(s.size)
+}
+
+// Takes an entry out of the LRU list and the entry map, if present.  Returns false if the entry was not present.
+func (s *store) unlinkLocked(cache string, key string) bool {
+	element, ok := s.entries[storeKey(cache, key)]
+	if !ok {
+		return false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	s.lru.Remove(element)
+	delete(s.entries, storeKey(cache, key))
+	s.size -= entry.size()
+	return true
+}
+
+// Removes an entry.  If a reason is provided, the removal is recorded as an eviction.
+func (s *store) removeLocked(cache string, key string, reason string) {
+	if !s.unlinkLocked(cache, key) {
+		return
+	}
+
+	metrics.DeleteCacheEntry(cache, key)
+	metrics.RecordCacheSize(s.size)
+	if len(reason) != 0 {
+		metrics.RecordCacheEviction(cache, reason)
+	}
+
+	if len(s.dir) != 0 {
+		err := os.Remove(s.entryFile(cache, key))
+		if err != nil && !os.IsNotExist(err) {
+			cachelog.Error(err, fmt.Sprintf("Unable to remove the persisted cache entry for %v", key))
+		}
+	}
+}
+
+// Evicts the least recently used entries until the cache is within its limit.
+func (s *store) evictLocked() {
+	for s.size > s.maxBytes && s.lru.Len() != 0 {
+		entry := s.lru.Back().Value.(*cacheEntry)
+		cachelog.Info(fmt.Sprintf("Evicting from %v cache: %v", entry.Cache, entry.Key))
+		s.removeLocked(entry.Cache, entry.Key, metrics.CacheEvictionSize)
+	}
+}
+
+// Returns the file holding a persisted entry.  The file name is derived from the key, which may be a URL.
+func (s *store) entryFile(cache string, key string) string {
+	sum := sha256.Sum256([]byte(storeKey(cache, key)))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+cacheEntryExtension)
+}
+
+// Writes an entry to the cache directory.  The entry is written to a temporary file first, so a partially
+// written entry is never read back.  Failures are logged: the entry is still cached in memory.
+func (s *store) persist(entry *cacheEntry) {
+	if len(s.dir) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(entry)
+	if err == nil {
+		file := s.entryFile(entry.Cache, entry.Key)
+		err = ioutil.WriteFile(file+".tmp", buf.Bytes(), 0600)
+		if err == nil {
+			err = os.Rename(file+".tmp", file)
+		}
+	}
+	if err != nil {
+		cachelog.Error(err, fmt.Sprintf("Unable to persist the cache entry for %v in %v", entry.Key, s.dir))
+	}
+}
+
+// Reads the entries persisted in the cache directory.  Entries that cannot be read are removed.
+func (s *store) load() {
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		cachelog.Error(err, fmt.Sprintf("Unable to create the cache directory %v. The cache is not persisted", s.dir))
+		s.dir = ""
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+cacheEntryExtension))
+	if err != nil {
+		cachelog.Error(err, fmt.Sprintf("Unable to read the cache directory %v", s.dir))
+		return
+	}
+
+	loaded := []*cacheEntry{}
+	for _, file := range files {
+		entry := &cacheEntry{}
+		b, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = gob.NewDecoder(bytes.NewReader(b)).Decode(entry)
+		}
+		if err != nil {
+			cachelog.Error(err, fmt.Sprintf("Removing unreadable cache entry %v", file))
+			os.Remove(file)
+			continue
+		}
+		loaded = append(loaded, entry)
+	}
+
+	// Insert the least recently used entries first, so they are evicted first.
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].LastUsed.Before(loaded[j].LastUsed) })
+	for _, entry := range loaded {
+		s.insertLocked(entry)
+	}
+	s.evictLocked()
+
+	cachelog.Info(fmt.Sprintf("Loaded %v cache entries (%v bytes) from %v", s.lru.Len(), s.size, s.dir))
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/utils/metrics"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Test that the least recently used entries are evicted when the cache exceeds its limit.
+func TestStoreEviction(t *testing.T) {
+	s := newStore(20, "")
+	s.put(cacheEntry{Cache: "http", Key: "a", Body: []byte("12345678")})
+	s.put(cacheEntry{Cache: "http", Key: "b", Body: []byte("12345678")})
+
+	// Use "a", so that "b" is the least recently used entry.
+	if _, ok := s.get("http", "a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+
+	s.put(cacheEntry{Cache: "git", Key: "c", Body: []byte("12345678")})
+	if _, ok := s.get("http", "b"); ok {
+		t.Fatal("Expected b to be evicted")
+	}
+	if _, ok := s.get("http", "a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	if s.size != 18 {
+		t.Fatalf("Expected a cache size of 18 bytes, but found %v", s.size)
+	}
+
+	// Entries larger than the cache are not stored.
+	s.put(cacheEntry{Cache: "http", Key: "d", Body: make([]byte, 100)})
+	if _, ok := s.get("http", "d"); ok {
+		t.Fatal("Expected d not to be cached")
+	}
+}
+
+// Returns the number of hits recorded for the input cache entry.
+func cacheEntryHits(cache string, key string) float64 {
+	families, _ := ctrlmetrics.Registry.Gather()
+	for _, family := range families {
+		if family.GetName() != "kabanero_cache_entry_hits_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["cache"] == cache && labels["key"] == key {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+// Test that the hits of an entry are kept when the entry is replaced, and dropped when it is removed.
+func TestStoreEntryHits(t *testing.T) {
+	s := newStore(1024, "")
+	key := "https://example.com/hits/index.yaml"
+	s.put(cacheEntry{Cache: metrics.CacheHTTP, Key: key, ETag: "ABCDE", Body: []byte("index")})
+	metrics.RecordCacheEntryHit(metrics.CacheHTTP, key)
+	metrics.RecordCacheEntryHit(metrics.CacheHTTP, key)
+
+	// Revalidating the entry extends its lifetime.
+	entry, _ := s.get(metrics.CacheHTTP, key)
+	entry.Expires = time.Now().Add(time.Minute)
+	s.put(entry)
+	if hits := cacheEntryHits(metrics.CacheHTTP, key); hits != 2 {
+		t.Fatalf("Expected the 2 hits to be kept, but found %v", hits)
+	}
+
+	s.remove(metrics.CacheHTTP, key)
+	if hits := cacheEntryHits(metrics.CacheHTTP, key); hits != 0 {
+		t.Fatalf("Expected the hits to be removed with the entry, but found %v", hits)
+	}
+}
+
+// Test that the cache entries are read back from the cache directory.
+func TestStorePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newStore(1024, dir)
+	s.put(cacheEntry{Cache: "http", Key: "https://example.com/index.yaml", ETag: "ABCDE", Body: []byte("index")})
+	s.put(cacheEntry{Cache: "git", Key: "github.com:kabanero-io:stacks:0.1.0:index.yaml", AssetId: 42, Body: []byte("git index")})
+	s.remove("git", "github.com:kabanero-io:stacks:0.1.0:index.yaml")
+
+	restarted := newStore(1024, dir)
+	entry, ok := restarted.get("http", "https://example.com/index.yaml")
+	if !ok || entry.ETag != "ABCDE" || string(entry.Body) != "index" {
+		t.Fatalf("Expected the entry to be read back, but found: %v", entry)
+	}
+	if _, ok := restarted.get("git", "github.com:kabanero-io:stacks:0.1.0:index.yaml"); ok {
+		t.Fatal("Expected the removed entry not to be read back")
+	}
+}
+
+func TestResponseExpiration(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		header    http.Header
+		expires   time.Time
+		cacheable bool
+	}{
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, now.Add(time.Minute), true},
+		{http.Header{"Cache-Control": {"no-store"}}, time.Time{}, false},
+		{http.Header{"Cache-Control": {"no-cache"}, "Expires": {"Thu, 01 Jan 2099 00:00:00 GMT"}}, time.Time{}, true},
+		{http.Header{"Expires": {"Thu, 01 Jan 2099 00:00:00 GMT"}}, time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{http.Header{"Expires": {"0"}}, time.Time{}, true},
+		{http.Header{}, time.Time{}, true},
+		{http.Header{"Cache-Control": {"max-age=60, no-store"}}, time.Time{}, false},
+		{http.Header{"Cache-Control": {"max-age=60", "no-cache"}}, time.Time{}, true},
+		{http.Header{"Cache-Control": {"private, must-revalidate, max-age=60"}}, now.Add(time.Minute), true},
+		{http.Header{"Cache-Control": {"max-age=\"60\""}}, now.Add(time.Minute), true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, now.Add(40 * time.Second), true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Thu, 01 Jan 2099 00:00:00 GMT"}}, now.Add(time.Minute), true},
+	}
+
+	for _, test := range tests {
+		expires, cacheable := responseExpiration(test.header, now)
+		if !expires.Equal(test.expires) || cacheable != test.cacheable {
+			t.Fatalf("Unexpected expiration for %v: %v %v", test.header, expires, cacheable)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Sets the input condition in the list of conditions, replacing the condition of the same type. The last
+// transition time is only updated when the status of the condition changes.
+func SetStatusCondition(conditions *[]kabanerov1alpha2.Condition, condition kabanerov1alpha2.Condition) {
+	existing := FindStatusCondition(*conditions, condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		*conditions = append(*conditions, condition)
+		return
+	}
+
+	if existing.Status != condition.Status {
+		existing.Status = condition.Status
+		existing.LastTransitionTime = condition.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	existing.ObservedGeneration = condition.ObservedGeneration
+}
+
+// Returns the condition of the input type, or nil if it is not set.
+func FindStatusCondition(conditions []kabanerov1alpha2.Condition, conditionType string) *kabanerov1alpha2.Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// Removes the condition of the input type from the list of conditions.
+func RemoveStatusCondition(conditions *[]kabanerov1alpha2.Condition, conditionType string) {
+	newConditions := []kabanerov1alpha2.Condition{}
+	for _, condition := range *conditions {
+		if condition.Type != conditionType {
+			newConditions = append(newConditions, condition)
+		}
+	}
+	*conditions = newConditions
+}
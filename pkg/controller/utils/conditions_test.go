@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Test that the last transition time of a condition only changes with its status.
+func TestSetStatusCondition(t *testing.T) {
+	conditions := []kabanerov1alpha2.Condition{}
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	SetStatusCondition(&conditions, kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeReady, Status: kabanerov1alpha2.ConditionFalse, Reason: "Pending", LastTransitionTime: earlier})
+	if len(conditions) != 1 || !conditions[0].LastTransitionTime.Equal(&earlier) {
+		t.Fatalf("The condition should have been added: %+v", conditions)
+	}
+
+	SetStatusCondition(&conditions, kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeReady, Status: kabanerov1alpha2.ConditionFalse, Reason: "Failed", Message: "failure", ObservedGeneration: 2})
+	if len(conditions) != 1 || conditions[0].Reason != "Failed" || conditions[0].ObservedGeneration != 2 || !conditions[0].LastTransitionTime.Equal(&earlier) {
+		t.Fatalf("The condition should have been updated without changing its last transition time: %+v", conditions)
+	}
+
+	SetStatusCondition(&conditions, kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeReady, Status: kabanerov1alpha2.ConditionTrue, Reason: "Ready"})
+	if conditions[0].Status != kabanerov1alpha2.ConditionTrue || !conditions[0].LastTransitionTime.After(earlier.Time) {
+		t.Fatalf("The last transition time should have been updated with the status: %+v", conditions)
+	}
+
+	SetStatusCondition(&conditions, kabanerov1alpha2.Condition{Type: kabanerov1alpha2.ConditionTypeProgressing, Status: kabanerov1alpha2.ConditionFalse})
+	if len(conditions) != 2 || FindStatusCondition(conditions, kabanerov1alpha2.ConditionTypeProgressing) == nil {
+		t.Fatalf("A condition of a new type should have been added: %+v", conditions)
+	}
+
+	RemoveStatusCondition(&conditions, kabanerov1alpha2.ConditionTypeReady)
+	if len(conditions) != 1 || FindStatusCondition(conditions, kabanerov1alpha2.ConditionTypeReady) != nil {
+		t.Fatalf("The Ready condition should have been removed: %+v", conditions)
+	}
+}
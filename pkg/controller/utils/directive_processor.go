@@ -7,17 +7,124 @@ import (
 	"io"
 	"regexp"
 	"strings"
+
+	"github.com/blang/semver"
 )
 
-// The DirectiveProcessor processes text processing directives found in the yaml source
+// The actions that can be requested by an "on deactivate" directive.
+const (
+	// The document is not applied when the pipeline is activated, but when it is deactivated.
+	DeactivateActionApply = "apply"
+
+	// The object created from the document is left in place when the pipeline is deactivated.
+	DeactivateActionRetain = "retain"
+)
+
+// The DirectiveProcessor processes text processing directives found in the yaml source.  The supported
+// directives are:
+//
+//   #Kabanero! on activate substitute StackId for text '${stack-id}'
+//   #Kabanero! on activate include if StackVersion >= 0.3
+//   #Kabanero! on deactivate apply
+//   #Kabanero! on deactivate retain
+//
+// Substitutions apply to the whole file.  The other directives apply to the yaml document (delimited by
+// "---") in which they are found.
 type DirectiveProcessor struct {
 }
 
+// A yaml document rendered by the DirectiveProcessor.
+type RenderedDocument struct {
+	Text []byte
+
+	// The action requested by an "on deactivate" directive, if any.
+	OnDeactivate string
+}
+
+var directiveExpr = regexp.MustCompile(`\s?(#Kabanero!.*)$`)
+var textSubstitutionExpr = regexp.MustCompile(`#Kabanero!\son\sactivate\s(substitute\s(.+?)\s(for text)\s'(.+?)')`)
+var includeExpr = regexp.MustCompile(`#Kabanero!\s+on\s+activate\s+include\s+if\s+(\S+)\s+(==|!=|>=|<=|>|<|contains)\s+(.+?)\s*$`)
+var deactivateExpr = regexp.MustCompile(`#Kabanero!\s+on\s+deactivate\s+(\S+)\s*$`)
+var documentSeparatorExpr = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
 func (g DirectiveProcessor) Render(b []byte, context map[string]interface{}) ([]byte, error) {
-	//Search for directives
-	directiveExpr := regexp.MustCompile(`\s?(#Kabanero!.*)$`)
+	documents, err := g.RenderDocuments(b, context)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := []string{}
+	for _, document := range documents {
+		texts = append(texts, string(document.Text))
+	}
+
+	return []byte(strings.Join(texts, "\n---\n")), nil
+}
+
+// Renders the yaml documents found in the input.  Documents excluded by an "include if" directive are not
+// returned.
+func (g DirectiveProcessor) RenderDocuments(b []byte, context map[string]interface{}) ([]RenderedDocument, error) {
+	// Substitutions apply to every document in the file.
+	substitutions := make([]string, 0)
+	for _, directive := range findDirectives(string(b)) {
+		if textSubstitutionExpr.MatchString(directive) {
+			substitutions = append(substitutions, directive)
+		}
+	}
+
+	documents := make([]RenderedDocument, 0)
+	for _, text := range documentSeparatorExpr.Split(string(b), -1) {
+		document := RenderedDocument{}
+		included := true
+		for _, directive := range findDirectives(text) {
+			var err error
+			switch {
+			case textSubstitutionExpr.MatchString(directive):
+				// Applied below, once the document is known to be included.
+			case includeExpr.MatchString(directive):
+				var include bool
+				include, err = evaluateInclude(directive, context)
+				included = included && include
+			case deactivateExpr.MatchString(directive):
+				document.OnDeactivate, err = parseDeactivate(directive)
+			default:
+				err = fmt.Errorf("Unknown directive: %v", directive)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			text = strings.Replace(text, directive, "", 1)
+		}
+
+		if !included {
+			continue
+		}
+
+		for _, directive := range substitutions {
+			var err error
+			text, err = g.process_directive(directive, text, context)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		text = strings.TrimSpace(text)
+		if len(text) == 0 {
+			continue
+		}
+
+		document.Text = []byte(text)
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+// Returns the directives found in the input text.
+func findDirectives(text string) []string {
 	directives := make([]string, 0)
-	reader := bufio.NewReader(bytes.NewReader(b))
+	reader := bufio.NewReader(bytes.NewReader([]byte(text)))
 	for {
 		line, _, err := reader.ReadLine()
 
@@ -31,21 +138,11 @@ func (g DirectiveProcessor) Render(b []byte, context map[string]interface{}) ([]
 		}
 	}
 
-	text := string(b)
-	for _, directive := range directives {
-		var err error
-		text, err = g.process_directive(directive, text, context)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return []byte(text), nil
+	return directives
 }
 
 //process_directive processes an individual directive like: #Kabanero! on activate substitute StackName for text '${stack-name}'
 func (g DirectiveProcessor) process_directive(directive string, text string, context map[string]interface{}) (string, error) {
-	textSubstitutionExpr := regexp.MustCompile(`#Kabanero!\son\sactivate\s(substitute\s(.+?)\s(for text)\s'(.+?)')`)
 	if textSubstitutionExpr.MatchString(directive) {
 		groups := textSubstitutionExpr.FindStringSubmatch(directive)
 
@@ -61,16 +158,22 @@ func (g DirectiveProcessor) process_directive(directive string, text string, con
 			text = strings.Replace(text, directive, "", 1)
 			text = strings.TrimSpace(text)
 
-			_, ok := context[key]
+			contextValue, ok := lookupContextValue(context, key)
 			if !ok {
 				return "", fmt.Errorf("Unknown key: %v", key)
 			}
 
-			value, ok := context[key].(string)
-			if !ok {
+			// Lists, such as the target namespaces, are substituted as a comma separated string.
+			var value string
+			switch v := contextValue.(type) {
+			case string:
+				value = v
+			case []string:
+				value = strings.Join(v, ",")
+			default:
 				return "", fmt.Errorf("Invalid value for key: %v", key)
 			}
-			
+
 			text = strings.ReplaceAll(text, text_to_replace, value)
 
 			return text, nil
@@ -81,3 +184,97 @@ func (g DirectiveProcessor) process_directive(directive string, text string, con
 		return "", fmt.Errorf("Unknown directive: %v", directive)
 	}
 }
+
+// Returns the value of a key in the rendering context.  The entries of maps, such as the stack version
+// parameters, are referenced with a dotted key (i.e. Parameters.registry).
+func lookupContextValue(context map[string]interface{}, key string) (interface{}, bool) {
+	value, ok := context[key]
+	if ok {
+		return value, true
+	}
+
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	switch v := context[parts[0]].(type) {
+	case map[string]string:
+		value, ok = v[parts[1]]
+		return value, ok
+	case map[string]interface{}:
+		return lookupContextValue(v, parts[1])
+	}
+
+	return nil, false
+}
+
+// Evaluates a directive like: #Kabanero! on activate include if StackVersion >= 0.3
+// Versions are compared as semantic versions.  Lists, such as the target namespaces, only support "contains".
+func evaluateInclude(directive string, context map[string]interface{}) (bool, error) {
+	groups := includeExpr.FindStringSubmatch(directive)
+	key := groups[1]
+	operator := groups[2]
+	operand := strings.Trim(groups[3], `'"`)
+
+	value, ok := lookupContextValue(context, key)
+	if !ok {
+		return false, fmt.Errorf("Unknown key: %v", key)
+	}
+
+	switch v := value.(type) {
+	case []string:
+		if operator != "contains" {
+			return false, fmt.Errorf("Invalid operator %v for key: %v", operator, key)
+		}
+		for _, element := range v {
+			if element == operand {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		if operator == "contains" {
+			return strings.Contains(v, operand), nil
+		}
+
+		// Compare as versions if possible.  Otherwise only equality is supported.
+		left, leftErr := semver.ParseTolerant(v)
+		right, rightErr := semver.ParseTolerant(operand)
+		if leftErr != nil || rightErr != nil {
+			switch operator {
+			case "==":
+				return v == operand, nil
+			case "!=":
+				return v != operand, nil
+			}
+			return false, fmt.Errorf("Unable to compare %v with %v: the values are not versions", v, operand)
+		}
+
+		switch operator {
+		case "==":
+			return left.EQ(right), nil
+		case "!=":
+			return left.NE(right), nil
+		case ">=":
+			return left.GTE(right), nil
+		case "<=":
+			return left.LTE(right), nil
+		case ">":
+			return left.GT(right), nil
+		default:
+			return left.LT(right), nil
+		}
+	default:
+		return false, fmt.Errorf("Invalid value for key: %v", key)
+	}
+}
+
+// Parses a directive like: #Kabanero! on deactivate retain
+func parseDeactivate(directive string) (string, error) {
+	action := deactivateExpr.FindStringSubmatch(directive)[1]
+	if action != DeactivateActionApply && action != DeactivateActionRetain {
+		return "", fmt.Errorf("Unknown deactivate action: %v", action)
+	}
+	return action, nil
+}
@@ -159,3 +159,145 @@ spec:
 		})
 	}
 }
+
+func TestDirectiveProcessorDocuments(t *testing.T) {
+	provided := []byte(`
+#Kabanero! on activate substitute StackId for text 'StackId'
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: StackId-build-task
+---
+#Kabanero! on activate include if StackVersion >= 0.3
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: StackId-scan-task
+---
+#Kabanero! on activate include if StackVersion < 0.3
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: StackId-legacy-task
+---
+#Kabanero! on activate include if TargetNamespaces contains dev
+#Kabanero! on activate substitute TargetNamespaces for text 'TargetNamespaces'
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: StackId-deploy-task
+  annotations:
+    namespaces: TargetNamespaces
+---
+#Kabanero! on deactivate apply
+apiVersion: tekton.dev/v1alpha1
+kind: TaskRun
+metadata:
+  name: StackId-cleanup
+---
+#Kabanero! on deactivate retain
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: StackId-shared-task
+`)
+
+	context := map[string]interface{}{
+		"StackId":          "my-stack",
+		"StackVersion":     "0.3.1",
+		"TargetNamespaces": []string{"dev", "test"},
+	}
+
+	r := &DirectiveProcessor{}
+	documents, err := r.RenderDocuments(provided, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedNames := []string{"my-stack-build-task", "my-stack-scan-task", "my-stack-deploy-task", "my-stack-cleanup", "my-stack-shared-task"}
+	expectedActions := []string{"", "", "", DeactivateActionApply, DeactivateActionRetain}
+	if len(documents) != len(expectedNames) {
+		t.Fatalf("Expected %v documents, but found %v: %v", len(expectedNames), len(documents), documents)
+	}
+	for i, document := range documents {
+		text := string(document.Text)
+		if !strings.Contains(text, "name: "+expectedNames[i]) {
+			t.Fatalf("Expected document %v to be named %v: %v", i, expectedNames[i], text)
+		}
+		if strings.Contains(text, "#Kabanero!") {
+			t.Fatalf("Expected the directives to be removed from document %v: %v", i, text)
+		}
+		if document.OnDeactivate != expectedActions[i] {
+			t.Fatalf("Expected document %v to have deactivate action %v, but found %v", i, expectedActions[i], document.OnDeactivate)
+		}
+	}
+
+	if !strings.Contains(string(documents[2].Text), "namespaces: dev,test") {
+		t.Fatalf("Expected the target namespaces to be substituted: %v", string(documents[2].Text))
+	}
+}
+
+func TestDirectiveProcessorParameters(t *testing.T) {
+	provided := []byte(`
+#Kabanero! on activate substitute Parameters.registry for text 'REGISTRY'
+#Kabanero! on activate substitute Images.nodejs for text 'IMAGE'
+apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: build-task
+spec:
+  steps:
+  - name: build
+    image: IMAGE
+    args: ["--registry", "REGISTRY"]
+`)
+
+	context := map[string]interface{}{
+		"Parameters": map[string]string{"registry": "registry.example.com"},
+		"Images":     map[string]string{"nodejs": "docker.io/kabanero/nodejs@sha256:abc"},
+	}
+
+	r := &DirectiveProcessor{}
+	b_output, err := r.Render(provided, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := string(b_output)
+	if !strings.Contains(output, `args: ["--registry", "registry.example.com"]`) || !strings.Contains(output, "image: docker.io/kabanero/nodejs@sha256:abc") {
+		t.Fatal("Output did not match expectations", output)
+	}
+
+	_, err = r.Render([]byte("#Kabanero! on activate substitute Parameters.unknown for text 'X'\nkind: Task\n"), context)
+	if err == nil {
+		t.Fatal("Expected an error for an unknown parameter")
+	}
+}
+
+func TestDirectiveProcessorErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		directive string
+	}{
+		{name: "Unknown directive", directive: "#Kabanero! on activate remove"},
+		{name: "Unknown key", directive: "#Kabanero! on activate include if Unknown == 1"},
+		{name: "Unknown deactivate action", directive: "#Kabanero! on deactivate delete"},
+		{name: "Invalid list operator", directive: "#Kabanero! on activate include if TargetNamespaces >= dev"},
+		{name: "Invalid version", directive: "#Kabanero! on activate include if StackId >= 0.3"},
+	}
+
+	context := map[string]interface{}{
+		"StackId":          "my-stack",
+		"TargetNamespaces": []string{"dev"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &DirectiveProcessor{}
+			_, err := r.Render([]byte(tc.directive+"\nkind: Task\n"), context)
+			if err == nil {
+				t.Fatalf("Expected an error for directive: %v", tc.directive)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The maximum number of differences listed in the status message of a drifted asset.
+const maxDriftSummaryEntries = 5
+
+// Returns the differences between the rendered manifest of an asset and its live object. Only the fields
+// set in the rendered manifest are compared, so that values defaulted by the API server are not reported.
+// The object metadata and status are not compared.
+func FindAssetDrift(expected unstructured.Unstructured, live unstructured.Unstructured) []string {
+	diffs := []string{}
+	for _, key := range sortedKeys(expected.Object) {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		findDrift(key, expected.Object[key], live.Object[key], &diffs)
+	}
+	return diffs
+}
+
+// Compares the expected value with the live value and records the differences found.
+func findDrift(path string, expected interface{}, live interface{}, diffs *[]string) {
+	if live == nil && expected != nil {
+		*diffs = append(*diffs, fmt.Sprintf("%v: is missing", path))
+		return
+	}
+
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			*diffs = append(*diffs, fmt.Sprintf("%v: expected an object, found %v", path, live))
+			return
+		}
+		for _, key := range sortedKeys(e) {
+			findDrift(path+"."+key, e[key], l[key], diffs)
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(e) {
+			*diffs = append(*diffs, fmt.Sprintf("%v: expected %v item(s), found %v", path, len(e), len(l)))
+			return
+		}
+		for i := range e {
+			findDrift(fmt.Sprintf("%v[%v]", path, i), e[i], l[i], diffs)
+		}
+	default:
+		// Numbers may be decoded as different types, so compare their string representation.
+		if fmt.Sprint(expected) != fmt.Sprint(live) {
+			*diffs = append(*diffs, fmt.Sprintf("%v: expected %v, found %v", path, expected, live))
+		}
+	}
+}
+
+// Returns a summary of the differences found, suitable for a status message.
+func AssetDriftSummary(diffs []string) string {
+	summary := diffs
+	if len(diffs) > maxDriftSummaryEntries {
+		summary = append(append([]string{}, diffs[:maxDriftSummaryEntries]...), fmt.Sprintf("and %v more", len(diffs)-maxDriftSummaryEntries))
+	}
+	return "The asset was changed after it was activated: " + strings.Join(summary, "; ")
+}
+
+// Compares the live object of an activated asset with its rendered manifest, and updates the asset status.
+// Depending on the drift policy, changes are reverted or reported. In plan mode, the revert is recorded in
+// the plan instead.
+func reconcileAssetDrift(c client.Client, live *unstructured.Unstructured, manifests []StackAsset, assetStatus *kabanerov1alpha2.RepositoryAssetStatus, driftPolicy string, plan *ActivationPlan, logger logr.Logger) {
+	assetStatus.Status = AssetStatusActive
+	assetStatus.StatusMessage = ""
+
+	expected := findRenderedManifest(manifests, *assetStatus)
+	if expected == nil {
+		return
+	}
+
+	diffs := FindAssetDrift(*expected, *live)
+	if len(diffs) == 0 {
+		return
+	}
+
+	summary := AssetDriftSummary(diffs)
+	logger.Info(fmt.Sprintf("Asset %v in namespace %v drifted from its rendered manifest. %v", assetStatus.Name, assetStatus.Namespace, summary))
+
+	if !strings.EqualFold(driftPolicy, kabanerov1alpha2.AssetDriftPolicyRevert) {
+		assetStatus.Status = AssetStatusDrifted
+		assetStatus.StatusMessage = summary
+		return
+	}
+
+	if plan != nil {
+		plan.AddUpdate(plannedAssetFromStatus(*assetStatus, "The changes made to the asset would be reverted. "+summary))
+		return
+	}
+
+	copyRenderedContent(*expected, live)
+	err := c.Update(context.TODO(), live)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("Unable to revert the changes made to asset %v in namespace %v", assetStatus.Name, assetStatus.Namespace))
+		assetStatus.Status = AssetStatusDrifted
+		assetStatus.StatusMessage = fmt.Sprintf("%v. The changes could not be reverted: %v", summary, err)
+	}
+}
+
+// Updates the live object of an activated asset with its manifest, after the values the manifests are rendered
+// with changed.  The labels of the manifest are merged into those of the object, and the rest of the object
+// metadata, including its owners, is kept.  In plan mode, the update is recorded in the plan instead.
+func applyRenderedManifest(c client.Client, live *unstructured.Unstructured, manifests []StackAsset, assetStatus *kabanerov1alpha2.RepositoryAssetStatus, plan *ActivationPlan, logger logr.Logger) error {
+	expected := findRenderedManifest(manifests, *assetStatus)
+	if expected == nil {
+		return nil
+	}
+
+	diffs := FindAssetDrift(*expected, *live)
+	labels := live.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for key, value := range expected.GetLabels() {
+		if labels[key] != value {
+			diffs = append(diffs, fmt.Sprintf("metadata.labels.%v: expected %v, found %v", key, value, labels[key]))
+			labels[key] = value
+		}
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	if plan != nil {
+		plan.AddUpdate(plannedAssetFromStatus(*assetStatus, "The values the pipeline manifests are rendered with changed."))
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf("Updating asset %v in namespace %v with its rendered manifest", assetStatus.Name, assetStatus.Namespace))
+	copyRenderedContent(*expected, live)
+	live.SetLabels(labels)
+	return c.Update(context.TODO(), live)
+}
+
+// Returns the manifest of the input asset, or nil if the asset is not in the manifests.
+func findRenderedManifest(manifests []StackAsset, assetStatus kabanerov1alpha2.RepositoryAssetStatus) *unstructured.Unstructured {
+	for i := range manifests {
+		if manifests[i].Name == assetStatus.Name && manifests[i].Kind == assetStatus.Kind && manifests[i].OnDeactivate != DeactivateActionApply {
+			return &manifests[i].Yaml
+		}
+	}
+	return nil
+}
+
+// Copies the content of the rendered manifest, other than its metadata and status, into the live object.
+func copyRenderedContent(expected unstructured.Unstructured, live *unstructured.Unstructured) {
+	for _, key := range sortedKeys(expected.Object) {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		live.Object[key] = runtime.DeepCopyJSONValue(expected.Object[key])
+	}
+}
+
+// Returns the keys of the input map, sorted.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
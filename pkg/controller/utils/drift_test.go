@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Unit test client recording the objects updated.
+type driftTestClient struct {
+	archiveTestClient
+	updated *[]runtime.Object
+}
+
+func (c driftTestClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	*c.updated = append(*c.updated, obj)
+	return nil
+}
+
+func driftTestTask(image string, defaulted bool) unstructured.Unstructured {
+	step := map[string]interface{}{"name": "build", "image": image}
+	if defaulted {
+		step["resources"] = map[string]interface{}{}
+	}
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "tekton.dev/v1alpha1",
+		"kind":       "Task",
+		"metadata":   map[string]interface{}{"name": "build-task", "resourceVersion": "42"},
+		"spec": map[string]interface{}{
+			"steps": []interface{}{step},
+		},
+	}}
+}
+
+// Test that only the fields set in the rendered manifest are compared.
+func TestFindAssetDrift(t *testing.T) {
+	expected := driftTestTask("kabanero/builder:1.0", false)
+
+	if diffs := FindAssetDrift(expected, driftTestTask("kabanero/builder:1.0", true)); len(diffs) != 0 {
+		t.Fatalf("Defaulted fields should not be reported as drift: %v", diffs)
+	}
+
+	diffs := FindAssetDrift(expected, driftTestTask("kabanero/builder:evil", false))
+	if len(diffs) != 1 || !strings.HasPrefix(diffs[0], "spec.steps[0].image:") {
+		t.Fatalf("Unexpected drift: %v", diffs)
+	}
+
+	live := driftTestTask("kabanero/builder:1.0", false)
+	delete(live.Object, "spec")
+	if diffs := FindAssetDrift(expected, live); len(diffs) != 1 || diffs[0] != "spec: is missing" {
+		t.Fatalf("Unexpected drift: %v", diffs)
+	}
+}
+
+// Test that drift is reported or reverted depending on the drift policy.
+func TestReconcileAssetDrift(t *testing.T) {
+	manifests := []StackAsset{{Name: "build-task", Kind: "Task", Yaml: driftTestTask("kabanero/builder:1.0", false)}}
+
+	updated := []runtime.Object{}
+	c := driftTestClient{updated: &updated}
+
+	assetStatus := kabanerov1alpha2.RepositoryAssetStatus{Name: "build-task", Kind: "Task"}
+	live := driftTestTask("kabanero/builder:evil", false)
+	reconcileAssetDrift(c, &live, manifests, &assetStatus, kabanerov1alpha2.AssetDriftPolicyReport, nil, logf.NullLogger{})
+	if assetStatus.Status != AssetStatusDrifted || !strings.Contains(assetStatus.StatusMessage, "spec.steps[0].image") {
+		t.Fatalf("The drift should have been reported: %+v", assetStatus)
+	}
+	if len(updated) != 0 {
+		t.Fatal("The asset should not have been updated when the drift is reported")
+	}
+
+	plan := &ActivationPlan{}
+	reconcileAssetDrift(c, &live, manifests, &assetStatus, kabanerov1alpha2.AssetDriftPolicyRevert, plan, logf.NullLogger{})
+	if len(plan.Update) != 1 || len(updated) != 0 {
+		t.Fatalf("The revert should have been recorded in the plan: %+v", plan)
+	}
+
+	reconcileAssetDrift(c, &live, manifests, &assetStatus, kabanerov1alpha2.AssetDriftPolicyRevert, nil, logf.NullLogger{})
+	if assetStatus.Status != AssetStatusActive {
+		t.Fatalf("The asset should be active after the drift was reverted: %+v", assetStatus)
+	}
+	if len(updated) != 1 {
+		t.Fatal("The asset should have been updated to revert the drift")
+	}
+	if diffs := FindAssetDrift(manifests[0].Yaml, live); len(diffs) != 0 {
+		t.Fatalf("The reverted asset should match its rendered manifest: %v", diffs)
+	}
+	if live.GetResourceVersion() != "42" {
+		t.Fatal("The metadata of the reverted asset should be preserved")
+	}
+}
+
+// Test that an asset is updated with the manifest rendered with new values, and that its owners are kept.
+func TestApplyRenderedManifest(t *testing.T) {
+	expected := driftTestTask("kabanero/builder:2.0", false)
+	expected.SetLabels(map[string]string{"version": "2.0"})
+	manifests := []StackAsset{{Name: "build-task", Kind: "Task", Yaml: expected}}
+
+	updated := []runtime.Object{}
+	c := driftTestClient{updated: &updated}
+
+	assetStatus := kabanerov1alpha2.RepositoryAssetStatus{Name: "build-task", Kind: "Task"}
+	live := driftTestTask("kabanero/builder:1.0", false)
+	live.SetLabels(map[string]string{"version": "1.0", "team": "a"})
+	live.SetOwnerReferences([]metav1.OwnerReference{{Name: "java-microprofile", UID: "1"}, {Name: "nodejs", UID: "2"}})
+
+	plan := &ActivationPlan{}
+	if err := applyRenderedManifest(c, &live, manifests, &assetStatus, plan, logf.NullLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Update) != 1 || len(updated) != 0 {
+		t.Fatalf("The update should have been recorded in the plan: %+v", plan)
+	}
+
+	if err := applyRenderedManifest(c, &live, manifests, &assetStatus, nil, logf.NullLogger{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 1 || len(FindAssetDrift(expected, live)) != 0 {
+		t.Fatalf("The asset should have been updated with its rendered manifest: %v", live.Object)
+	}
+	if live.GetLabels()["version"] != "2.0" || live.GetLabels()["team"] != "a" || len(live.GetOwnerReferences()) != 2 {
+		t.Fatalf("The labels should have been merged, and the owners kept: %v", live.Object)
+	}
+
+	// An asset that matches its manifest is not updated.
+	if err := applyRenderedManifest(c, &live, manifests, &assetStatus, nil, logf.NullLogger{}); err != nil || len(updated) != 1 {
+		t.Fatalf("The asset should not have been updated again: %v", err)
+	}
+}
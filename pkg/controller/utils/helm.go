@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/logr"
+	yml "gopkg.in/yaml.v2"
+)
+
+// The rendering context key holding the values of a pipeline packaged as a Helm chart.
+const helmValuesKey = "HelmValues"
+
+// The annotation identifying Helm hooks.  Hooks are not activated.
+const helmHookAnnotation = "helm.sh/hook"
+
+// The maximum depth of nested includes, as in Helm.  A template including itself would otherwise exhaust the stack.
+const maxIncludeDepth = 1000
+
+// The Chart.yaml file of a Helm chart.  Only the fields used when rendering are read.
+type HelmChart struct {
+	Name         string        `yaml:"name,omitempty"`
+	Version      string        `yaml:"version,omitempty"`
+	AppVersion   string        `yaml:"appVersion,omitempty"`
+	Dependencies []interface{} `yaml:"dependencies,omitempty"`
+}
+
+// Returns the directory of the Helm chart packaged in the archive (i.e. mychart/Chart.yaml), if any.
+func helmChartDir(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	dir := path.Dir(name)
+	if path.Base(name) != "Chart.yaml" || dir == "." || strings.Contains(dir, "/") {
+		return "", false
+	}
+	return dir, true
+}
+
+// Renders the Helm chart packaged in the archive, in-process.  The values are read from the chart's values.yaml,
+// updated with the pipeline values (in the --set format), and the rendering context is available as
+// .Values.kabanero.  Charts with dependencies are not supported, and hooks, tests and NOTES.txt are skipped.
+func renderHelmChart(archive []byte, chartDir string, namespace string, renderingContext map[string]interface{}, reqLogger logr.Logger) ([]StackAsset, error) {
+	r := bytes.NewReader(archive)
+	gzReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read chart gzip")
+	}
+	tarReader := tar.NewReader(gzReader)
+
+	var chart HelmChart
+	values := make(map[string]interface{})
+	templates := make(map[string][]byte)
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Could not read chart tar")
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !strings.HasPrefix(name, chartDir+"/") || header.Typeflag == tar.TypeDir {
+			continue
+		}
+		name = strings.TrimPrefix(name, chartDir+"/")
+
+		switch {
+		case name == "Chart.yaml", name == "values.yaml", strings.HasPrefix(name, "templates/"):
+			b, err := readBytesFromReader(header.Size, tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading chart %v: %v", header.Name, err.Error())
+			}
+
+			switch {
+			case name == "Chart.yaml":
+				err = yml.Unmarshal(b, &chart)
+			case name == "values.yaml":
+				var v interface{}
+				err = yml.Unmarshal(b, &v)
+				if m, ok := normalizeHelmValue(v).(map[string]interface{}); ok {
+					values = m
+				}
+			default:
+				templates[name] = b
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Error reading chart %v: %v", header.Name, err.Error())
+			}
+		case name == "requirements.yaml", strings.HasPrefix(name, "charts/"):
+			return nil, fmt.Errorf("Chart %v has dependencies, which are not supported", chartDir)
+		}
+	}
+
+	if len(chart.Name) == 0 {
+		return nil, fmt.Errorf("Chart %v does not have a name in its Chart.yaml", chartDir)
+	}
+
+	if len(chart.Dependencies) != 0 {
+		return nil, fmt.Errorf("Chart %v has dependencies, which are not supported", chartDir)
+	}
+
+	// Apply the pipeline values, in a predictable order.
+	setValues, _ := renderingContext[helmValuesKey].(map[string]string)
+	keys := make([]string, 0, len(setValues))
+	for key := range setValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := setHelmValue(values, key, setValues[key])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kabanero := make(map[string]interface{})
+	for k, v := range renderingContext {
+		if k != helmValuesKey {
+			kabanero[k] = v
+		}
+	}
+	values["kabanero"] = kabanero
+
+	data := map[string]interface{}{
+		"Values":  values,
+		"Release": map[string]interface{}{"Name": chart.Name, "Namespace": namespace, "Service": "Kabanero"},
+		"Chart":   map[string]interface{}{"Name": chart.Name, "Version": chart.Version, "AppVersion": chart.AppVersion},
+	}
+
+	// The partials (i.e. _helpers.tpl) are parsed with the templates, so they can be included.
+	funcs := template.FuncMap{}
+	for k, v := range templateFuncs {
+		funcs[k] = v
+	}
+	tmpl := template.New(chart.Name).Option("missingkey=zero")
+	// The depth error is returned as is by the enclosing includes, rather than wrapped once per level.
+	includeDepth := 0
+	var includeDepthErr error
+	funcs["include"] = func(name string, data interface{}) (string, error) {
+		if includeDepth >= maxIncludeDepth {
+			includeDepthErr = fmt.Errorf("Template %v exceeded the maximum include depth of %v", name, maxIncludeDepth)
+			return "", includeDepthErr
+		}
+		includeDepth++
+		defer func() { includeDepth-- }()
+
+		out := &limitedBuffer{limit: maxRenderedSize}
+		err := tmpl.ExecuteTemplate(out, name, data)
+		if includeDepthErr != nil {
+			return "", includeDepthErr
+		}
+		return out.String(), err
+	}
+	funcs["required"] = requiredValue
+	funcs["trunc"] = truncate
+	funcs["toJson"] = toJson
+	tmpl.Funcs(funcs)
+
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, err := tmpl.New(name).Parse(string(templates[name]))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing chart template %v: %v", name, err.Error())
+		}
+	}
+
+	manifests := []StackAsset{}
+	for _, name := range names {
+		if !isRenderedHelmTemplate(name) {
+			continue
+		}
+
+		out := &limitedBuffer{limit: maxRenderedSize}
+		err := tmpl.ExecuteTemplate(out, name, data)
+		if err != nil {
+			return nil, fmt.Errorf("Error rendering chart template %v: %v", name, err.Error())
+		}
+
+		b_sum := sha256.Sum256(templates[name])
+		rendered := bytes.ReplaceAll(out.Bytes(), []byte("<no value>"), []byte(""))
+		pmanifests, err := processManifest(rendered, DirectiveProcessor{}, renderingContext, name, hex.EncodeToString(b_sum[:]))
+		if (err != nil) && (err != io.EOF) {
+			return nil, fmt.Errorf("Error decoding %v: %v", name, err.Error())
+		}
+
+		for _, manifest := range pmanifests {
+			if _, ok := manifest.Yaml.GetAnnotations()[helmHookAnnotation]; ok {
+				reqLogger.Info(fmt.Sprintf("Skipping Helm hook %v %v in chart %v", manifest.Kind, manifest.Name, chart.Name))
+				continue
+			}
+			manifests = append(manifests, manifest)
+		}
+	}
+
+	return manifests, nil
+}
+
+// Returns true if the chart template produces objects: partials, notes and tests are not rendered.
+func isRenderedHelmTemplate(name string) bool {
+	base := path.Base(name)
+	switch {
+	case strings.HasPrefix(base, "_"), base == "NOTES.txt", strings.HasPrefix(name, "templates/tests/"):
+		return false
+	}
+	return strings.HasSuffix(base, ".yaml") || strings.HasSuffix(base, ".yml")
+}
+
+// Converts the maps read by the yaml parser to maps with string keys, so values can be merged.
+func normalizeHelmValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeHelmValue(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeHelmValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Sets a value in the --set format (i.e. image.tag=1.0).  Booleans and integers are converted.
+func setHelmValue(values map[string]interface{}, key string, value string) error {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := values[part].(map[string]interface{})
+		if !ok {
+			if _, exists := values[part]; exists {
+				return fmt.Errorf("Unable to set value %v: %v is not a map", key, part)
+			}
+			next = make(map[string]interface{})
+			values[part] = next
+		}
+		values = next
+	}
+
+	last := parts[len(parts)-1]
+	switch {
+	case value == "true":
+		values[last] = true
+	case value == "false":
+		values[last] = false
+	default:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			values[last] = i
+		} else {
+			values[last] = value
+		}
+	}
+	return nil
+}
+
+// Returns the value, or an error with the input message if the value is empty.
+func requiredValue(message string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+// Truncates the string to the input length.
+func truncate(length int, s string) string {
+	if length >= 0 && len(s) > length {
+		return s[:length]
+	}
+	return s
+}
+
+// Formats the value as json.
+func toJson(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var testChart = map[string]string{
+	"build/Chart.yaml": `apiVersion: v1
+name: build
+version: 0.1.0
+appVersion: "1.0"
+`,
+	"build/values.yaml": `image:
+  repository: docker.io/kabanero/nodejs
+  tag: "0.3"
+scan:
+  enabled: false
+`,
+	"build/templates/_helpers.tpl": `{{- define "build.name" -}}
+{{ .Values.kabanero.StackId }}-{{ .Chart.Name }}
+{{- end -}}
+`,
+	"build/templates/task.yaml": `apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: {{ include "build.name" . }}-task
+  namespace: {{ .Release.Namespace }}
+  labels:
+    version: {{ .Chart.Version | quote }}
+spec:
+  steps:
+  - name: build
+    image: {{ .Values.image.repository }}:{{ .Values.image.tag }}
+{{- if .Values.scan.enabled }}
+  - name: scan
+    image: docker.io/kabanero/scanner
+{{- end }}
+`,
+	"build/templates/hook.yaml": `apiVersion: tekton.dev/v1alpha1
+kind: TaskRun
+metadata:
+  name: {{ include "build.name" . }}-hook
+  annotations:
+    helm.sh/hook: post-install
+`,
+	"build/templates/tests/test.yaml": `apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ include "build.name" . }}-test
+`,
+	"build/templates/NOTES.txt": `Installed {{ .Chart.Name }}`,
+}
+
+// Test that a packaged Helm chart is rendered with the pipeline values and the rendering context.
+func TestDecodeManifestsHelmChart(t *testing.T) {
+	archive := createTestTarGz(t, testChart)
+	context := map[string]interface{}{
+		"StackId":     "nodejs",
+		helmValuesKey: map[string]string{"image.tag": "0.4", "scan.enabled": "true"},
+	}
+
+	manifests, err := decodeManifests(archive, "kabanero", context, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 {
+		t.Fatalf("Expected only the task to be activated, but found: %v", manifests)
+	}
+
+	u := manifests[0].Yaml
+	if manifests[0].Name != "nodejs-build-task" || u.GetNamespace() != "kabanero" || u.GetLabels()["version"] != "0.1.0" {
+		t.Fatalf("Unexpected task metadata: %v", u.Object)
+	}
+
+	steps, _, _ := unstructured.NestedSlice(u.Object, "spec", "steps")
+	if len(steps) != 2 {
+		t.Fatalf("Expected the scan step to be enabled by the pipeline values: %v", steps)
+	}
+	if image := steps[0].(map[string]interface{})["image"]; image != "docker.io/kabanero/nodejs:0.4" {
+		t.Fatalf("Expected the image tag to be set by the pipeline values, but found: %v", image)
+	}
+}
+
+func TestDecodeManifestsHelmChartErrors(t *testing.T) {
+	tests := map[string]map[string]string{
+		"dependencies": {
+			"build/Chart.yaml":          "name: build\nversion: 0.1.0\n",
+			"build/charts/other.tgz":    "",
+			"build/templates/task.yaml": "kind: Task\n",
+		},
+		"required value": {
+			"build/Chart.yaml":          "name: build\nversion: 0.1.0\n",
+			"build/templates/task.yaml": `name: {{ required "A registry is required" .Values.registry }}`,
+		},
+		"invalid value": {
+			"build/Chart.yaml":          "name: build\nversion: 0.1.0\n",
+			"build/values.yaml":         "image: docker.io/kabanero/nodejs\n",
+			"build/templates/task.yaml": "kind: Task\n",
+		},
+		"recursive include": {
+			"build/Chart.yaml":             "name: build\nversion: 0.1.0\n",
+			"build/templates/_helpers.tpl": `{{- define "build.name" -}}{{ include "build.name" . }}{{- end -}}`,
+			"build/templates/task.yaml":    `name: {{ include "build.name" . }}`,
+		},
+	}
+
+	for name, files := range tests {
+		context := map[string]interface{}{helmValuesKey: map[string]string{"image.tag": "0.4"}}
+		_, err := decodeManifests(createTestTarGz(t, files), "kabanero", context, logf.NullLogger{})
+		if err == nil {
+			t.Fatalf("Expected an error for %v", name)
+		}
+		if name == "required value" && !strings.Contains(err.Error(), "A registry is required") {
+			t.Fatalf("Unexpected error for %v: %v", name, err)
+		}
+		if name == "recursive include" && !strings.Contains(err.Error(), "maximum include depth") {
+			t.Fatalf("Unexpected error for %v: %v", name, err)
+		}
+	}
+}
+
+func TestSetHelmValue(t *testing.T) {
+	values := map[string]interface{}{"image": map[string]interface{}{"repository": "docker.io/kabanero/nodejs"}}
+	for key, value := range map[string]string{"image.tag": "0.4", "replicas": "2", "scan.enabled": "false"} {
+		if err := setHelmValue(values, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	image := values["image"].(map[string]interface{})
+	if image["repository"] != "docker.io/kabanero/nodejs" || image["tag"] != "0.4" {
+		t.Fatalf("Unexpected image values: %v", image)
+	}
+	if values["replicas"] != int64(2) {
+		t.Fatalf("Expected an integer, but found: %v", values["replicas"])
+	}
+	if values["scan"].(map[string]interface{})["enabled"] != false {
+		t.Fatalf("Expected a boolean, but found: %v", values["scan"])
+	}
+}
@@ -0,0 +1,346 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	yml "gopkg.in/yaml.v2"
+)
+
+// The name of the overlay used when no overlay matches the target namespace or the Kabanero instance.
+const defaultOverlayName = "default"
+
+// The maximum depth of nested kustomizations, which also stops reference cycles.
+const maxKustomizationDepth = 10
+
+// A kustomization.yaml file in a pipeline archive.  The kustomization is built in-process, and only the fields
+// listed here are supported.
+type Kustomization struct {
+	Resources             []string          `yaml:"resources,omitempty"`
+	Bases                 []string          `yaml:"bases,omitempty"`
+	NamePrefix            string            `yaml:"namePrefix,omitempty"`
+	NameSuffix            string            `yaml:"nameSuffix,omitempty"`
+	CommonLabels          map[string]string `yaml:"commonLabels,omitempty"`
+	CommonAnnotations     map[string]string `yaml:"commonAnnotations,omitempty"`
+	PatchesStrategicMerge []string          `yaml:"patchesStrategicMerge,omitempty"`
+	Images                []KustomizeImage  `yaml:"images,omitempty"`
+}
+
+// Changes the name, tag or digest of an image referenced by the resources.
+type KustomizeImage struct {
+	Name    string `yaml:"name,omitempty"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+}
+
+// The files of the kustomization directory of a pipeline archive.  The resource files are only rendered
+// when they are referenced by the kustomization being built.
+type kustomizeArchive struct {
+	kustomizations   map[string]Kustomization
+	files            map[string]kustomizeFile
+	renderer         ActivationRenderer
+	renderingContext map[string]interface{}
+}
+
+type kustomizeFile struct {
+	content []byte
+	sha256  string
+}
+
+func newKustomizeArchive(renderer ActivationRenderer, renderingContext map[string]interface{}) *kustomizeArchive {
+	return &kustomizeArchive{
+		kustomizations:   make(map[string]Kustomization),
+		files:            make(map[string]kustomizeFile),
+		renderer:         renderer,
+		renderingContext: renderingContext,
+	}
+}
+
+// Adds a file of the kustomization directory.  The kustomization.yaml files are parsed, the other files are
+// kept for later.
+func (k *kustomizeArchive) addFile(name string, b []byte, sha256 string) error {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if path.Base(name) == "kustomization.yaml" {
+		kustomization := Kustomization{}
+		err := yml.UnmarshalStrict(b, &kustomization)
+		if err != nil {
+			return fmt.Errorf("Error reading %v: %v", name, err)
+		}
+		k.kustomizations[path.Dir(name)] = kustomization
+		return nil
+	}
+
+	k.files[name] = kustomizeFile{content: b, sha256: sha256}
+	return nil
+}
+
+// Builds the overlay selected for the input namespace and Kabanero instance. The overlays are searched in this
+// order: <dir>/overlays/<namespace>, <dir>/overlays/<instance name>, <dir>/overlays/default. If none of them
+// exist, <dir>/base is built.
+func (k *kustomizeArchive) buildOverlay(dir string, namespace string, instanceName string) ([]StackAsset, error) {
+	dir = path.Clean(dir)
+	for _, name := range []string{namespace, instanceName, defaultOverlayName} {
+		if len(name) == 0 {
+			continue
+		}
+		overlay := path.Join(dir, "overlays", name)
+		if _, ok := k.kustomizations[overlay]; ok {
+			return k.build(overlay, 0)
+		}
+	}
+
+	base := path.Join(dir, "base")
+	if _, ok := k.kustomizations[base]; ok {
+		return k.build(base, 0)
+	}
+
+	return nil, fmt.Errorf("The archive does not contain a kustomization in %v/base or %v/overlays", dir, dir)
+}
+
+// Builds the kustomization in the input directory.
+func (k *kustomizeArchive) build(dir string, depth int) ([]StackAsset, error) {
+	if depth > maxKustomizationDepth {
+		return nil, fmt.Errorf("The kustomization in %v exceeds the maximum depth of %v nested kustomizations", dir, maxKustomizationDepth)
+	}
+
+	kustomization := k.kustomizations[dir]
+	assets := []StackAsset{}
+	for _, resource := range append(append([]string{}, kustomization.Bases...), kustomization.Resources...) {
+		resourcePath, err := k.resolve(dir, resource)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := k.kustomizations[resourcePath]; ok {
+			nested, err := k.build(resourcePath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			assets = append(assets, nested...)
+			continue
+		}
+
+		fileAssets, err := k.render(resourcePath)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, fileAssets...)
+	}
+
+	for _, patch := range kustomization.PatchesStrategicMerge {
+		patchPath, err := k.resolve(dir, patch)
+		if err != nil {
+			return nil, err
+		}
+
+		patchAssets, err := k.render(patchPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, patchAsset := range patchAssets {
+			found := false
+			for i := range assets {
+				if assets[i].Kind == patchAsset.Kind && assets[i].Name == patchAsset.Name {
+					assets[i].Yaml.Object = strategicMerge(assets[i].Yaml.Object, patchAsset.Yaml.Object)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("The patch %v in %v does not match a resource: %v %v", patch, dir, patchAsset.Kind, patchAsset.Name)
+			}
+		}
+	}
+
+	for i := range assets {
+		transformAsset(&assets[i], kustomization)
+	}
+
+	return assets, nil
+}
+
+// Returns the path of a resource referenced by the kustomization in the input directory.  Resources must be in
+// the archive.
+func (k *kustomizeArchive) resolve(dir string, resource string) (string, error) {
+	resourcePath := path.Clean(path.Join(dir, resource))
+	if path.IsAbs(resource) || resourcePath == ".." || strings.HasPrefix(resourcePath, "../") {
+		return "", fmt.Errorf("The resource %v referenced in %v is not in the archive", resource, dir)
+	}
+
+	if _, ok := k.kustomizations[resourcePath]; ok {
+		return resourcePath, nil
+	}
+	if _, ok := k.files[resourcePath]; ok {
+		return resourcePath, nil
+	}
+
+	return "", fmt.Errorf("The resource %v referenced in %v was not found in the archive", resource, dir)
+}
+
+// Renders a resource file of the kustomization.  A new copy of its assets is returned on every call.
+func (k *kustomizeArchive) render(name string) ([]StackAsset, error) {
+	file := k.files[name]
+	assets, err := processManifest(file.content, k.renderer, k.renderingContext, name, file.sha256)
+	if (err != nil) && (err != io.EOF) {
+		return nil, fmt.Errorf("Error decoding %v: %v", name, err.Error())
+	}
+	return assets, nil
+}
+
+// Applies the name, label, annotation and image transformations of a kustomization to an asset.
+func transformAsset(asset *StackAsset, kustomization Kustomization) {
+	u := &asset.Yaml
+	if len(kustomization.NamePrefix) != 0 || len(kustomization.NameSuffix) != 0 {
+		u.SetName(kustomization.NamePrefix + u.GetName() + kustomization.NameSuffix)
+		asset.Name = u.GetName()
+	}
+
+	if len(kustomization.CommonLabels) != 0 {
+		labels := u.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		for key, value := range kustomization.CommonLabels {
+			labels[key] = value
+		}
+		u.SetLabels(labels)
+	}
+
+	if len(kustomization.CommonAnnotations) != 0 {
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		for key, value := range kustomization.CommonAnnotations {
+			annotations[key] = value
+		}
+		u.SetAnnotations(annotations)
+	}
+
+	for _, image := range kustomization.Images {
+		replaceImage(u.Object, image)
+	}
+}
+
+// Replaces the image fields that reference the input image, anywhere in the object.
+func replaceImage(obj interface{}, image KustomizeImage) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range o {
+			if s, ok := value.(string); ok && key == "image" {
+				o[key] = updateImageReference(s, image)
+			} else {
+				replaceImage(value, image)
+			}
+		}
+	case []interface{}:
+		for _, value := range o {
+			replaceImage(value, image)
+		}
+	}
+}
+
+// Returns the updated image reference, or the input reference if it does not reference the image.
+func updateImageReference(reference string, image KustomizeImage) string {
+	name := reference
+	suffix := ""
+	if i := strings.Index(name, "@"); i != -1 {
+		name, suffix = name[:i], name[i:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, suffix = name[:i], name[i:]
+	}
+
+	if name != image.Name {
+		return reference
+	}
+
+	if len(image.NewName) != 0 {
+		name = image.NewName
+	}
+	switch {
+	case len(image.Digest) != 0:
+		suffix = "@" + image.Digest
+	case len(image.NewTag) != 0:
+		suffix = ":" + image.NewTag
+	}
+
+	return name + suffix
+}
+
+// Merges a strategic merge patch into an object.  Maps are merged, lists of objects are merged by the value of
+// their name field, and other values are replaced.  A null value, or a list entry with "$patch: delete",
+// removes the entry.
+func strategicMerge(obj map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	for key, patchValue := range patch {
+		if patchValue == nil {
+			delete(obj, key)
+			continue
+		}
+
+		switch p := patchValue.(type) {
+		case map[string]interface{}:
+			if o, ok := obj[key].(map[string]interface{}); ok {
+				obj[key] = strategicMerge(o, p)
+				continue
+			}
+		case []interface{}:
+			if o, ok := obj[key].([]interface{}); ok && isNamedList(o) && isNamedList(p) {
+				obj[key] = mergeNamedList(o, p)
+				continue
+			}
+		}
+
+		obj[key] = patchValue
+	}
+
+	return obj
+}
+
+// Returns true if all of the entries of the list are objects with a name field.
+func isNamedList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+
+	for _, entry := range list {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func mergeNamedList(list []interface{}, patch []interface{}) []interface{} {
+	for _, patchEntry := range patch {
+		p := patchEntry.(map[string]interface{})
+		deleteEntry := p["$patch"] == "delete"
+		delete(p, "$patch")
+
+		found := false
+		for i := 0; i < len(list); i++ {
+			entry := list[i].(map[string]interface{})
+			if entry["name"] != p["name"] {
+				continue
+			}
+			found = true
+			if deleteEntry {
+				list = append(list[:i], list[i+1:]...)
+				i--
+			} else {
+				list[i] = strategicMerge(entry, p)
+			}
+		}
+
+		if !found && !deleteEntry {
+			list = append(list, p)
+		}
+	}
+	return list
+}
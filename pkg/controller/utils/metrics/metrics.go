@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The metrics are registered with the controller-runtime registry, and are served by the metrics endpoint of
+// the manager that runs the controllers using them.
+var (
+	// The number of versions of a stack in each state (i.e. active, inactive, error).
+	stackVersions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kabanero_stack_versions",
+			Help: "Number of stack versions by state",
+		},
+		[]string{"namespace", "stack", "state"},
+	)
+
+	// The number of pipeline assets activated by a stack in each status (i.e. active, failed).
+	stackAssets = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kabanero_stack_pipeline_assets",
+			Help: "Number of pipeline assets activated by a stack by status",
+		},
+		[]string{"namespace", "stack", "status"},
+	)
+
+	// Failures retrieving the digest of stack images.
+	digestFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kabanero_image_digest_failures_total",
+			Help: "Number of failures retrieving the digest of stack images by registry",
+		},
+		[]string{"registry"},
+	)
+
+	// The time taken to fetch stack repository indexes.
+	indexFetchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kabanero_stack_index_fetch_duration_seconds",
+			Help:    "Time taken to fetch and resolve a stack repository index",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"repository"},
+	)
+
+	// Failures fetching stack repository indexes.
+	indexFetchErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kabanero_stack_index_fetch_errors_total",
+			Help: "Number of failures fetching or resolving a stack repository index",
+		},
+		[]string{"repository"},
+	)
+
+	// Lookups in the HTTP and Git caches. The hit ratio is the rate of hits over the rate of all lookups.
+	cacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kabanero_cache_lookups_total",
+			Help: "Number of HTTP and Git cache lookups by result (hit or miss)",
+		},
+		[]string{"cache", "result"},
+	)
+
+	// The size of each entry of the HTTP and Git caches. The series of an entry is removed when it is evicted.
+	cacheEntryBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kabanero_cache_entry_bytes",
+			Help: "Size of each HTTP and Git cache entry",
+		},
+		[]string{"cache", "key"},
+	)
+
+	// The hits on each entry of the HTTP and Git caches.
+	cacheEntryHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kabanero_cache_entry_hits_total",
+			Help: "Number of hits on each HTTP and Git cache entry",
+		},
+		[]string{"cache", "key"},
+	)
+
+	// The total size of the cache shared by the HTTP and Git caches.
+	cacheBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kabanero_cache_bytes",
+			Help: "Total size of the HTTP and Git cache entries",
+		},
+	)
+
+	// Cache entries evicted because the cache exceeded its limit, or because they were not used.
+	cacheEvictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kabanero_cache_evictions_total",
+			Help: "Number of HTTP and Git cache entries evicted by reason (size or idle)",
+		},
+		[]string{"cache", "reason"},
+	)
+)
+
+// The cache names used as label values.
+const (
+	CacheHTTP = "http"
+	CacheGit  = "git"
+)
+
+// The cache eviction reasons used as label values.
+const (
+	CacheEvictionSize = "size"
+	CacheEvictionIdle = "idle"
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(stackVersions, stackAssets, digestFailures, indexFetchDuration, indexFetchErrors, cacheLookups,
+		cacheEntryBytes, cacheEntryHits, cacheBytes, cacheEvictions)
+}
+
+// The label values of the stack gauges set by the previous call to RecordStackStatus, keyed by namespace and
+// stack name. They are used to remove the series of states and statuses that no longer apply to a stack.
+var (
+	stackLabels     = make(map[string]stackLabelValues)
+	stackLabelsLock sync.Mutex
+)
+
+type stackLabelValues struct {
+	states   []string
+	statuses []string
+}
+
+// Records the number of versions of a stack in each state, and the number of pipeline assets it activated in
+// each status.
+func RecordStackStatus(namespace string, stack string, versionStates map[string]int, assetStatuses map[string]int) {
+	stackLabelsLock.Lock()
+	defer stackLabelsLock.Unlock()
+
+	key := namespace + "/" + stack
+	previous := stackLabels[key]
+	for _, state := range previous.states {
+		if _, ok := versionStates[state]; !ok {
+			stackVersions.DeleteLabelValues(namespace, stack, state)
+		}
+	}
+	for _, status := range previous.statuses {
+		if _, ok := assetStatuses[status]; !ok {
+			stackAssets.DeleteLabelValues(namespace, stack, status)
+		}
+	}
+
+	current := stackLabelValues{}
+	for state, count := range versionStates {
+		stackVersions.WithLabelValues(namespace, stack, state).Set(float64(count))
+		current.states = append(current.states, state)
+	}
+	for status, count := range assetStatuses {
+		stackAssets.WithLabelValues(namespace, stack, status).Set(float64(count))
+		current.statuses = append(current.statuses, status)
+	}
+	stackLabels[key] = current
+}
+
+// Removes the series of a deleted stack.
+func DeleteStackStatus(namespace string, stack string) {
+	RecordStackStatus(namespace, stack, nil, nil)
+
+	stackLabelsLock.Lock()
+	defer stackLabelsLock.Unlock()
+	delete(stackLabels, namespace+"/"+stack)
+}
+
+// Records a failure retrieving the digest of an image hosted by the input registry.
+func RecordDigestFailure(registry string) {
+	digestFailures.WithLabelValues(registry).Inc()
+}
+
+// Records the time taken to fetch the index of the input stack repository, and whether the fetch failed.
+func RecordIndexFetch(repository string, start time.Time, err error) {
+	indexFetchDuration.WithLabelValues(repository).Observe(time.Since(start).Seconds())
+	if err != nil {
+		indexFetchErrors.WithLabelValues(repository).Inc()
+	}
+}
+
+// Records a lookup in the input cache.
+func RecordCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Records a hit on an entry of the input cache.
+func RecordCacheEntryHit(cache string, key string) {
+	cacheEntryHits.WithLabelValues(cache, key).Inc()
+}
+
+// Records the size of an entry added to the input cache.
+func RecordCacheEntry(cache string, key string, size int) {
+	cacheEntryBytes.WithLabelValues(cache, key).Set(float64(size))
+}
+
+// Removes the series of an entry removed from the input cache.
+func DeleteCacheEntry(cache string, key string) {
+	cacheEntryBytes.DeleteLabelValues(cache, key)
+	cacheEntryHits.DeleteLabelValues(cache, key)
+}
+
+// Records the total size of the cache.
+func RecordCacheSize(size int64) {
+	cacheBytes.Set(float64(size))
+}
+
+// Records the eviction of a cache entry.
+func RecordCacheEviction(cache string, reason string) {
+	cacheEvictions.WithLabelValues(cache, reason).Inc()
+}
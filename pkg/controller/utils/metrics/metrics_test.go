@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Test that the series of states that no longer apply to a stack are removed.
+func TestRecordStackStatus(t *testing.T) {
+	RecordStackStatus("kabanero", "nodejs", map[string]int{"active": 1, "error": 1}, map[string]int{"active": 3, "failed": 1})
+	if value := testutil.ToFloat64(stackVersions.WithLabelValues("kabanero", "nodejs", "error")); value != 1 {
+		t.Fatalf("Expected 1 version in error, but found %v", value)
+	}
+
+	RecordStackStatus("kabanero", "nodejs", map[string]int{"active": 2}, map[string]int{"active": 4})
+	if count := testutil.CollectAndCount(stackAssets); count != 1 {
+		t.Fatalf("Expected 1 pipeline asset series, but found %v", count)
+	}
+	if count := testutil.CollectAndCount(stackVersions); count != 1 {
+		t.Fatalf("Expected 1 stack version series, but found %v", count)
+	}
+
+	DeleteStackStatus("kabanero", "nodejs")
+	if count := testutil.CollectAndCount(stackVersions); count != 0 {
+		t.Fatalf("Expected the stack version series to be removed, but found %v", count)
+	}
+}
+
+// Test that index fetch errors and cache lookups are counted.
+func TestRecordIndexFetchAndCacheLookup(t *testing.T) {
+	RecordIndexFetch("incubator", time.Now(), nil)
+	RecordIndexFetch("incubator", time.Now(), fmt.Errorf("not found"))
+	if value := testutil.ToFloat64(indexFetchErrors.WithLabelValues("incubator")); value != 1 {
+		t.Fatalf("Expected 1 index fetch error, but found %v", value)
+	}
+
+	RecordCacheLookup(CacheHTTP, true)
+	RecordCacheLookup(CacheHTTP, true)
+	RecordCacheLookup(CacheHTTP, false)
+	if value := testutil.ToFloat64(cacheLookups.WithLabelValues(CacheHTTP, "hit")); value != 2 {
+		t.Fatalf("Expected 2 cache hits, but found %v", value)
+	}
+}
@@ -2,14 +2,20 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
 
+	"github.com/blang/semver"
 	"github.com/go-logr/logr"
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/transforms"
 	mfc "github.com/manifestival/controller-runtime-client"
 	mf "github.com/manifestival/manifestival"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -22,6 +28,7 @@ const (
 	AssetStatusActive  = "active"
 	AssetStatusFailed  = "failed"
 	AssetStatusUnknown = "unknown"
+	AssetStatusDrifted = "drifted"
 )
 
 // A key to the pipeline use count map
@@ -35,7 +42,7 @@ type PipelineUseMapKey struct {
 type PipelineUseMapValue struct {
 	kabanerov1alpha2.PipelineStatus
 	useCount      int64
-	manifests     []StackAsset
+	manifests     map[string][]StackAsset
 	ManifestError error
 }
 
@@ -51,7 +58,12 @@ func gitReleaseSpecToGitReleaseInfo(gitRelease kabanerov1alpha2.GitReleaseSpec)
 	return kabanerov1alpha2.GitReleaseInfo{Hostname: gitRelease.Hostname, Organization: gitRelease.Organization, Project: gitRelease.Project, Release: gitRelease.Release, AssetName: gitRelease.AssetName}
 }
 
-func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alpha2.ComponentStatus, targetNamespace string, renderingContext map[string]interface{}, assetOwner metav1.OwnerReference, c client.Client, logger logr.Logger) (PipelineUseMap, error) {
+// Activates the pipelines referenced by the input component spec. If a signature verifier is provided, the
+// signatures of the pipeline archives are verified before their assets are created. If a plan is provided,
+// the assets that would be created, updated or deleted are recorded in it, and the cluster is not modified.
+func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alpha2.ComponentStatus, targetNamespace string, renderingContext map[string]interface{}, assetOwner metav1.OwnerReference, c client.Client, options ActivationOptions, logger logr.Logger) (PipelineUseMap, error) {
+	verifier := options.Verifier
+	plan := options.Plan
 
 	// Multiple versions of the same stack, could be using the same pipeline zip.  Count how many
 	// times each pipeline has been used.
@@ -78,6 +90,8 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 	// sure to take into consideration the digest on the individual pipeline zips.
 	assetsToDecrement := make(map[pipelineVersion]bool)
 	assetsToIncrement := make(map[pipelineVersion]bool)
+	statusVersions := make(map[PipelineUseMapKey]string)
+	specVersions := make(map[PipelineUseMapKey]string)
 	for _, curStatus := range status.GetVersions() {
 		for _, pipeline := range curStatus.GetPipelines() {
 			key := PipelineUseMapKey{Digest: pipeline.Digest}
@@ -88,13 +102,23 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 			}
 			cur := pipelineVersion{PipelineUseMapKey: key, version: curStatus.GetVersion()}
 			assetsToDecrement[cur] = true
+			statusVersions[key] = highestVersion(statusVersions[key], curStatus.GetVersion())
 		}
 	}
 
 	// When processing the pipelines currently referenced in the stack spec, save
 	// off whether we should disable certificate verification checking per-resource.
 	certVerification := make(map[PipelineUseMapKey]bool)
+	specValues := make(map[PipelineUseMapKey]map[string]string)
+	specNamespaces := make(map[PipelineUseMapKey][]string)
 	for _, curSpec := range spec.GetVersions() {
+		// The pipelines are activated in the activation namespace and the target namespaces, unless the
+		// version is limited to its own namespaces.
+		namespaces, limited := options.VersionNamespaces[curSpec.GetVersion()]
+		if !limited {
+			namespaces = append([]string{targetNamespace}, options.TargetNamespaces...)
+		}
+
 		for _, pipeline := range curSpec.GetPipelines() {
 			key := PipelineUseMapKey{Digest: pipeline.Sha256}
 			if pipeline.GitRelease.IsUsable() {
@@ -105,6 +129,13 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 				certVerification[key] = pipeline.Https.SkipCertVerification
 			}
 			cur := pipelineVersion{PipelineUseMapKey: key, version: curSpec.GetVersion()}
+			// A pipeline shared by several versions is rendered with the values of the highest version.
+			version, found := specVersions[key]
+			specVersions[key] = highestVersion(version, curSpec.GetVersion())
+			if !found || specVersions[key] != version {
+				specValues[key] = pipeline.Values
+			}
+			specNamespaces[key] = appendNamespaces(specNamespaces[key], namespaces)
 			if assetsToDecrement[cur] == true {
 				delete(assetsToDecrement, cur)
 			} else {
@@ -136,7 +167,7 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 
 	// Now iterate thru the asset use map and delete any assets with a use count of 0,
 	// and create any assets with a positive use count.
-	for _, value := range assetUseMap {
+	for key, value := range assetUseMap {
 		if value.useCount <= 0 {
 			logger.Info(fmt.Sprintf("Deleting assets with use count %v: %v", value.useCount, value))
 
@@ -146,7 +177,23 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 					asset.Namespace = targetNamespace
 				}
 
-				DeleteAsset(c, asset, assetOwner, logger)
+				if plan != nil {
+					plan.AddDelete(plannedAssetFromStatus(asset, "The pipeline is no longer used by any version."))
+					continue
+				}
+
+				err := DeleteAsset(c, asset, assetOwner, logger)
+				if err != nil {
+					options.recordEvent(corev1.EventTypeWarning, "AssetDeleteFailed", "Unable to delete %v %v/%v: %v", asset.Kind, asset.Namespace, asset.Name, err)
+				} else {
+					options.recordEvent(corev1.EventTypeNormal, "AssetDeleted", "Removed %v %v/%v from the activated assets", asset.Kind, asset.Namespace, asset.Name)
+				}
+			}
+
+			if len(value.ActiveAssets) != 0 {
+				pipelineContext := pipelineRenderingContext(renderingContext, value, statusVersions[key], specValues[key], options)
+				pipelineContext["Namespace"] = targetNamespace
+				applyDeactivateHooks(c, value, targetNamespace, pipelineContext, assetOwner, options, logger)
 			}
 		}
 	}
@@ -155,31 +202,45 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 		if value.useCount > 0 {
 			logger.Info(fmt.Sprintf("Creating assets with use count %v: %v", value.useCount, value))
 
-			// Check to see if there is already an asset list.  If not, read the manifests and
-			// create one.
-			if len(value.ActiveAssets) == 0 {
-				// Add the Digest to the rendering context. No need to validate if the digest was tampered
-				// with here. Later one and before we do anything with this, we will have validated the specified
-				// digest against the generated digest from the archive.
-				if len(value.Digest) >= 8 {
-					renderingContext["Digest"] = value.Digest[0:8]
-				} else {
-					renderingContext["Digest"] = "nodigest"
+			// Reads the manifests rendered for a namespace, once.  Add the Digest and the version values to the
+			// rendering context. No need to validate if the digest was tampered with here. Later one and before we
+			// do anything with this, we will have validated the specified digest against the generated digest from
+			// the archive.
+			value.manifests = make(map[string][]StackAsset)
+			loadManifests := func(namespace string) ([]StackAsset, error) {
+				if manifests, ok := value.manifests[namespace]; ok {
+					return manifests, nil
+				}
+
+				pipelineContext := pipelineRenderingContext(renderingContext, value, specVersions[key], specValues[key], options)
+				pipelineContext["Namespace"] = namespace
+				manifests, err := getManifestsForNamespace(c, targetNamespace, namespace, value.PipelineStatus, pipelineContext, certVerification[key], verifier, logger)
+				if err != nil {
+					return nil, err
 				}
+				value.manifests[namespace] = manifests
+				return manifests, nil
+			}
 
+			// Check to see if there is already an asset list in the activation namespace.  If not, read the
+			// manifests and create one.
+			if containsNamespace(specNamespaces[key], targetNamespace) && !hasActivationAssets(value.ActiveAssets) {
 				// Retrieve manifests as unstructured.  If we could not get them, skip.
-				manifests, err := GetManifests(c, targetNamespace, value.PipelineStatus, renderingContext, certVerification[key], logger)
+				manifests, err := loadManifests(targetNamespace)
 				if err != nil {
 					logger.Error(err, fmt.Sprintf("Error retrieving archive manifests: %v", value))
+					recordManifestError(options, value.PipelineStatus, err)
 					value.ManifestError = err
 					continue
 				}
 
-				// Save the manifests for later.
-				value.manifests = manifests
-
-				// Create the asset status slice, but don't apply anything yet.
+				// Create the asset status slice, but don't apply anything yet.  Documents marked with an
+				// "on deactivate apply" directive are only applied when the pipeline is deactivated.
 				for _, asset := range manifests {
+					if asset.OnDeactivate == DeactivateActionApply {
+						continue
+					}
+
 					// Figure out what namespace we should create the object in.
 					value.ActiveAssets = append(value.ActiveAssets, kabanerov1alpha2.RepositoryAssetStatus{
 						Name:          asset.Name,
@@ -194,6 +255,23 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 				}
 			}
 
+			// Copy the assets to the target namespaces, and remove the assets from the namespaces no longer targeted.
+			reconcileNamespaceCopies(c, value, targetNamespace, specNamespaces[key], assetOwner, options, loadManifests, logger)
+
+			// When the values the manifests are rendered with changed (i.e. the pipeline values, or the values of
+			// the version using the archive), the assets are rendered and applied again.  The digest is only
+			// recorded once the assets were updated, so that a failed update is retried.
+			renderingDigest := getRenderingDigest(pipelineRenderingContext(renderingContext, value, specVersions[key], specValues[key], options))
+			renderingChanged := len(value.RenderingDigest) != 0 && value.RenderingDigest != renderingDigest && len(value.ActiveAssets) != 0
+			renderingApplied := true
+			if renderingChanged {
+				logger.Info(fmt.Sprintf("The values the manifests are rendered with changed, applying the assets again: %v", value))
+				if !reconcileRenderedAssets(c, value, targetNamespace, assetOwner, options, loadManifests, logger) {
+					renderingChanged = false
+					renderingApplied = false
+				}
+			}
+
 			// Now go thru the asset list and see if the objects are there.  If not, create them.
 			for index, asset := range value.ActiveAssets {
 				// Old assets may not have a namespace set - correct that now.
@@ -214,6 +292,12 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 					Name:      asset.Name,
 				}, u)
 
+				// The copies in the target namespaces are rendered for their namespace.
+				renderNamespace := targetNamespace
+				if asset.NamespaceCopy {
+					renderNamespace = asset.Namespace
+				}
+
 				if err != nil {
 					if errors.IsNotFound(err) == false {
 						logger.Error(err, fmt.Sprintf("Unable to check asset name %v", asset.Name))
@@ -221,29 +305,17 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 						value.ActiveAssets[index].StatusMessage = "Unable to check asset: " + err.Error()
 					} else {
 						// Make sure the manifests are loaded.
-						if len(value.manifests) == 0 {
-							// Add the Digest to the rendering context.
-							if len(value.Digest) >= 8 {
-								renderingContext["Digest"] = value.Digest[0:8]
-							} else {
-								renderingContext["Digest"] = "nodigest"
-							}
-
-							// Retrieve manifests as unstructured
-							manifests, err := GetManifests(c, targetNamespace, value.PipelineStatus, renderingContext, certVerification[key], logger)
-							if err != nil {
-								logger.Error(err, fmt.Sprintf("Object %v not found and manifests not available: %v", asset.Name, value))
-								value.ActiveAssets[index].Status = AssetStatusFailed
-								value.ActiveAssets[index].StatusMessage = "Manifests are no longer available at specified URL"
-							} else {
-								// Save the manifests for later.
-								value.manifests = manifests
-							}
+						manifests, err := loadManifests(renderNamespace)
+						if err != nil {
+							logger.Error(err, fmt.Sprintf("Object %v not found and manifests not available: %v", asset.Name, value))
+							recordManifestError(options, value.PipelineStatus, err)
+							value.ActiveAssets[index].Status = AssetStatusFailed
+							value.ActiveAssets[index].StatusMessage = "Manifests are no longer available at specified URL"
 						}
 
 						// Now find the correct manifest and create the object
-						for _, manifest := range value.manifests {
-							if asset.Name == manifest.Name {
+						for _, manifest := range manifests {
+							if asset.Name == manifest.Name && manifest.OnDeactivate != DeactivateActionApply {
 								resources := []unstructured.Unstructured{manifest.Yaml}
 
 								// Only allow Group: tekton.dev
@@ -261,8 +333,12 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 
 									logger.Info(fmt.Sprintf("Resources: %v", mOrig.Resources()))
 
+									ownerTransform := transforms.InjectOwnerReference(assetOwner)
+									if asset.NamespaceCopy {
+										ownerTransform = transforms.InjectOwnerAnnotation(assetOwner)
+									}
 									transforms := []mf.Transformer{
-										transforms.InjectOwnerReference(assetOwner),
+										ownerTransform,
 										mf.InjectNamespace(asset.Namespace),
 									}
 
@@ -271,6 +347,11 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 										logger.Error(err, fmt.Sprintf("Error transforming manifests for %v", asset.Name))
 										value.ActiveAssets[index].Status = AssetStatusFailed
 										value.ActiveAssets[index].Status = err.Error()
+									} else if plan != nil {
+										for _, resource := range m.Resources() {
+											plan.AddCreate(plannedAssetFromStatus(asset, "The asset does not exist."), resource)
+										}
+										value.ActiveAssets[index].StatusMessage = "Asset has not been applied yet (plan mode)."
 									} else {
 										logger.Info(fmt.Sprintf("Applying resources: %v", m.Resources()))
 										err = m.Apply()
@@ -279,9 +360,11 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 											logger.Error(err, "Error installing the resource", "resource", asset.Name)
 											value.ActiveAssets[index].Status = AssetStatusFailed
 											value.ActiveAssets[index].StatusMessage = err.Error()
+											options.recordEvent(corev1.EventTypeWarning, "AssetCreateFailed", "Unable to create %v %v/%v: %v", asset.Kind, asset.Namespace, asset.Name, err)
 										} else {
 											value.ActiveAssets[index].Status = AssetStatusActive
 											value.ActiveAssets[index].StatusMessage = ""
+											options.recordEvent(corev1.EventTypeNormal, "AssetCreated", "Created %v %v/%v", asset.Kind, asset.Namespace, asset.Name)
 										}
 									}
 								}
@@ -289,21 +372,34 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 						}
 					}
 				} else {
-					// Add owner reference
+					// Add owner reference.  The copies in the target namespaces are owned through an annotation.
+					namespaceCopy := asset.NamespaceCopy
 					ownerRefs := u.GetOwnerReferences()
+					owners := transforms.AnnotationOwners(u)
 					foundOurselves := false
 					for _, ownerRef := range ownerRefs {
 						if ownerRef.UID == assetOwner.UID {
 							foundOurselves = true
 						}
 					}
+					for _, owner := range owners {
+						if namespaceCopy && owner == string(assetOwner.UID) {
+							foundOurselves = true
+						}
+					}
 
-					if foundOurselves == false {
+					if foundOurselves == false && plan != nil {
+						plan.AddUpdate(plannedAssetFromStatus(asset, "An owner reference to "+assetOwner.Name+" would be added."))
+					} else if foundOurselves == false {
 
 						// There can only be one 'controller' reference, so additional references should not
 						// be controller references.  It's not clear what Kubernetes does with this field.
-						ownerRefs = append(ownerRefs, assetOwner)
-						u.SetOwnerReferences(ownerRefs)
+						if namespaceCopy {
+							transforms.SetAnnotationOwners(u, append(owners, string(assetOwner.UID)))
+						} else {
+							ownerRefs = append(ownerRefs, assetOwner)
+							u.SetOwnerReferences(ownerRefs)
+						}
 
 						err = c.Update(context.TODO(), u)
 						if err != nil {
@@ -311,16 +407,156 @@ func ActivatePipelines(spec kabanerov1alpha2.ComponentSpec, status kabanerov1alp
 						}
 					}
 
-					value.ActiveAssets[index].Status = AssetStatusActive
-					value.ActiveAssets[index].StatusMessage = ""
+					// Apply the manifest rendered with the new values.  The object is not checked for drift then.
+					if renderingChanged {
+						manifests, err := loadManifests(renderNamespace)
+						if err == nil {
+							err = applyRenderedManifest(c, u, manifests, &value.ActiveAssets[index], plan, logger)
+						}
+						if err != nil {
+							logger.Error(err, fmt.Sprintf("Unable to update asset %v with its rendered manifest", asset.Name))
+							value.ActiveAssets[index].Status = AssetStatusFailed
+							value.ActiveAssets[index].StatusMessage = "Unable to update the asset with its rendered manifest: " + err.Error()
+							options.recordEvent(corev1.EventTypeWarning, "AssetUpdateFailed", "Unable to update %v %v/%v: %v", asset.Kind, asset.Namespace, asset.Name, err)
+							renderingApplied = false
+						} else {
+							value.ActiveAssets[index].Status = AssetStatusActive
+							value.ActiveAssets[index].StatusMessage = ""
+						}
+						continue
+					}
+
+					// Unless a drift policy was set, the object is not checked for drift.
+					if len(options.DriftPolicy) == 0 {
+						value.ActiveAssets[index].Status = AssetStatusActive
+						value.ActiveAssets[index].StatusMessage = ""
+						continue
+					}
+
+					// Make sure the manifests are loaded, so that the object can be checked for drift.
+					manifests, err := loadManifests(renderNamespace)
+					if err != nil {
+						logger.Error(err, fmt.Sprintf("Unable to check asset %v for drift, the manifests are not available: %v", asset.Name, value))
+					}
+
+					reconcileAssetDrift(c, u, manifests, &value.ActiveAssets[index], options.DriftPolicy, plan, logger)
 				}
 			}
+
+			if renderingApplied {
+				value.RenderingDigest = renderingDigest
+			}
 		}
 	}
 
 	return assetUseMap, nil
 }
 
+// Records an event for a pipeline archive whose manifests could not be read. Checksum failures are reported
+// separately from other errors.
+func recordManifestError(options ActivationOptions, pipeline kabanerov1alpha2.PipelineStatus, err error) {
+	if _, ok := err.(ManifestChecksumError); ok {
+		options.recordEvent(corev1.EventTypeWarning, "ManifestChecksumFailed", "The manifests of pipeline archive %v failed checksum validation: %v", pipeline.Url, err)
+		return
+	}
+	options.recordEvent(corev1.EventTypeWarning, "ManifestError", "Unable to read the manifests of pipeline archive %v: %v", pipeline.Url, err)
+}
+
+// Returns the rendering context used to read the manifests of a pipeline archive: the input rendering context,
+// the digest of the archive, the values of the version that uses it, and the Helm values of the pipeline.
+func pipelineRenderingContext(renderingContext map[string]interface{}, value *PipelineUseMapValue, version string, helmValues map[string]string, options ActivationOptions) map[string]interface{} {
+	pipelineContext := make(map[string]interface{})
+	for k, v := range renderingContext {
+		pipelineContext[k] = v
+	}
+
+	if len(value.Digest) >= 8 {
+		pipelineContext["Digest"] = value.Digest[0:8]
+	} else {
+		pipelineContext["Digest"] = "nodigest"
+	}
+
+	for k, v := range options.VersionContext[version] {
+		pipelineContext[k] = v
+	}
+
+	if len(helmValues) != 0 {
+		pipelineContext[helmValuesKey] = helmValues
+	}
+
+	return pipelineContext
+}
+
+// Returns the highest of two versions.  Versions that are not semantic versions are compared as strings.
+func highestVersion(current string, candidate string) string {
+	currentVersion, currentErr := semver.ParseTolerant(current)
+	candidateVersion, candidateErr := semver.ParseTolerant(candidate)
+	if currentErr == nil && candidateErr == nil {
+		if candidateVersion.GT(currentVersion) {
+			return candidate
+		}
+		return current
+	}
+
+	if candidate > current {
+		return candidate
+	}
+	return current
+}
+
+// Applies the documents of a deactivated pipeline archive that were marked with an "on deactivate apply"
+// directive.  The objects are owned by the asset owner, but are not tracked in the activated assets.
+func applyDeactivateHooks(c client.Client, value *PipelineUseMapValue, targetNamespace string, renderingContext map[string]interface{}, assetOwner metav1.OwnerReference, options ActivationOptions, logger logr.Logger) {
+	manifests, err := GetVerifiedManifests(c, targetNamespace, value.PipelineStatus, renderingContext, false, options.Verifier, logger)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("Unable to apply the deactivate hooks, the manifests are not available: %v", value))
+		recordManifestError(options, value.PipelineStatus, err)
+		return
+	}
+
+	for _, manifest := range manifests {
+		if manifest.OnDeactivate != DeactivateActionApply {
+			continue
+		}
+
+		asset := kabanerov1alpha2.RepositoryAssetStatus{
+			Name:      manifest.Name,
+			Namespace: getNamespaceForObject(&manifest.Yaml, targetNamespace),
+			Group:     manifest.Group,
+			Version:   manifest.Version,
+			Kind:      manifest.Kind,
+			Digest:    manifest.Sha256,
+		}
+
+		// Only allow Group: tekton.dev
+		if (manifest.Group != "tekton.dev") && (manifest.Group != "triggers.tekton.dev") {
+			logger.Info(fmt.Sprintf("Deactivate hook %v rejected: contains a Group not equal to tekton.dev or triggers.tekton.dev", asset.Name))
+			options.recordEvent(corev1.EventTypeWarning, "AssetCreateFailed", "Unable to create %v %v/%v: the deactivate hook contains a Group not equal to tekton.dev or triggers.tekton.dev", asset.Kind, asset.Namespace, asset.Name)
+			continue
+		}
+
+		if options.Plan != nil {
+			options.Plan.AddCreate(plannedAssetFromStatus(asset, "The pipeline was deactivated."), manifest.Yaml)
+			continue
+		}
+
+		m, err := mf.ManifestFrom(mf.Slice([]unstructured.Unstructured{manifest.Yaml}), mf.UseClient(mfc.NewClient(c)), mf.UseLogger(logger.WithName("manifestival")))
+		if err == nil {
+			m, err = m.Transform(transforms.InjectOwnerReference(assetOwner), mf.InjectNamespace(asset.Namespace))
+		}
+		if err == nil {
+			err = m.Apply()
+		}
+
+		if err != nil {
+			logger.Error(err, "Error applying the deactivate hook", "resource", asset.Name)
+			options.recordEvent(corev1.EventTypeWarning, "AssetCreateFailed", "Unable to create %v %v/%v: %v", asset.Kind, asset.Namespace, asset.Name, err)
+		} else {
+			options.recordEvent(corev1.EventTypeNormal, "AssetCreated", "Created %v %v/%v on deactivation", asset.Kind, asset.Namespace, asset.Name)
+		}
+	}
+}
+
 // Deletes an asset.  This can mean removing an object owner, or completely deleting it.
 func DeleteAsset(c client.Client, asset kabanerov1alpha2.RepositoryAssetStatus, assetOwner metav1.OwnerReference, logger logr.Logger) error {
 	if asset.Status == AssetStatusUnknown || asset.Status == AssetStatusFailed {
@@ -346,7 +582,8 @@ func DeleteAsset(c client.Client, asset kabanerov1alpha2.RepositoryAssetStatus,
 			return err
 		}
 	} else {
-		// Get the owner references.  See if we're the last one.
+		// Get the owner references, and the owners annotation of objects in another namespace than
+		// their owners.  See if we're the last one.
 		ownerRefs := u.GetOwnerReferences()
 		newOwnerRefs := []metav1.OwnerReference{}
 		for _, ownerRef := range ownerRefs {
@@ -354,8 +591,15 @@ func DeleteAsset(c client.Client, asset kabanerov1alpha2.RepositoryAssetStatus,
 				newOwnerRefs = append(newOwnerRefs, ownerRef)
 			}
 		}
+		newOwners := []string{}
+		for _, owner := range transforms.AnnotationOwners(u) {
+			if owner != string(assetOwner.UID) {
+				newOwners = append(newOwners, owner)
+			}
+		}
 
-		if len(newOwnerRefs) == 0 {
+		// Objects marked with an "on deactivate retain" directive are left in place.
+		if len(newOwnerRefs) == 0 && len(newOwners) == 0 && u.GetAnnotations()[OnDeactivateAnnotation] != DeactivateActionRetain {
 			err = c.Delete(context.TODO(), u)
 			if err != nil {
 				logger.Error(err, fmt.Sprintf("Unable to delete asset name %v in namespace %v. Status: %v", asset.Name, asset.Namespace, asset.Status))
@@ -363,6 +607,7 @@ func DeleteAsset(c client.Client, asset kabanerov1alpha2.RepositoryAssetStatus,
 			}
 		} else {
 			u.SetOwnerReferences(newOwnerRefs)
+			transforms.SetAnnotationOwners(u, newOwners)
 			err = c.Update(context.TODO(), u)
 			if err != nil {
 				logger.Error(err, fmt.Sprintf("Unable to delete owner reference from %v in namespace %v. Status: %v", asset.Name, asset.Namespace, asset.Status))
@@ -374,6 +619,244 @@ func DeleteAsset(c client.Client, asset kabanerov1alpha2.RepositoryAssetStatus,
 	return nil
 }
 
+// The identity of an asset.
+type namespacedAssetKey struct {
+	name      string
+	namespace string
+	group     string
+	version   string
+	kind      string
+}
+
+func assetKeyOf(asset kabanerov1alpha2.RepositoryAssetStatus) namespacedAssetKey {
+	return namespacedAssetKey{name: asset.Name, namespace: asset.Namespace, group: asset.Group, version: asset.Version, kind: asset.Kind}
+}
+
+// Adds the assets rendered for each of the input namespaces, other than the activation namespace, to the asset
+// list, so that they are created with the other assets.  The copies in namespaces that are no longer targeted
+// are deleted, and so are the assets of the activation namespace when it is not one of the input namespaces.
+// The assets of a namespace are only added once, when it does not have copies yet.
+func reconcileNamespaceCopies(c client.Client, value *PipelineUseMapValue, targetNamespace string, namespaces []string, assetOwner metav1.OwnerReference, options ActivationOptions, loadManifests func(namespace string) ([]StackAsset, error), logger logr.Logger) {
+	activated := false
+	targeted := make(map[string]bool)
+	for _, namespace := range namespaces {
+		if namespace != targetNamespace {
+			targeted[namespace] = true
+		} else {
+			activated = true
+		}
+	}
+
+	copied := make(map[string]bool)
+	existing := make(map[namespacedAssetKey]bool)
+	assets := []kabanerov1alpha2.RepositoryAssetStatus{}
+	for _, asset := range value.ActiveAssets {
+		if (!asset.NamespaceCopy && activated) || (asset.NamespaceCopy && targeted[asset.Namespace]) {
+			if asset.NamespaceCopy {
+				copied[asset.Namespace] = true
+			}
+			existing[assetKeyOf(asset)] = true
+			assets = append(assets, asset)
+			continue
+		}
+
+		// The namespace is no longer targeted.
+		reason := "The namespace is no longer a target namespace."
+		if !asset.NamespaceCopy {
+			reason = "The pipeline is no longer activated in namespace " + targetNamespace + "."
+		}
+		if !removeAsset(c, asset, reason, assetOwner, options, logger) {
+			assets = append(assets, asset)
+		}
+	}
+
+	for _, namespace := range namespaces {
+		if !targeted[namespace] || copied[namespace] {
+			continue
+		}
+
+		manifests, err := loadManifests(namespace)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("Unable to copy the assets to namespace %v, the manifests are not available: %v", namespace, value))
+			recordManifestError(options, value.PipelineStatus, err)
+			value.ManifestError = err
+			continue
+		}
+
+		for _, manifest := range manifests {
+			if manifest.OnDeactivate == DeactivateActionApply {
+				continue
+			}
+
+			asset := kabanerov1alpha2.RepositoryAssetStatus{
+				Name:          manifest.Name,
+				Namespace:     namespace,
+				Group:         manifest.Group,
+				Version:       manifest.Version,
+				Kind:          manifest.Kind,
+				Digest:        manifest.Sha256,
+				Status:        AssetStatusUnknown,
+				StatusMessage: "Asset has not been applied yet.",
+				NamespaceCopy: true,
+			}
+
+			// Triggers created in the namespace set in their manifest are not copied.
+			if getNamespaceForObject(&manifest.Yaml, namespace) != namespace || existing[assetKeyOf(asset)] {
+				continue
+			}
+			existing[assetKeyOf(asset)] = true
+			assets = append(assets, asset)
+		}
+	}
+
+	value.ActiveAssets = assets
+}
+
+// Deletes an asset that is no longer activated.  Returns false if the asset should be kept in the asset list: in
+// plan mode, the delete is recorded in the plan, and an asset that could not be deleted is kept so that the
+// delete is retried.
+func removeAsset(c client.Client, asset kabanerov1alpha2.RepositoryAssetStatus, reason string, assetOwner metav1.OwnerReference, options ActivationOptions, logger logr.Logger) bool {
+	if options.Plan != nil {
+		options.Plan.AddDelete(plannedAssetFromStatus(asset, reason))
+		return false
+	}
+
+	err := DeleteAsset(c, asset, assetOwner, logger)
+	if err != nil {
+		options.recordEvent(corev1.EventTypeWarning, "AssetDeleteFailed", "Unable to delete %v %v/%v: %v", asset.Kind, asset.Namespace, asset.Name, err)
+		return false
+	}
+
+	options.recordEvent(corev1.EventTypeNormal, "AssetDeleted", "Removed %v %v/%v from the activated assets", asset.Kind, asset.Namespace, asset.Name)
+	return true
+}
+
+// Reconciles the asset list with the manifests rendered with new values, in each namespace the assets were
+// rendered for.  The assets that are no longer rendered are deleted, and the new assets are added to the list,
+// so that they are created with the other assets.  Returns false if the manifests could not be rendered.
+func reconcileRenderedAssets(c client.Client, value *PipelineUseMapValue, targetNamespace string, assetOwner metav1.OwnerReference, options ActivationOptions, loadManifests func(namespace string) ([]StackAsset, error), logger logr.Logger) bool {
+	// The namespaces the assets were rendered for, and whether their assets are copies.
+	renderNamespaces := make(map[string]bool)
+	for index, asset := range value.ActiveAssets {
+		// Old assets may not have a namespace set - correct that now.
+		if len(asset.Namespace) == 0 {
+			value.ActiveAssets[index].Namespace = targetNamespace
+		}
+
+		if asset.NamespaceCopy {
+			renderNamespaces[asset.Namespace] = true
+		} else {
+			renderNamespaces[targetNamespace] = false
+		}
+	}
+
+	namespaces := make([]string, 0, len(renderNamespaces))
+	for namespace := range renderNamespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	rendered := make(map[namespacedAssetKey]kabanerov1alpha2.RepositoryAssetStatus)
+	renderedKeys := []namespacedAssetKey{}
+	for _, namespace := range namespaces {
+		manifests, err := loadManifests(namespace)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("Unable to render the assets for namespace %v, the manifests are not available: %v", namespace, value))
+			recordManifestError(options, value.PipelineStatus, err)
+			return false
+		}
+
+		namespaceCopy := renderNamespaces[namespace]
+		for _, manifest := range manifests {
+			if manifest.OnDeactivate == DeactivateActionApply {
+				continue
+			}
+
+			asset := kabanerov1alpha2.RepositoryAssetStatus{
+				Name:          manifest.Name,
+				Namespace:     getNamespaceForObject(&manifest.Yaml, namespace),
+				Group:         manifest.Group,
+				Version:       manifest.Version,
+				Kind:          manifest.Kind,
+				Digest:        manifest.Sha256,
+				Status:        AssetStatusUnknown,
+				StatusMessage: "Asset has not been applied yet.",
+				NamespaceCopy: namespaceCopy,
+			}
+
+			// Triggers created in the namespace set in their manifest are not copied.
+			if namespaceCopy && asset.Namespace != namespace {
+				continue
+			}
+			if _, ok := rendered[assetKeyOf(asset)]; !ok {
+				rendered[assetKeyOf(asset)] = asset
+				renderedKeys = append(renderedKeys, assetKeyOf(asset))
+			}
+		}
+	}
+
+	existing := make(map[namespacedAssetKey]bool)
+	assets := []kabanerov1alpha2.RepositoryAssetStatus{}
+	for _, asset := range value.ActiveAssets {
+		if _, ok := rendered[assetKeyOf(asset)]; ok {
+			existing[assetKeyOf(asset)] = true
+			assets = append(assets, asset)
+		} else if !removeAsset(c, asset, "The asset is no longer rendered from the pipeline archive.", assetOwner, options, logger) {
+			assets = append(assets, asset)
+		}
+	}
+
+	for _, key := range renderedKeys {
+		if !existing[key] {
+			assets = append(assets, rendered[key])
+		}
+	}
+
+	value.ActiveAssets = assets
+	return true
+}
+
+// Returns a digest of the values the manifests of a pipeline archive are rendered with, other than the namespace
+// they are rendered for.
+func getRenderingDigest(renderingContext map[string]interface{}) string {
+	b, err := json.Marshal(renderingContext)
+	if err != nil {
+		b = []byte(fmt.Sprint(renderingContext))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns true if the input assets include assets that are not copies in a target namespace.
+func hasActivationAssets(assets []kabanerov1alpha2.RepositoryAssetStatus) bool {
+	for _, asset := range assets {
+		if !asset.NamespaceCopy {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the input namespace is in the input list.
+func containsNamespace(namespaces []string, namespace string) bool {
+	for _, cur := range namespaces {
+		if cur == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Appends the input namespaces that are not in the list yet.
+func appendNamespaces(namespaces []string, added []string) []string {
+	for _, namespace := range added {
+		if !containsNamespace(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
 // Some objects need to get created in a specific namespace.  Try and figure out what that is.
 func getNamespaceForObject(u *unstructured.Unstructured, defaultNamespace string) string {
 	kind := u.GetKind()
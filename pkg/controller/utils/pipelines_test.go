@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"github.com/kabanero-io/kabanero-operator/pkg/controller/transforms"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Test that the assets are also activated in the target namespaces.
+func TestActivatePipelinesTargetNamespaces(t *testing.T) {
+	server := httptest.NewServer(stackHandler{})
+	defer server.Close()
+
+	spec := kabanerov1alpha2.StackSpec{
+		Name: "java-microprofile",
+		Versions: []kabanerov1alpha2.StackVersion{{
+			Version: "0.2.19",
+			Pipelines: []kabanerov1alpha2.PipelineSpec{{
+				Id:     "default",
+				Sha256: basicPipeline.sha256,
+				Https:  kabanerov1alpha2.HttpsProtocolFile{Url: server.URL + basicPipeline.name, SkipCertVerification: true},
+			}},
+		}},
+	}
+
+	created := []runtime.Object{}
+	plan := &ActivationPlan{}
+	options := ActivationOptions{Plan: plan, TargetNamespaces: []string{"kabanero", "tenant-a"}}
+	renderingContext := map[string]interface{}{"StackName": "Eclipse Microprofile", "StackId": "java-microprofile"}
+	assetUseMap, err := ActivatePipelines(spec, kabanerov1alpha2.StackStatus{}, "kabanero", renderingContext, metav1.OwnerReference{Name: "java-microprofile", UID: "1"}, planTestClient{created: &created}, options, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namespaces := make(map[string]int)
+	for _, asset := range plan.Create {
+		namespaces[asset.Namespace]++
+	}
+	if len(namespaces) != 2 || namespaces["kabanero"] == 0 || namespaces["kabanero"] != namespaces["tenant-a"] {
+		t.Fatalf("Each asset should be planned in the Kabanero namespace and the target namespace: %v", namespaces)
+	}
+
+	for _, value := range assetUseMap {
+		for _, asset := range value.ActiveAssets {
+			if asset.NamespaceCopy != (asset.Namespace == "tenant-a") {
+				t.Fatalf("Only the assets in the target namespace should be copies: %+v", asset)
+			}
+		}
+	}
+}
+
+// Test that the pipelines of a version limited to its own namespaces are only activated in these namespaces.
+func TestActivatePipelinesVersionNamespaces(t *testing.T) {
+	server := httptest.NewServer(stackHandler{})
+	defer server.Close()
+
+	spec := kabanerov1alpha2.StackSpec{
+		Name: "java-microprofile",
+		Versions: []kabanerov1alpha2.StackVersion{{
+			Version: "0.2.19",
+			Pipelines: []kabanerov1alpha2.PipelineSpec{{
+				Id:     "default",
+				Sha256: basicPipeline.sha256,
+				Https:  kabanerov1alpha2.HttpsProtocolFile{Url: server.URL + basicPipeline.name, SkipCertVerification: true},
+			}},
+		}},
+	}
+
+	created := []runtime.Object{}
+	plan := &ActivationPlan{}
+	options := ActivationOptions{Plan: plan, TargetNamespaces: []string{"tenant-a", "tenant-b"}, VersionNamespaces: map[string][]string{"0.2.19": {"tenant-b"}}}
+	renderingContext := map[string]interface{}{"StackName": "Eclipse Microprofile", "StackId": "java-microprofile"}
+	assetUseMap, err := ActivatePipelines(spec, kabanerov1alpha2.StackStatus{}, "kabanero", renderingContext, metav1.OwnerReference{Name: "java-microprofile", UID: "1"}, planTestClient{created: &created}, options, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Create) == 0 {
+		t.Fatal("The assets should be planned in namespace tenant-b")
+	}
+	for _, asset := range plan.Create {
+		if asset.Namespace != "tenant-b" {
+			t.Fatalf("The assets should only be planned in namespace tenant-b: %+v", asset)
+		}
+	}
+
+	for _, value := range assetUseMap {
+		for _, asset := range value.ActiveAssets {
+			if !asset.NamespaceCopy || asset.Namespace != "tenant-b" {
+				t.Fatalf("Only copies in namespace tenant-b should be activated: %+v", asset)
+			}
+		}
+	}
+}
+
+// Test that the assets are reconciled with the manifests rendered with new values, in each namespace the assets
+// were rendered for.
+func TestReconcileRenderedAssets(t *testing.T) {
+	pipeline := kabanerov1alpha2.RepositoryAssetStatus{Name: "build-pipeline", Group: "tekton.dev", Version: "v1alpha1", Kind: "Pipeline", Status: AssetStatusActive}
+	task := kabanerov1alpha2.RepositoryAssetStatus{Name: "scan-task", Namespace: "kabanero", Group: "tekton.dev", Version: "v1alpha1", Kind: "Task", Status: AssetStatusActive}
+	copied := pipeline
+	copied.Namespace = "tenant-a"
+	copied.NamespaceCopy = true
+
+	// The scan task is no longer rendered, and a deploy task is now rendered.
+	rendered := []string{}
+	loadManifests := func(namespace string) ([]StackAsset, error) {
+		rendered = append(rendered, namespace)
+		manifests := []StackAsset{}
+		for _, asset := range []kabanerov1alpha2.RepositoryAssetStatus{pipeline, {Name: "deploy-task", Group: "tekton.dev", Version: "v1alpha1", Kind: "Task"}} {
+			u := unstructured.Unstructured{}
+			u.SetKind(asset.Kind)
+			u.SetName(asset.Name)
+			manifests = append(manifests, StackAsset{Name: asset.Name, Group: asset.Group, Version: asset.Version, Kind: asset.Kind, Yaml: u})
+		}
+		return manifests, nil
+	}
+
+	value := &PipelineUseMapValue{PipelineStatus: kabanerov1alpha2.PipelineStatus{ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{pipeline, task, copied}}}
+	plan := &ActivationPlan{}
+	if !reconcileRenderedAssets(nil, value, "kabanero", metav1.OwnerReference{UID: "1"}, ActivationOptions{Plan: plan}, loadManifests, logf.NullLogger{}) {
+		t.Fatal("The assets should have been rendered")
+	}
+
+	if len(rendered) != 2 || rendered[0] != "kabanero" || rendered[1] != "tenant-a" {
+		t.Fatalf("The manifests should have been rendered for the Kabanero namespace and the target namespace: %v", rendered)
+	}
+
+	if len(plan.Delete) != 1 || plan.Delete[0].Name != "scan-task" {
+		t.Fatalf("The task that is no longer rendered should be planned for deletion: %+v", plan.Delete)
+	}
+
+	added := make(map[string]bool)
+	for _, asset := range value.ActiveAssets {
+		if asset.Name == "deploy-task" {
+			if asset.Status != AssetStatusUnknown || asset.NamespaceCopy != (asset.Namespace == "tenant-a") {
+				t.Fatalf("Unexpected new asset: %+v", asset)
+			}
+			added[asset.Namespace] = true
+		}
+	}
+	if len(value.ActiveAssets) != 5 || !added["kabanero"] || !added["tenant-a"] {
+		t.Fatalf("The new task should have been added in each namespace: %+v", value.ActiveAssets)
+	}
+
+	// The digest changes with the values the manifests are rendered with.
+	digest := getRenderingDigest(map[string]interface{}{"StackId": "java-microprofile", "Parameters": map[string]string{"registry": "a"}})
+	if digest != getRenderingDigest(map[string]interface{}{"Parameters": map[string]string{"registry": "a"}, "StackId": "java-microprofile"}) {
+		t.Fatal("The rendering digest should not depend on the order of the values")
+	}
+	if digest == getRenderingDigest(map[string]interface{}{"StackId": "java-microprofile", "Parameters": map[string]string{"registry": "b"}}) {
+		t.Fatal("The rendering digest should change with the values")
+	}
+}
+
+// Test that the copies in the namespaces that are no longer targeted are removed, and that the copies in the
+// new target namespaces are rendered for their namespace.
+func TestReconcileNamespaceCopies(t *testing.T) {
+	pipeline := kabanerov1alpha2.RepositoryAssetStatus{Name: "build-pipeline", Group: "tekton.dev", Version: "v1alpha1", Kind: "Pipeline", Status: AssetStatusActive}
+	assets := []kabanerov1alpha2.RepositoryAssetStatus{}
+	for _, namespace := range []string{"kabanero", "tenant-a", "tenant-b"} {
+		asset := pipeline
+		asset.Namespace = namespace
+		asset.NamespaceCopy = namespace != "kabanero"
+		assets = append(assets, asset)
+	}
+
+	// A trigger created in the namespace set in its manifest is not a copy.
+	assets = append(assets, kabanerov1alpha2.RepositoryAssetStatus{Name: "listener", Namespace: "tekton-pipelines", Group: "triggers.tekton.dev", Version: "v1alpha1", Kind: "EventListener", Status: AssetStatusActive})
+
+	rendered := []string{}
+	loadManifests := func(namespace string) ([]StackAsset, error) {
+		rendered = append(rendered, namespace)
+		u := unstructured.Unstructured{}
+		u.SetKind("Pipeline")
+		u.SetName("build-pipeline-" + namespace)
+		listener := unstructured.Unstructured{}
+		listener.SetKind("EventListener")
+		listener.SetName("listener")
+		listener.SetNamespace("tekton-pipelines")
+		return []StackAsset{
+			{Name: u.GetName(), Group: "tekton.dev", Version: "v1alpha1", Kind: "Pipeline", Yaml: u},
+			{Name: "listener", Group: "triggers.tekton.dev", Version: "v1alpha1", Kind: "EventListener", Yaml: listener},
+		}, nil
+	}
+
+	value := &PipelineUseMapValue{PipelineStatus: kabanerov1alpha2.PipelineStatus{ActiveAssets: assets}}
+	plan := &ActivationPlan{}
+	reconcileNamespaceCopies(nil, value, "kabanero", []string{"kabanero", "tenant-a", "tenant-c"}, metav1.OwnerReference{UID: "1"}, ActivationOptions{Plan: plan}, loadManifests, logf.NullLogger{})
+
+	if len(rendered) != 1 || rendered[0] != "tenant-c" {
+		t.Fatalf("Only the manifests of the new target namespace should have been rendered: %v", rendered)
+	}
+
+	if len(plan.Delete) != 1 || plan.Delete[0].Namespace != "tenant-b" {
+		t.Fatalf("The copy in tenant-b should be planned for deletion: %+v", plan.Delete)
+	}
+
+	found := make(map[string]string)
+	for _, asset := range value.ActiveAssets {
+		found[asset.Namespace] = asset.Status
+	}
+	if len(found) != 5 || found["tenant-c"] != AssetStatusUnknown || found["tenant-a"] != AssetStatusActive || found["tekton-pipelines"] != AssetStatusActive {
+		t.Fatalf("Unexpected assets: %+v", value.ActiveAssets)
+	}
+
+	for _, asset := range value.ActiveAssets {
+		if asset.Namespace == "tenant-c" && (asset.Name != "build-pipeline-tenant-c" || !asset.NamespaceCopy) {
+			t.Fatalf("The copy in tenant-c should have been rendered for its namespace: %+v", asset)
+		}
+	}
+}
+
+// Test that the owners of a copy are read from and written to its annotation.
+func TestAnnotationOwners(t *testing.T) {
+	u := &unstructured.Unstructured{}
+	transforms.SetAnnotationOwners(u, []string{"1", "2"})
+	if owners := transforms.AnnotationOwners(u); len(owners) != 2 || owners[1] != "2" {
+		t.Fatalf("Unexpected owners: %v", owners)
+	}
+
+	transforms.SetAnnotationOwners(u, nil)
+	if _, ok := u.GetAnnotations()[transforms.OwnersAnnotation]; ok {
+		t.Fatalf("The owners annotation should be removed: %v", u.GetAnnotations())
+	}
+}
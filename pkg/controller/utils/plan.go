@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Annotation requesting that activation changes are computed and published, but not applied.
+	// It can be set on a Stack, or on a Kabanero instance to cover all of the stacks in its namespace.
+	PlanModeAnnotation = "kabanero.io/plan-mode"
+
+	// The key of the activation plan in the ConfigMap it is published to.
+	ActivationPlanKey = "plan.yaml"
+
+	// The prefix of the status messages summarizing an activation plan.
+	PlanSummaryPrefix = "Plan mode:"
+)
+
+// An asset that would be created, updated or deleted if the activation was applied.
+type PlannedAsset struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	Group     string `yaml:"group"`
+	Version   string `yaml:"version"`
+	Kind      string `yaml:"kind"`
+	Reason    string `yaml:"reason,omitempty"`
+	Manifest  string `yaml:"manifest,omitempty"`
+}
+
+// The set of changes that would be made to the cluster by an activation.
+type ActivationPlan struct {
+	Create []PlannedAsset `yaml:"create,omitempty"`
+	Update []PlannedAsset `yaml:"update,omitempty"`
+	Delete []PlannedAsset `yaml:"delete,omitempty"`
+}
+
+// Options controlling how pipelines are activated.
+type ActivationOptions struct {
+	// If set, the signatures of the pipeline archives are verified before their assets are created.
+	Verifier *SignatureVerifier
+
+	// If set, the changes are recorded in the plan instead of being applied.
+	Plan *ActivationPlan
+
+	// Determines how changes made to the activated assets are handled: report or revert. If not set, the
+	// activated assets are not checked for changes.
+	DriftPolicy string
+
+	// If set, events are recorded on the EventObject when assets are created or deleted, and when the
+	// manifests of a pipeline archive cannot be read.
+	Recorder    record.EventRecorder
+	EventObject runtime.Object
+
+	// Values added to the rendering context when the manifests of a pipeline archive are read, keyed by the
+	// version that uses the archive.  If several versions use the same archive, the values of the highest
+	// version are used.
+	VersionContext map[string]map[string]interface{}
+
+	// If set, the assets created in the activation namespace are also created in each of these namespaces.
+	// The copies are owned through an annotation, since owner references cannot cross namespaces.
+	TargetNamespaces []string
+
+	// Namespaces the pipelines of a version are limited to, keyed by version.  The pipelines of these versions
+	// are activated in their namespaces only, instead of the activation namespace and the target namespaces.
+	VersionNamespaces map[string][]string
+}
+
+// Records an event on the event object, if an event recorder was configured.
+func (o ActivationOptions) recordEvent(eventtype, reason, messageFmt string, args ...interface{}) {
+	if o.Recorder == nil || o.EventObject == nil {
+		return
+	}
+	o.Recorder.Eventf(o.EventObject, eventtype, reason, messageFmt, args...)
+}
+
+// Returns true if plan mode was requested on any of the input objects.
+func IsPlanMode(objs ...metav1.Object) bool {
+	for _, obj := range objs {
+		if obj == nil {
+			continue
+		}
+		if strings.EqualFold(obj.GetAnnotations()[PlanModeAnnotation], "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// Records an asset that would be created from the input rendered manifest.
+func (p *ActivationPlan) AddCreate(asset PlannedAsset, manifest unstructured.Unstructured) {
+	b, err := yaml.Marshal(manifest.Object)
+	if err != nil {
+		asset.Manifest = fmt.Sprintf("Unable to render the manifest: %v", err)
+	} else {
+		asset.Manifest = string(b)
+	}
+	p.Create = append(p.Create, asset)
+}
+
+// Records an asset that would be updated.
+func (p *ActivationPlan) AddUpdate(asset PlannedAsset) {
+	p.Update = append(p.Update, asset)
+}
+
+// Records an asset that would be deleted.
+func (p *ActivationPlan) AddDelete(asset PlannedAsset) {
+	p.Delete = append(p.Delete, asset)
+}
+
+// Returns true if the plan does not contain any changes.
+func (p *ActivationPlan) IsEmpty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// Returns a one line summary of the plan.
+func (p *ActivationPlan) Summary() string {
+	return fmt.Sprintf("%v %v asset(s) to create, %v to update, %v to delete.", PlanSummaryPrefix, len(p.Create), len(p.Update), len(p.Delete))
+}
+
+// Publishes the plan to a ConfigMap with the input name, owned by the input owner. The ConfigMap is created
+// if it does not exist yet.
+func PublishActivationPlan(c client.Client, plan *ActivationPlan, name string, namespace string, owner metav1.OwnerReference, logger logr.Logger) error {
+	b, err := yaml.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("Unable to serialize the activation plan for ConfigMap %v in namespace %v: %v", name, namespace, err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = c.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: namespace}, configMap)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("Unable to retrieve activation plan ConfigMap %v in namespace %v: %v", name, namespace, err)
+		}
+
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       namespace,
+				OwnerReferences: []metav1.OwnerReference{owner},
+			},
+			Data: map[string]string{ActivationPlanKey: string(b)},
+		}
+
+		logger.Info(fmt.Sprintf("Creating activation plan ConfigMap %v in namespace %v", name, namespace))
+		err = c.Create(context.TODO(), configMap)
+		if err != nil {
+			return fmt.Errorf("Unable to create activation plan ConfigMap %v in namespace %v: %v", name, namespace, err)
+		}
+		return nil
+	}
+
+	configMap.Data = map[string]string{ActivationPlanKey: string(b)}
+	err = c.Update(context.TODO(), configMap)
+	if err != nil {
+		return fmt.Errorf("Unable to update activation plan ConfigMap %v in namespace %v: %v", name, namespace, err)
+	}
+
+	return nil
+}
+
+// Returns a planned asset describing the input asset status.
+func plannedAssetFromStatus(asset kabanerov1alpha2.RepositoryAssetStatus, reason string) PlannedAsset {
+	return PlannedAsset{Name: asset.Name, Namespace: asset.Namespace, Group: asset.Group, Version: asset.Version, Kind: asset.Kind, Reason: reason}
+}
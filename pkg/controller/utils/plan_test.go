@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Unit test client that does not find any object, and records the objects created.
+type planTestClient struct {
+	archiveTestClient
+	created *[]runtime.Object
+}
+
+func (c planTestClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+func (c planTestClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	*c.created = append(*c.created, obj)
+	return nil
+}
+func (c planTestClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	return errors.New("Delete should not be called in plan mode")
+}
+func (c planTestClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return errors.New("Update should not be called in plan mode")
+}
+
+// Test that plan mode is requested with an annotation.
+func TestIsPlanMode(t *testing.T) {
+	stack := &kabanerov1alpha2.Stack{}
+	if IsPlanMode(stack) {
+		t.Fatal("Plan mode should not be requested without the annotation")
+	}
+
+	kabanero := &kabanerov1alpha2.Kabanero{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{PlanModeAnnotation: "True"}}}
+	if !IsPlanMode(stack, kabanero) {
+		t.Fatal("Plan mode should be requested by the Kabanero instance annotation")
+	}
+}
+
+// Test that the assets are recorded in the plan, and not created, in plan mode.
+func TestActivatePipelinesPlanMode(t *testing.T) {
+	server := httptest.NewServer(stackHandler{})
+	defer server.Close()
+
+	spec := kabanerov1alpha2.StackSpec{
+		Name: "java-microprofile",
+		Versions: []kabanerov1alpha2.StackVersion{{
+			Version: "0.2.19",
+			Pipelines: []kabanerov1alpha2.PipelineSpec{{
+				Id:     "default",
+				Sha256: basicPipeline.sha256,
+				Https:  kabanerov1alpha2.HttpsProtocolFile{Url: server.URL + basicPipeline.name, SkipCertVerification: true},
+			}},
+		}},
+	}
+
+	// A previously activated version that is no longer in the spec.
+	status := kabanerov1alpha2.StackStatus{
+		Versions: []kabanerov1alpha2.StackVersionStatus{{
+			Version: "0.2.18",
+			Pipelines: []kabanerov1alpha2.PipelineStatus{{
+				Url:    "https://example.com/old.pipeline.tar.gz",
+				Digest: "0123456789",
+				ActiveAssets: []kabanerov1alpha2.RepositoryAssetStatus{{
+					Name:      "old-pipeline",
+					Namespace: "kabanero",
+					Group:     "tekton.dev",
+					Version:   "v1alpha1",
+					Kind:      "Pipeline",
+					Status:    AssetStatusActive,
+				}},
+			}},
+		}},
+	}
+
+	created := []runtime.Object{}
+	plan := &ActivationPlan{}
+	renderingContext := map[string]interface{}{"StackName": "Eclipse Microprofile", "StackId": "java-microprofile"}
+	_, err := ActivatePipelines(spec, status, "kabanero", renderingContext, metav1.OwnerReference{Name: "java-microprofile", UID: "1"}, planTestClient{created: &created}, ActivationOptions{Plan: plan}, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 0 {
+		t.Fatalf("No objects should have been created in plan mode, but %v were", len(created))
+	}
+
+	if len(plan.Create) == 0 {
+		t.Fatal("The plan should contain the assets to create")
+	}
+	for _, asset := range plan.Create {
+		if len(asset.Manifest) == 0 || asset.Namespace != "kabanero" {
+			t.Fatalf("The planned asset should contain the rendered manifest and namespace: %+v", asset)
+		}
+	}
+
+	if len(plan.Delete) != 1 || plan.Delete[0].Name != "old-pipeline" {
+		t.Fatalf("The plan should contain the asset of the removed version to delete: %+v", plan.Delete)
+	}
+
+	if !strings.HasPrefix(plan.Summary(), PlanSummaryPrefix) {
+		t.Fatalf("Unexpected plan summary: %v", plan.Summary())
+	}
+}
+
+// Test that the plan is published to a ConfigMap.
+func TestPublishActivationPlan(t *testing.T) {
+	created := []runtime.Object{}
+	plan := &ActivationPlan{Delete: []PlannedAsset{{Name: "old-pipeline", Namespace: "kabanero", Kind: "Pipeline"}}}
+	err := PublishActivationPlan(planTestClient{created: &created}, plan, "java-microprofile-activation-plan", "kabanero", metav1.OwnerReference{Name: "java-microprofile"}, logf.NullLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("One ConfigMap should have been created, but %v were", len(created))
+	}
+
+	configMap := created[0].(*corev1.ConfigMap)
+	published := ActivationPlan{}
+	err = yaml.Unmarshal([]byte(configMap.Data[ActivationPlanKey]), &published)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(published.Delete) != 1 || published.Delete[0].Name != "old-pipeline" {
+		t.Fatalf("Unexpected published plan: %+v", published)
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+)
+
+// An ActivationRenderer customizes the source content from the repository before it is applied
+type ActivationRenderer interface {
+	//Render processes the yaml source content before it is unmarshaled into an object model
+	Render(b []byte, context map[string]interface{}) ([]byte, error)
+}
+
+// The renderers that can be requested by the manifest.yaml of a pipeline archive.
+const (
+	// Only the #Kabanero! directives are processed.  This is the default.
+	RendererDirective = "directive"
+
+	// The files are rendered as Go templates, then the #Kabanero! directives in the output are processed.
+	RendererTemplate = "template"
+)
+
+var activationRenderers = map[string]ActivationRenderer{
+	RendererDirective: DirectiveProcessor{},
+	RendererTemplate:  TemplateRenderer{},
+}
+
+// Returns the renderer with the input name.  The directive renderer is returned if no name is provided.
+func getActivationRenderer(name string) (ActivationRenderer, error) {
+	if len(name) == 0 {
+		name = RendererDirective
+	}
+
+	renderer, ok := activationRenderers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown renderer: %v", name)
+	}
+	return renderer, nil
+}
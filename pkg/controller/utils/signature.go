@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"golang.org/x/crypto/openpgp"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Signature formats.
+	SignatureFormatCosign = "cosign"
+	SignatureFormatGPG    = "gpg"
+
+	// Kinds of objects holding trusted public keys.
+	SignatureKeysKindSecret    = "Secret"
+	SignatureKeysKindConfigMap = "ConfigMap"
+)
+
+// SignatureVerifier verifies the detached signatures of stack indexes and pipeline archives against a set
+// of trusted public keys.
+type SignatureVerifier struct {
+	format     string
+	publicKeys []crypto.PublicKey
+	keyRing    openpgp.EntityList
+
+	// The error encountered while loading the trusted public keys, if any.
+	keyError error
+}
+
+// Returns a signature verifier for the input configuration, or nil if signature verification is not
+// configured. If the trusted public keys could not be loaded, every verification fails with the reason,
+// so that it is reported in the status of the components being verified.
+func NewSignatureVerifier(c client.Client, config kabanerov1alpha2.SignatureVerificationConfig, namespace string) *SignatureVerifier {
+	if len(config.Keys.Name) == 0 {
+		return nil
+	}
+
+	verifier := &SignatureVerifier{format: strings.ToLower(config.Format)}
+	if len(verifier.format) == 0 {
+		verifier.format = SignatureFormatCosign
+	}
+
+	keyData, err := getSignatureKeyData(c, config.Keys, namespace)
+	if err != nil {
+		verifier.keyError = err
+		return verifier
+	}
+
+	switch verifier.format {
+	case SignatureFormatCosign:
+		for _, data := range keyData {
+			keys, err := parsePEMPublicKeys(data)
+			if err != nil {
+				verifier.keyError = fmt.Errorf("Unable to parse the trusted public keys in %v %v: %v", config.Keys.Kind, config.Keys.Name, err)
+				return verifier
+			}
+			verifier.publicKeys = append(verifier.publicKeys, keys...)
+		}
+		if len(verifier.publicKeys) == 0 {
+			verifier.keyError = fmt.Errorf("%v %v does not contain any trusted public keys", config.Keys.Kind, config.Keys.Name)
+		}
+	case SignatureFormatGPG:
+		for _, data := range keyData {
+			keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+			if err != nil {
+				keyRing, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+			}
+			if err != nil {
+				verifier.keyError = fmt.Errorf("Unable to parse the trusted public key ring in %v %v: %v", config.Keys.Kind, config.Keys.Name, err)
+				return verifier
+			}
+			verifier.keyRing = append(verifier.keyRing, keyRing...)
+		}
+		if len(verifier.keyRing) == 0 {
+			verifier.keyError = fmt.Errorf("%v %v does not contain any trusted public keys", config.Keys.Kind, config.Keys.Name)
+		}
+	default:
+		verifier.keyError = fmt.Errorf("Signature format %v is not supported. Specify cosign or gpg", config.Format)
+	}
+
+	return verifier
+}
+
+// Returns the suffix appended to the location of a file to locate its detached signature.
+func (v *SignatureVerifier) SignatureSuffix() string {
+	if v.format == SignatureFormatGPG {
+		return ".asc"
+	}
+	return ".sig"
+}
+
+// Verifies the detached signature of the input content. The name identifies the content in error messages.
+func (v *SignatureVerifier) Verify(name string, content []byte, signature []byte) error {
+	if v.keyError != nil {
+		return fmt.Errorf("Unable to verify the signature of %v. %v", name, v.keyError)
+	}
+
+	if len(signature) == 0 {
+		return fmt.Errorf("The signature of %v is empty", name)
+	}
+
+	var err error
+	if v.format == SignatureFormatGPG {
+		err = v.verifyGPG(content, signature)
+	} else {
+		err = v.verifyCosign(content, signature)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Signature verification of %v failed: %v", name, err)
+	}
+
+	return nil
+}
+
+// Verifies a cosign-style signature: a base64 encoded signature over the SHA-256 digest of the content.
+func (v *SignatureVerifier) verifyCosign(content []byte, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		// The signature may have been stored in its raw form.
+		sig = signature
+	}
+
+	digest := sha256.Sum256(content)
+	for _, key := range v.publicKeys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			var esig struct {
+				R, S *big.Int
+			}
+			if _, err := asn1.Unmarshal(sig, &esig); err == nil && ecdsa.Verify(k, digest[:], esig.R, esig.S) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, content, sig) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("the signature does not match any of the %v trusted public keys", len(v.publicKeys))
+}
+
+// Verifies an armored or binary GPG detached signature.
+func (v *SignatureVerifier) verifyGPG(content []byte, signature []byte) error {
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN PGP SIGNATURE-----")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(v.keyRing, bytes.NewReader(content), bytes.NewReader(signature))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(v.keyRing, bytes.NewReader(content), bytes.NewReader(signature))
+	}
+	return err
+}
+
+// Returns the data entries of the Secret or ConfigMap holding the trusted public keys, sorted by key.
+func getSignatureKeyData(c client.Client, keys kabanerov1alpha2.SignatureKeysReference, namespace string) ([][]byte, error) {
+	data := make(map[string][]byte)
+	key := client.ObjectKey{Namespace: namespace, Name: keys.Name}
+
+	switch {
+	case len(keys.Kind) == 0 || strings.EqualFold(keys.Kind, SignatureKeysKindSecret):
+		secret := &corev1.Secret{}
+		err := c.Get(context.TODO(), key, secret)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to retrieve Secret %v holding the trusted public keys in namespace %v: %v", keys.Name, namespace, err)
+		}
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+	case strings.EqualFold(keys.Kind, SignatureKeysKindConfigMap):
+		configMap := &corev1.ConfigMap{}
+		err := c.Get(context.TODO(), key, configMap)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to retrieve ConfigMap %v holding the trusted public keys in namespace %v: %v", keys.Name, namespace, err)
+		}
+		for k, v := range configMap.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range configMap.BinaryData {
+			data[k] = v
+		}
+	default:
+		return nil, fmt.Errorf("The trusted public keys must be held in a Secret or ConfigMap. Kind %v is not supported", keys.Kind)
+	}
+
+	names := make([]string, 0, len(data))
+	for k := range data {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	keyData := [][]byte{}
+	for _, name := range names {
+		keyData = append(keyData, data[name])
+	}
+
+	return keyData, nil
+}
+
+// Parses all PEM encoded public keys in the input data.
+func parsePEMPublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	keys := []crypto.PublicKey{}
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		data = rest
+
+		if block.Type != "PUBLIC KEY" && block.Type != "RSA PUBLIC KEY" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		if block.Type == "RSA PUBLIC KEY" {
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		} else {
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
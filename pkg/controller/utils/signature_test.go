@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Unit test client returning the Secret holding the trusted public keys.
+type signatureTestClient struct {
+	archiveTestClient
+	keys map[string][]byte
+}
+
+func (c signatureTestClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || key.Name != "trusted-keys" {
+		return c.archiveTestClient.Get(ctx, key, obj)
+	}
+	secret.Data = c.keys
+	return nil
+}
+
+var signatureConfig = kabanerov1alpha2.SignatureVerificationConfig{
+	Keys: kabanerov1alpha2.SignatureKeysReference{Kind: "Secret", Name: "trusted-keys"},
+}
+
+// Test that cosign-style signatures are verified against PEM encoded public keys.
+func TestVerifyCosignSignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	content := []byte("apiVersion: v2\nstacks: []\n")
+	digest := sha256.Sum256(content)
+	sig, err := privateKey.Sign(rand.Reader, digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := []byte(base64.StdEncoding.EncodeToString(sig))
+
+	verifier := NewSignatureVerifier(signatureTestClient{keys: map[string][]byte{"cosign.pub": publicKey}}, signatureConfig, "kabanero")
+	if verifier == nil {
+		t.Fatal("A signature verifier should have been created")
+	}
+
+	if err := verifier.Verify("index.yaml", content, signature); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifier.Verify("index.yaml", []byte("apiVersion: v2\nstacks: [tampered]\n"), signature); err == nil {
+		t.Fatal("Verification of tampered content should have failed")
+	}
+
+	if verifier.SignatureSuffix() != ".sig" {
+		t.Fatalf("Unexpected cosign signature suffix: %v", verifier.SignatureSuffix())
+	}
+}
+
+// Test that armored GPG detached signatures are verified against an armored public key ring.
+func TestVerifyGPGSignature(t *testing.T) {
+	entity, err := openpgp.NewEntity("Kabanero", "test", "kabanero@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyRing := &bytes.Buffer{}
+	w, err := armor.Encode(keyRing, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	content := []byte("pipeline archive content")
+	signature := &bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(signature, entity, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	config := signatureConfig
+	config.Format = "gpg"
+	verifier := NewSignatureVerifier(signatureTestClient{keys: map[string][]byte{"pubring.asc": keyRing.Bytes()}}, config, "kabanero")
+
+	if err := verifier.Verify("pipeline.tar.gz", content, signature.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifier.Verify("pipeline.tar.gz", []byte("tampered"), signature.Bytes()); err == nil {
+		t.Fatal("Verification of tampered content should have failed")
+	}
+}
+
+// Test that verification is disabled without a key reference, and fails when the keys cannot be loaded.
+func TestSignatureVerifierConfiguration(t *testing.T) {
+	if NewSignatureVerifier(archiveTestClient{}, kabanerov1alpha2.SignatureVerificationConfig{}, "kabanero") != nil {
+		t.Fatal("Signature verification should be disabled when no key reference is configured")
+	}
+
+	config := signatureConfig
+	config.Keys.Name = "missing-keys"
+	verifier := NewSignatureVerifier(signatureTestClient{}, config, "kabanero")
+	if err := verifier.Verify("index.yaml", []byte("content"), []byte("signature")); err == nil {
+		t.Fatal("Verification should fail when the trusted public keys cannot be loaded")
+	}
+}
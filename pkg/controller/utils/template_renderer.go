@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/blang/semver"
+	yml "gopkg.in/yaml.v2"
+)
+
+// The maximum size of a rendered file.  Rendering stops with an error once it is exceeded.
+const maxRenderedSize = 4 * 1024 * 1024
+
+// The TemplateRenderer renders the yaml source as a Go text/template, with the rendering context as its data
+// (i.e. {{ .StackId }}).  Like the DirectiveProcessor, it only has access to the rendering context: the helper
+// functions do not read files, the environment or the network, and the size of the output is limited.
+type TemplateRenderer struct {
+}
+
+func (g TemplateRenderer) Render(b []byte, context map[string]interface{}) ([]byte, error) {
+	tmpl, err := template.New("manifest").Option("missingkey=error").Funcs(templateFuncs).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &limitedBuffer{limit: maxRenderedSize}
+	err = tmpl.Execute(out, context)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// A buffer that returns an error once its limit is exceeded.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if l.Len()+len(p) > l.limit {
+		return 0, fmt.Errorf("The rendered file exceeds the maximum size of %v bytes", l.limit)
+	}
+	return l.Buffer.Write(p)
+}
+
+// Helper functions modeled after the sprig library, with the same argument order.
+var templateFuncs = template.FuncMap{
+	"default":       defaultValue,
+	"empty":         isEmpty,
+	"upper":         strings.ToUpper,
+	"lower":         strings.ToLower,
+	"trim":          strings.TrimSpace,
+	"trimPrefix":    func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":    func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":       replace,
+	"contains":      func(substr string, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":     func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":     func(suffix string, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":         func(sep string, s string) []string { return strings.Split(s, sep) },
+	"join":          join,
+	"quote":         func(s interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(s)) },
+	"squote":        func(s interface{}) string { return "'" + fmt.Sprint(s) + "'" },
+	"indent":        indent,
+	"nindent":       nindent,
+	"list":          func(values ...interface{}) []interface{} { return values },
+	"dict":          dict,
+	"hasKey":        hasKey,
+	"has":           has,
+	"toYaml":        toYaml,
+	"b64enc":        func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec":        b64dec,
+	"semverCompare": semverCompare,
+}
+
+// Returns the value, or the default value if the value is empty.
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || isEmpty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// Returns true if the value is nil, or the zero value of its type, or an empty collection.
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return reflect.DeepEqual(value, reflect.Zero(v.Type()).Interface())
+	}
+}
+
+// Joins the elements of a list, which are formatted as strings.
+func join(sep string, list interface{}) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("Unable to join %v: not a list", list)
+	}
+
+	elements := make([]string, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elements[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(elements, sep), nil
+}
+
+// The helpers that can grow their input check the size of their result before building it, since
+// the limitedBuffer only sees it once it is complete.
+func checkResultSize(size int) error {
+	if size < 0 || size > maxRenderedSize {
+		return fmt.Errorf("The rendered file exceeds the maximum size of %v bytes", maxRenderedSize)
+	}
+	return nil
+}
+
+// Replaces every occurrence of old in the input string.
+func replace(old string, new string, s string) (string, error) {
+	if len(new) > len(old) {
+		if err := checkResultSize(len(new)); err != nil {
+			return "", err
+		}
+		if err := checkResultSize(len(s) + strings.Count(s, old)*(len(new)-len(old))); err != nil {
+			return "", err
+		}
+	}
+	return strings.ReplaceAll(s, old, new), nil
+}
+
+// Indents every line of the input string.
+func indent(spaces int, s string) (string, error) {
+	if spaces < 0 {
+		return "", fmt.Errorf("Unable to indent by %v spaces", spaces)
+	}
+	if err := checkResultSize(spaces); err != nil {
+		return "", err
+	}
+	if err := checkResultSize(len(s) + spaces*(strings.Count(s, "\n")+1)); err != nil {
+		return "", err
+	}
+
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1), nil
+}
+
+// Indents every line of the input string, after a leading newline.
+func nindent(spaces int, s string) (string, error) {
+	indented, err := indent(spaces, s)
+	if err != nil {
+		return "", err
+	}
+	return "\n" + indented, nil
+}
+
+// Creates a map from a list of key and value pairs.
+func dict(values ...interface{}) (map[string]interface{}, error) {
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("dict requires an even number of arguments")
+	}
+
+	d := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		d[fmt.Sprint(values[i])] = values[i+1]
+	}
+	return d, nil
+}
+
+// Returns true if the map contains the key.
+func hasKey(m interface{}, key string) bool {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return false
+	}
+	return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid()
+}
+
+// Returns true if the list contains the value.
+func has(value interface{}, list interface{}) bool {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if reflect.DeepEqual(v.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Formats the value as yaml, without a trailing newline.
+func toYaml(value interface{}) (string, error) {
+	b, err := yml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResultSize(len(b)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Returns true if the version satisfies the constraint (i.e. ">=0.3.0 <1.0.0").
+func semverCompare(constraint string, version string) (bool, error) {
+	r, err := semver.ParseRange(constraint)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return false, err
+	}
+
+	return r(v), nil
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateRenderer(t *testing.T) {
+	provided := []byte(`apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: {{ .StackId }}-build-task
+  annotations:
+    namespaces: {{ join "," .TargetNamespaces | quote }}
+spec:
+  steps:
+{{- range $id, $image := .Images }}
+  - name: {{ $id }}
+    image: {{ $image }}
+{{- end }}
+{{- if semverCompare ">=0.3.0" .StackVersion }}
+  - name: scan
+    image: {{ default "docker.io" (index .Parameters "registry") }}/scanner
+{{- end }}
+`)
+
+	context := map[string]interface{}{
+		"StackId":          "my-stack",
+		"StackVersion":     "0.3.1",
+		"TargetNamespaces": []string{"dev", "test"},
+		"Images":           map[string]string{"build": "docker.io/kabanero/nodejs@sha256:abc"},
+		"Parameters":       map[string]string{},
+	}
+
+	expected := `apiVersion: tekton.dev/v1alpha1
+kind: Task
+metadata:
+  name: my-stack-build-task
+  annotations:
+    namespaces: "dev,test"
+spec:
+  steps:
+  - name: build
+    image: docker.io/kabanero/nodejs@sha256:abc
+  - name: scan
+    image: docker.io/scanner
+`
+
+	r := TemplateRenderer{}
+	b_output, err := r.Render(provided, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b_output) != expected {
+		t.Fatal("Output did not match expectations", string(b_output), expected)
+	}
+}
+
+func TestTemplateRendererErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provided string
+	}{
+		{name: "Unknown key", provided: "name: {{ .Unknown }}"},
+		{name: "Unknown function", provided: `name: {{ env "HOME" }}`},
+		{name: "Output too large", provided: `{{ define "loop" }}{{ . }}{{ template "loop" (printf "%v%v" . .) }}{{ end }}{{ template "loop" "x" }}`},
+		{name: "Indent too large", provided: `{{ indent 2000000000 "x" }}`},
+		{name: "Nindent too large", provided: `{{ nindent 2000000000 "x" }}`},
+		{name: "Negative indent", provided: `{{ indent -1 "x" }}`},
+		{name: "Replace too large", provided: `{{ replace "x" (printf "%4000000s" "y") "xx" }}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := TemplateRenderer{}
+			_, err := r.Render([]byte(tc.provided), map[string]interface{}{})
+			if err == nil {
+				t.Fatalf("Expected an error rendering: %v", tc.provided)
+			}
+		})
+	}
+}
+
+func TestGetActivationRenderer(t *testing.T) {
+	renderer, err := getActivationRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := renderer.(DirectiveProcessor); !ok {
+		t.Fatalf("Expected the directive renderer by default, but found %T", renderer)
+	}
+
+	renderer, err = getActivationRenderer(RendererTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := renderer.(TemplateRenderer); !ok {
+		t.Fatalf("Expected the template renderer, but found %T", renderer)
+	}
+
+	_, err = getActivationRenderer("helm")
+	if err == nil || !strings.Contains(err.Error(), "Unknown renderer") {
+		t.Fatalf("Expected an unknown renderer error, but found: %v", err)
+	}
+}
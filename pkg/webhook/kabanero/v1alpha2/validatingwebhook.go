@@ -58,6 +58,16 @@ func (v *kabaneroValidator) validatekabaneroFn(ctx context.Context, kab *kabaner
 		return allowed, reason, err
 	}
 
+	allowed, reason, err = kutils.ValidateSignatureVerification(kab)
+	if !allowed {
+		return allowed, reason, err
+	}
+
+	allowed, reason, err = kutils.ValidateStackFilters(kab)
+	if !allowed {
+		return allowed, reason, err
+	}
+
 	// Make sure any pipelines have a location, and a sha256 set.
 	for _, pipeline := range kab.Spec.Gitops.Pipelines {
 		if len(pipeline.Https.Url) == 0 && pipeline.GitRelease == (kabanerov1alpha2.GitReleaseSpec{}) {
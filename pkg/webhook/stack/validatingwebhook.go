@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
 	"github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
@@ -68,6 +69,12 @@ func (v *stackValidator) validateStackFn(ctx context.Context, stack *kabanerov1a
 		return false, reason, err
 	}
 
+	if (len(stack.Spec.AssetDriftPolicy) != 0) && !(strings.EqualFold(stack.Spec.AssetDriftPolicy, kabanerov1alpha2.AssetDriftPolicyReport) || strings.EqualFold(stack.Spec.AssetDriftPolicy, kabanerov1alpha2.AssetDriftPolicyRevert)) {
+		reason = fmt.Sprintf("Stack %v Spec.AssetDriftPolicy may only be set to report or revert. stack: %v", stack.Spec.Name, stack)
+		err = fmt.Errorf(reason)
+		return false, reason, err
+	}
+
 	for _, version := range stack.Spec.Versions {
 
 		if len(version.Version) == 0 {
@@ -83,12 +90,33 @@ func (v *stackValidator) validateStackFn(ctx context.Context, stack *kabanerov1a
 			return false, reason, err
 		}
 
-		if (len(version.DesiredState) != 0) && !((strings.ToLower(version.DesiredState) == "active") || (strings.ToLower(version.DesiredState) == "inactive")) {
-			reason = fmt.Sprintf("Stack %v %v Spec.Versions[].DesiredState may only be set to active or inactive. stack: %v", stack.Spec.Name, version.Version, stack)
+		if (len(version.DesiredState) != 0) && !((strings.ToLower(version.DesiredState) == "active") || (strings.ToLower(version.DesiredState) == "inactive") || (strings.ToLower(version.DesiredState) == "canary")) {
+			reason = fmt.Sprintf("Stack %v %v Spec.Versions[].DesiredState may only be set to active, inactive or canary. stack: %v", stack.Spec.Name, version.Version, stack)
 			err = fmt.Errorf(reason)
 			return false, reason, err
 		}
 
+		if strings.ToLower(version.DesiredState) == "canary" {
+			if len(version.Canary.Namespaces) == 0 {
+				reason = fmt.Sprintf("Stack %v %v Spec.Versions[].Canary.Namespaces must contain at least one namespace when the desired state is canary. stack: %v", stack.Spec.Name, version.Version, stack)
+				err = fmt.Errorf(reason)
+				return false, reason, err
+			}
+
+			if len(version.Canary.SoakPeriod) != 0 {
+				if _, err := time.ParseDuration(version.Canary.SoakPeriod); err != nil {
+					reason = fmt.Sprintf("Stack %v %v Spec.Versions[].Canary.SoakPeriod is not a valid duration: %v. stack: %v", stack.Spec.Name, version.Version, err, stack)
+					return false, reason, err
+				}
+			}
+
+			if version.Canary.FailureThreshold < 0 || version.Canary.FailureThreshold > 100 || version.Canary.SuccessfulRuns < 0 || version.Canary.MinimumRuns < 0 {
+				reason = fmt.Sprintf("Stack %v %v Spec.Versions[].Canary.FailureThreshold must be a percentage, and the PipelineRun counts may not be negative. stack: %v", stack.Spec.Name, version.Version, stack)
+				err = fmt.Errorf(reason)
+				return false, reason, err
+			}
+		}
+
 		if len(version.Images) == 0 {
 			reason = fmt.Sprintf("Stack %v %v must contain at least one entry for spec.Versions[].Images. stack: %v", stack.Spec.Name, version.Version, stack)
 			err = fmt.Errorf(reason)
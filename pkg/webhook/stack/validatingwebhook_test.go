@@ -517,3 +517,60 @@ func TestValidatingWebhook21(t *testing.T) {
 		t.Fatal("Validation failed. An error was expected: ", err)
 	}
 }
+
+// Invalid Spec.AssetDriftPolicy
+func TestValidatingWebhook22(t *testing.T) {
+	newStack := validatingStack.DeepCopy()
+	newStack.Spec.AssetDriftPolicy = "ignore"
+
+	cv := stackValidator{}
+	allowed, msg, err := cv.validateStackFn(nil, newStack)
+
+	if allowed {
+		t.Fatal("Validation should have failed because the asset drift policy is not valid.")
+	}
+
+	if len(msg) == 0 {
+		t.Fatal("Validation failed. A message was expected: ", msg)
+	}
+
+	if err == nil {
+		t.Fatal("Validation failed. An error was expected: ", err)
+	}
+
+	newStack.Spec.AssetDriftPolicy = "Revert"
+	allowed, _, err = cv.validateStackFn(nil, newStack)
+	if !allowed {
+		t.Fatal("Validation should have passed for the revert asset drift policy. Error: ", err)
+	}
+}
+
+// Canary desired state
+func TestValidatingWebhook23(t *testing.T) {
+	newStack := validatingStack.DeepCopy()
+	newStack.Spec.Versions[0].DesiredState = "canary"
+
+	cv := stackValidator{}
+	allowed, msg, err := cv.validateStackFn(nil, newStack)
+
+	if allowed {
+		t.Fatal("Validation should have failed because the canary namespaces are missing.")
+	}
+
+	if len(msg) == 0 {
+		t.Fatal("Validation failed. A message was expected: ", msg)
+	}
+
+	newStack.Spec.Versions[0].Canary = kabanerov1alpha2.StackCanary{Namespaces: []string{"team-a"}, SoakPeriod: "one day"}
+	allowed, _, err = cv.validateStackFn(nil, newStack)
+	if allowed {
+		t.Fatal("Validation should have failed because the canary soak period is not a valid duration.")
+	}
+
+	newStack.Spec.Versions[0].Canary.SoakPeriod = "24h"
+	newStack.Spec.Versions[0].Canary.FailureThreshold = 20
+	allowed, _, err = cv.validateStackFn(nil, newStack)
+	if !allowed {
+		t.Fatal("Validation should have passed for a valid canary rollout. Error: ", err)
+	}
+}
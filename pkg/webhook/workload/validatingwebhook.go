@@ -0,0 +1,117 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	sutils "github.com/kabanero-io/kabanero-operator/pkg/controller/stack/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var log = logf.Log.WithName("workload-validating-webhook")
+
+// BuildValidatingWebhook builds the webhook for the manager to register
+func BuildValidatingWebhook(mgr *manager.Manager, kabaneroNamespace string) *admission.Webhook {
+	return &admission.Webhook{Handler: &workloadValidator{namespace: kabaneroNamespace, recorder: (*mgr).GetEventRecorderFor("kabanero-operator-admission-webhook")}}
+}
+
+// workloadValidator validates workloads built from Kabanero stacks against the governance stack policy.
+type workloadValidator struct {
+	client    client.Client
+	decoder   *admission.Decoder
+	namespace string
+
+	// Records the stack policy violations of the admitted workloads on the Kabanero instance
+	recorder record.EventRecorder
+}
+
+// Implement admission.Handler so the controller can handle admission request.
+// This no-op assignment ensures that the struct implements the interface.
+var _ admission.Handler = &workloadValidator{}
+
+// workloadValidator admits a workload if the stack it was built from complies with the governance stack policy.
+func (v *workloadValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	workload := &unstructured.Unstructured{}
+	err := workload.UnmarshalJSON(req.Object.Raw)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	allowed, reason, err := v.validateWorkloadFn(ctx, workload)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.ValidationResponse(allowed, reason)
+}
+
+func (v *workloadValidator) validateWorkloadFn(ctx context.Context, workload *unstructured.Unstructured) (bool, string, error) {
+	stackId, version, digest := getStackIdentity(workload)
+
+	// Workloads that were not built from a stack are not governed.
+	if len(stackId) == 0 {
+		return true, "", nil
+	}
+
+	kabList := &kabanerov1alpha2.KabaneroList{}
+	err := v.client.List(ctx, kabList, client.InNamespace(v.namespace))
+	if err != nil {
+		return false, "", fmt.Errorf("Unable to list Kabanero instances in namespace %v: %v", v.namespace, err)
+	}
+
+	if len(kabList.Items) == 0 {
+		return true, "", nil
+	}
+
+	stackList := &kabanerov1alpha2.StackList{}
+	err = v.client.List(ctx, stackList, client.InNamespace(v.namespace))
+	if err != nil {
+		return false, "", fmt.Errorf("Unable to list Stacks in namespace %v: %v", v.namespace, err)
+	}
+
+	decision := sutils.EvaluateWorkloadStack(kabList.Items[0].Spec.GovernancePolicy.StackPolicy, stackList.Items, stackId, version, digest, workload.GetNamespace())
+	switch decision.Decision {
+	case sutils.PolicyDecisionReject:
+		log.Info(fmt.Sprintf("Rejected %v %v/%v: %v", workload.GetKind(), workload.GetNamespace(), workload.GetName(), decision.Reason))
+		return false, decision.Reason, nil
+	case sutils.PolicyDecisionWarn:
+		// The reason of an admitted workload is not shown to the user, so the violation is recorded as an
+		// event of the Kabanero instance.
+		message := fmt.Sprintf("Admitted %v %v/%v with a stack policy violation: %v", workload.GetKind(), workload.GetNamespace(), workload.GetName(), decision.Reason)
+		log.Info(message)
+		if v.recorder != nil {
+			v.recorder.Event(&kabList.Items[0], corev1.EventTypeWarning, "StackPolicyViolation", message)
+		}
+		return true, decision.Reason, nil
+	}
+
+	return true, "", nil
+}
+
+// Returns the stack id, version and image digest recorded in the workload's metadata.  Only the workload's own
+// labels are read, since the webhook is only called for the workloads with the stack id label.
+func getStackIdentity(workload *unstructured.Unstructured) (string, string, string) {
+	labels := workload.GetLabels()
+	annotations := workload.GetAnnotations()
+	return labels[sutils.StackIdLabel], labels[sutils.StackVersionLabel], annotations[sutils.StackDigestAnnotation]
+}
+
+// InjectClient injects the client.
+func (v *workloadValidator) InjectClient(c client.Client) error {
+	v.client = c
+	return nil
+}
+
+// InjectDecoder injects the decoder.
+func (v *workloadValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
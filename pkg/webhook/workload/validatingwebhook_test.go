@@ -0,0 +1,128 @@
+package workload
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	kabanerov1alpha2 "github.com/kabanero-io/kabanero-operator/pkg/apis/kabanero/v1alpha2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Tests that the stack identity is read from the workload metadata, and not from its pod template.
+func TestGetStackIdentity(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name": "myapp",
+			"labels": map[string]interface{}{
+				"stack.appsody.dev/id":      "java-microprofile",
+				"stack.appsody.dev/version": "0.2.5",
+			},
+			"annotations": map[string]interface{}{
+				"stack.appsody.dev/digest": "sha256:0123456789abcdef",
+			},
+		},
+	}}
+
+	stackId, version, digest := getStackIdentity(deployment)
+	if stackId != "java-microprofile" || version != "0.2.5" || digest != "sha256:0123456789abcdef" {
+		t.Fatalf("Unexpected stack identity from workload metadata: %v %v %v", stackId, version, digest)
+	}
+
+	templated := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "myapp"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{
+						"stack.appsody.dev/id":      "nodejs",
+						"stack.appsody.dev/version": "0.3.1",
+					},
+				},
+			},
+		},
+	}}
+
+	stackId, version, digest = getStackIdentity(templated)
+	if stackId != "" || version != "" || digest != "" {
+		t.Fatalf("The stack identity should not be read from the workload pod template: %v %v %v", stackId, version, digest)
+	}
+}
+
+// Unit test Kube client that lists a Kabanero instance and its stacks.
+type workloadTestClient struct {
+	client.Client
+	stacks []kabanerov1alpha2.Stack
+}
+
+func (c workloadTestClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	switch l := list.(type) {
+	case *kabanerov1alpha2.KabaneroList:
+		l.Items = []kabanerov1alpha2.Kabanero{{ObjectMeta: metav1.ObjectMeta{Name: "kabanero", Namespace: "kabanero"}}}
+	case *kabanerov1alpha2.StackList:
+		l.Items = c.stacks
+	}
+	return nil
+}
+
+// Tests that the stack policy violations of the admitted workloads are recorded as events.
+func TestValidateWorkloadWarning(t *testing.T) {
+	stacks := []kabanerov1alpha2.Stack{{
+		ObjectMeta: metav1.ObjectMeta{Name: "java-microprofile", Namespace: "kabanero"},
+		Spec:       kabanerov1alpha2.StackSpec{Name: "java-microprofile"},
+		Status: kabanerov1alpha2.StackStatus{
+			Versions: []kabanerov1alpha2.StackVersionStatus{{Version: "0.2.5", Status: kabanerov1alpha2.StackDesiredStateActive}},
+		},
+	}}
+	recorder := record.NewFakeRecorder(10)
+	v := &workloadValidator{client: workloadTestClient{stacks: stacks}, namespace: "kabanero", recorder: recorder}
+
+	// The digest of the workload is unknown, which is only a warning with the default policy.
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "myapp",
+			"namespace": "team-a",
+			"labels": map[string]interface{}{
+				"stack.appsody.dev/id":      "java-microprofile",
+				"stack.appsody.dev/version": "0.2.5",
+			},
+		},
+	}}
+
+	allowed, reason, err := v.validateWorkloadFn(context.TODO(), deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || len(reason) == 0 {
+		t.Fatalf("The workload should have been admitted with a reason: %v %v", allowed, reason)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "StackPolicyViolation") || !strings.Contains(event, "team-a/myapp") {
+			t.Fatalf("Unexpected event: %v", event)
+		}
+	default:
+		t.Fatal("The stack policy violation should have been recorded as an event")
+	}
+
+	// A rejected workload is not recorded.
+	deployment.SetLabels(map[string]string{"stack.appsody.dev/id": "nodejs", "stack.appsody.dev/version": "0.2.5"})
+	allowed, _, err = v.validateWorkloadFn(context.TODO(), deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed || len(recorder.Events) != 0 {
+		t.Fatalf("The workload should have been rejected without an event: %v %v", allowed, len(recorder.Events))
+	}
+}